@@ -1,13 +1,39 @@
 package main
 
 import (
+	"log"
+	"time"
+
+	"github.com/guilherme-gatti/poc_scorm/internal/blobstore"
 	"github.com/guilherme-gatti/poc_scorm/internal/router"
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
 	"github.com/guilherme-gatti/poc_scorm/internal/storage"
 )
 
 func main() {
 	storage.InitDB("storage/database.db")
 
+	// onde ficam os arquivos dos pacotes: disco local ou S3 (CONTENT_STORE)
+	store, err := blobstore.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	scorm.SetContentStore(store)
+
+	// cursos importados antes do armazenamento endereçado por conteúdo
+	if err := scorm.MigrateCourseStorage(); err != nil {
+		log.Fatal(err)
+	}
+	// e antes do versionamento dos cursos
+	if err := scorm.MigrateCourseVersions(); err != nil {
+		log.Fatal(err)
+	}
+
+	// workers que processam os pacotes enviados em POST /upload
+	scorm.StartImportWorkers(2)
+	// e a limpeza dos uploads em partes abandonados
+	scorm.StartUploadExpiry(time.Hour)
+
 	r := router.SetupRouter()
 	r.Run(":3000")
 }
@@ -0,0 +1,82 @@
+// Package blobstore guarda o conteúdo dos pacotes SCORM. Store é
+// implementado em disco local (NewLocal), em memória (NewMemory, para
+// testes) e em qualquer serviço compatível com S3 (NewS3), o que permite
+// rodar mais de uma instância do servidor sobre o mesmo conteúdo.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound indica que a chave não existe no armazenamento
+var ErrNotFound = errors.New("blobstore: objeto não encontrado")
+
+// Info descreve um objeto armazenado
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Store guarda objetos por chave. As chaves usam "/" como separador
+// ("blobs/ab/abcdef...") e não podem ter "..", nem começar com "/".
+type Store interface {
+	// Put grava os size bytes de r na chave, substituindo o objeto anterior
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Open abre o objeto para leitura. O Seek não lê nada por si só, então
+	// servir um Range de um objeto grande só transfere o trecho pedido.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, Info, error)
+	// Stat retorna ErrNotFound quando a chave não existe
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete remove o objeto; remover uma chave inexistente não é erro
+	Delete(ctx context.Context, key string) error
+}
+
+// checkKey recusa chaves que escapariam da raiz do armazenamento
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("blobstore: chave inválida %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("blobstore: chave inválida %q", key)
+		}
+	}
+	return nil
+}
+
+// FromEnv cria o Store configurado pelas variáveis de ambiente:
+//
+//	CONTENT_STORE=local (padrão)  CONTENT_STORE_DIR (padrão ./storage)
+//	CONTENT_STORE=memory
+//	CONTENT_STORE=s3              S3_ENDPOINT, S3_BUCKET, S3_REGION (padrão us-east-1),
+//	                              S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY, S3_PATH_STYLE
+func FromEnv() (Store, error) {
+	switch backend := os.Getenv("CONTENT_STORE"); backend {
+	case "", "local":
+		dir := os.Getenv("CONTENT_STORE_DIR")
+		if dir == "" {
+			dir = "./storage"
+		}
+		return NewLocal(dir), nil
+	case "memory":
+		return NewMemory(), nil
+	case "s3":
+		cfg := S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+		}
+		return NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("blobstore: CONTENT_STORE desconhecido %q", backend)
+	}
+}
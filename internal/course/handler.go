@@ -2,14 +2,14 @@ package course
 
 import (
 	"net/http"
-	"os"
 
 	"github.com/gin-gonic/gin"
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
 	"github.com/guilherme-gatti/poc_scorm/internal/storage"
 )
 
 func CoursesHandler(c *gin.Context) {
-	rows, err := storage.DB.Query(`SELECT id, identifier, version, path FROM courses`)
+	rows, err := storage.DB.Query(`SELECT id, identifier, version, storage_key FROM courses`)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar cursos"})
 		return
@@ -20,9 +20,9 @@ func CoursesHandler(c *gin.Context) {
 
 	for rows.Next() {
 		var id int
-		var identifier, version, path string
+		var identifier, version, storageKey string
 
-		if err := rows.Scan(&id, &identifier, &version, &path); err != nil {
+		if err := rows.Scan(&id, &identifier, &version, &storageKey); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler cursos"})
 			return
 		}
@@ -31,40 +31,15 @@ func CoursesHandler(c *gin.Context) {
 			"id":         id,
 			"identifier": identifier,
 			"version":    version,
-			"path":       path,
+			"storageKey": storageKey,
 		})
 	}
 
 	c.JSON(http.StatusOK, result)
 }
 
+// DeleteCourseHandler remove o curso; o conteúdo armazenado é liberado pelo
+// pacote scorm, que sabe se outro curso ainda usa os mesmos arquivos
 func DeleteCourseHandler(c *gin.Context) {
-	courseID := c.Param("id")
-
-	var path string
-	err := storage.DB.QueryRow(`SELECT path FROM courses WHERE id = ?`, courseID).Scan(&path)
-	if err != nil {
-		c.JSON(404, gin.H{"error": "Curso não encontrado"})
-		return
-	}
-
-	_, err = storage.DB.Exec(`DELETE FROM progress WHERE course_id = ?`, courseID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover progressos"})
-		return
-	}
-
-	_, err = storage.DB.Exec(`DELETE FROM courses WHERE id = ?`, courseID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover curso"})
-		return
-	}
-
-	err = os.RemoveAll(path)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover arquivos"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"status": "Curso removido"})
+	scorm.DeleteCourseHandler(c)
 }
@@ -11,8 +11,10 @@ func SetupRouter() *gin.Engine {
 
 	r.GET("/ping", scorm.PingHandler)
 
-	// rota para servir o index.html do pacote SCORM
-	r.Static("/packages", "./storage/")
+	// arquivos dos pacotes SCORM por URL assinada (GET /courses/:id/content-url);
+	// o conteúdo de um launch é servido em /content/:session
+	r.GET("/packages/:key/:grant/*path", scorm.SignedContentHandler)
+	r.HEAD("/packages/:key/:grant/*path", scorm.SignedContentHandler)
 
 	SetupScormPackageRoutes(r)
 	SetupScormrtRoutes(r)
@@ -10,12 +10,32 @@ func SetupScormPackageRoutes(r *gin.Engine) {
 	r.GET("/progress/:userId", scorm.ProgressHandler)
 	r.POST("/track", scorm.TrackHandler)
 	r.POST("/upload", scorm.UploadHandler)
+	r.GET("/imports/:id", scorm.ImportStatusHandler)
+	r.POST("/manifests/lint", scorm.LintManifestHandler)
+
+	// upload em partes retomável (protocolo tus)
+	r.OPTIONS("/uploads", scorm.UploadOptionsHandler)
+	r.POST("/uploads", scorm.CreateUploadHandler)
+	r.HEAD("/uploads/:id", scorm.UploadOffsetHandler)
+	r.GET("/uploads/:id", scorm.UploadStatusHandler)
+	r.PATCH("/uploads/:id", scorm.UploadChunkHandler)
+	r.DELETE("/uploads/:id", scorm.DeleteUploadHandler)
 	r.GET("/progress/:userId/csv", scorm.ExportCSVHandler)
 	r.GET("/progress/:userId/pdf", scorm.ExportPDFHandler)
+	r.GET("/progress/:userId/time", scorm.SeatTimeHandler)
 
 	r.GET("/courses", scorm.ListCoursesHandler)
 	r.GET("/courses/:id/validated", scorm.GetCourseValidatedHandler)
 	r.GET("/courses/:id/view", scorm.GetCourseValidatedHandler)
 	r.POST("/courses/:id/validate", scorm.ValidateExistingCourseHandler)
+	r.PUT("/courses/:id/attempt-limit", scorm.UpdateAttemptLimitHandler)
+	r.GET("/courses/:id/content-url", scorm.ContentURLHandler)
+
+	// versões do curso (pacotes reenviados com o mesmo identifier)
+	r.GET("/courses/:id/versions", scorm.ListVersionsHandler)
+	r.GET("/courses/:id/versions/diff", scorm.DiffVersionsHandler)
+	r.GET("/courses/:id/versions/:number/lint", scorm.VersionLintHandler)
+	r.POST("/courses/:id/versions/:number/rollback", scorm.RollbackVersionHandler)
+	r.PUT("/courses/:id/migration-policy", scorm.UpdateMigrationPolicyHandler)
 	r.DELETE("/courses/:id", scorm.DeleteCourseHandler)
 }
@@ -7,4 +7,20 @@ import (
 
 func SetupScormrtRoutes(r *gin.Engine) {
 	r.POST("/scormrt", scormrt.RuntimeHandler)
+	r.POST("/scormrt/batch", scormrt.BatchHandler)
+	r.POST("/courses/:id/launch", scormrt.LaunchHandler)
+	r.POST("/courses/:id/navigate", scormrt.NavigateHandler)
+
+	r.GET("/progress/:userId/courses/:courseId/rollup", scormrt.RollupHandler)
+	r.GET("/progress/:userId/attempts", scormrt.AttemptsHandler)
+	r.GET("/attempts/:id/interactions", scormrt.InteractionsHandler)
+	r.GET("/attempts/:id/objectives", scormrt.ObjectivesHandler)
+
+	// player que expõe window.API / window.API_1484_11 ao conteúdo
+	r.GET("/player/api.js", scormrt.PlayerScriptHandler)
+	r.GET("/player/:session", scormrt.PlayerHandler)
+
+	// arquivos do pacote do curso, autorizados pela sessão do launch
+	r.GET("/content/:session/*path", scormrt.ContentHandler)
+	r.HEAD("/content/:session/*path", scormrt.ContentHandler)
 }
@@ -0,0 +1,428 @@
+package scorm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/guilherme-gatti/poc_scorm/internal/blobstore"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// Armazenamento endereçado por conteúdo. Cada arquivo de um pacote é gravado
+// uma única vez no contentStore, na chave blobs/<sha256>, não importa em
+// quantos pacotes apareça, e a tabela package_files liga o caminho do
+// arquivo dentro do pacote ao blob. O pacote é identificado pela chave de
+// armazenamento (courses.storage_key): o SHA-256 do zip enviado, então
+// reenviar o mesmo zip reaproveita o pacote inteiro. Os zips enviados e a
+// extração temporária ficam sempre em disco local.
+const (
+	// incomingDir guarda os zips enviados até a importação terminar
+	incomingDir = "./storage/incoming"
+
+	// workDir guarda a extração temporária de cada importação
+	workDir = "./storage/work"
+)
+
+// packagesMu impede que um pacote seja removido por releasePackage enquanto
+// outra importação o registra e publica um curso com ele. A gravação dos
+// blobs acontece fora dele (veja stagePackage).
+var packagesMu sync.Mutex
+
+// pendingBlobs conta, por hash, as importações que gravaram o blob e ainda
+// não registraram o pacote em package_files; releasePackage não apaga esses
+// blobs. Protegido por packagesMu.
+var pendingBlobs = map[string]int{}
+
+// PackageFile é um arquivo de um pacote armazenado
+type PackageFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// contentStore guarda os blobs dos pacotes; em disco sob ./storage por
+// padrão
+var contentStore blobstore.Store = blobstore.NewLocal("./storage")
+
+// SetContentStore troca o armazenamento dos blobs. Deve ser chamado antes de
+// iniciar os workers de importação e o servidor.
+func SetContentStore(store blobstore.Store) {
+	contentStore = store
+}
+
+// blobKey é a chave do blob com o hash dado, dividida pelos dois primeiros
+// caracteres para não concentrar tudo num diretório no disco local
+func blobKey(sum string) string {
+	return "blobs/" + sum[:2] + "/" + sum
+}
+
+// hashFile calcula o SHA-256 de um arquivo
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// putBlob copia o arquivo em path para o armazenamento, se o conteúdo ainda
+// não estiver lá, e retorna o hash dele. O blob gravado é relido e conferido
+// com o hash, uma vez, na importação; um blob existente com outro tamanho é
+// tratado como corrompido e gravado de novo.
+func putBlob(ctx context.Context, path string) (string, int64, error) {
+	sum, size, err := hashFile(path)
+	if err != nil {
+		return "", 0, err
+	}
+	return sum, size, storeBlob(ctx, path, sum, size)
+}
+
+// storeBlob é putBlob para um arquivo com hash e tamanho já calculados
+func storeBlob(ctx context.Context, path, sum string, size int64) error {
+	info, err := contentStore.Stat(ctx, blobKey(sum))
+	if err == nil && info.Size == size {
+		return nil
+	}
+	if err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := contentStore.Put(ctx, blobKey(sum), in, size); err != nil {
+		return err
+	}
+	return verifyBlob(ctx, sum)
+}
+
+// verifyBlob lê o blob inteiro do armazenamento e confere o hash
+func verifyBlob(ctx context.Context, sum string) error {
+	f, _, err := contentStore.Open(ctx, blobKey(sum))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != sum {
+		return fmt.Errorf("blob %s: %w", sum, errCorruptBlob)
+	}
+	return nil
+}
+
+// stagedPackage são os arquivos de um pacote já gravados no armazenamento,
+// à espera de storePackage. sums são os blobs marcados em pendingBlobs.
+type stagedPackage struct {
+	files []PackageFile
+	total int64
+	sums  []string
+}
+
+// stagePackage grava os blobs dos arquivos extraídos em dir sem segurar
+// packagesMu, para que uma importação grande não trave as outras nem a
+// remoção de cursos. Cada blob é marcado como pendente antes de ser
+// conferido ou gravado; quem chama desfaz as marcas com unstage. Se o
+// pacote já está armazenado nada é gravado e o retorno é nil.
+func stagePackage(key, dir string) (*stagedPackage, error) {
+	stored, err := packageStored(key)
+	if err != nil || stored {
+		return nil, err
+	}
+
+	p := &stagedPackage{}
+	err = p.collect(dir, func(sum string) {
+		packagesMu.Lock()
+		pendingBlobs[sum]++
+		packagesMu.Unlock()
+		p.sums = append(p.sums, sum)
+	})
+	if err != nil {
+		packagesMu.Lock()
+		p.unstage()
+		packagesMu.Unlock()
+		return nil, fmt.Errorf("erro ao armazenar arquivos do pacote: %w", err)
+	}
+	return p, nil
+}
+
+// collect grava os blobs dos arquivos em dir, chamando mark com o hash de
+// cada um antes de gravá-lo
+func (p *stagedPackage) collect(dir string, mark func(sum string)) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum, size, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if mark != nil {
+			mark(sum)
+		}
+		if err := storeBlob(context.Background(), path, sum, size); err != nil {
+			return err
+		}
+		p.files = append(p.files, PackageFile{Path: filepath.ToSlash(rel), SHA256: sum, Size: size})
+		p.total += size
+		return nil
+	})
+}
+
+// unstage desfaz as marcas de pendingBlobs do pacote. Quem chama deve
+// segurar packagesMu.
+func (p *stagedPackage) unstage() {
+	if p == nil {
+		return
+	}
+	for _, sum := range p.sums {
+		if pendingBlobs[sum]--; pendingBlobs[sum] <= 0 {
+			delete(pendingBlobs, sum)
+		}
+	}
+	p.sums = nil
+}
+
+func packageStored(key string) (bool, error) {
+	var exists int
+	err := storage.DB.QueryRow(`SELECT COUNT(*) FROM packages WHERE storage_key = ?`, key).Scan(&exists)
+	return exists > 0, err
+}
+
+// storePackage registra sob a chave dada os arquivos gravados por
+// stagePackage. Se o pacote já estiver armazenado nada é feito; se ele foi
+// removido depois de stagePackage ver que existia, os blobs são gravados
+// agora, já com o lock. Quem chama deve segurar packagesMu.
+func storePackage(key, dir string, p *stagedPackage) error {
+	stored, err := packageStored(key)
+	if err != nil || stored {
+		return err
+	}
+	if p == nil {
+		p = &stagedPackage{}
+		if err := p.collect(dir, nil); err != nil {
+			return fmt.Errorf("erro ao armazenar arquivos do pacote: %w", err)
+		}
+	}
+
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, f := range p.files {
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO package_files (storage_key, path, sha256, size) VALUES (?, ?, ?, ?)
+		`, key, f.Path, f.SHA256, f.Size)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO packages (storage_key, file_count, size, created_at) VALUES (?, ?, ?, ?)
+	`, key, len(p.files), p.total, now())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// packageFile busca um arquivo de um pacote pelo caminho relativo
+func packageFile(key, path string) (PackageFile, error) {
+	f := PackageFile{Path: path}
+	err := storage.DB.QueryRow(`
+		SELECT sha256, size FROM package_files WHERE storage_key = ? AND path = ?
+	`, key, path).Scan(&f.SHA256, &f.Size)
+	return f, err
+}
+
+// releasePackage remove o pacote se nenhum curso ou versão de curso usa mais
+// a chave, e os blobs que não pertencem a nenhum outro pacote nem estão
+// pendentes numa importação. Quem chama deve segurar packagesMu.
+func releasePackage(key string) error {
+	var courses int
+	err := storage.DB.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM courses WHERE storage_key = ?) + (SELECT COUNT(*) FROM course_versions WHERE storage_key = ?)
+	`, key, key).Scan(&courses)
+	if err != nil || courses > 0 {
+		return err
+	}
+
+	rows, err := storage.DB.Query(`SELECT DISTINCT sha256 FROM package_files WHERE storage_key = ?`, key)
+	if err != nil {
+		return err
+	}
+	var sums []string
+	for rows.Next() {
+		var sum string
+		if err := rows.Scan(&sum); err != nil {
+			rows.Close()
+			return err
+		}
+		sums = append(sums, sum)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := storage.DB.Exec(`DELETE FROM package_files WHERE storage_key = ?`, key); err != nil {
+		return err
+	}
+	if _, err := storage.DB.Exec(`DELETE FROM packages WHERE storage_key = ?`, key); err != nil {
+		return err
+	}
+
+	for _, sum := range sums {
+		var refs int
+		err := storage.DB.QueryRow(`SELECT COUNT(*) FROM package_files WHERE sha256 = ?`, sum).Scan(&refs)
+		if err != nil {
+			return err
+		}
+		if refs == 0 && pendingBlobs[sum] == 0 {
+			if err := contentStore.Delete(context.Background(), blobKey(sum)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newWorkDir cria uma pasta temporária para extrair um pacote
+func newWorkDir() (string, error) {
+	dir := filepath.Join(workDir, uuid.New().String())
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// MigrateCourseStorage move para o armazenamento endereçado por conteúdo os
+// cursos importados antes dele, que guardavam a pasta extraída em
+// courses.path, e remove essa coluna. Como o zip original não existe mais, a
+// chave desses cursos é o SHA-256 da lista de arquivos e hashes do pacote.
+func MigrateCourseStorage() error {
+	exists, err := storage.HasColumn("courses", "path")
+	if err != nil || !exists {
+		return err
+	}
+
+	rows, err := storage.DB.Query(`SELECT id, path FROM courses WHERE storage_key = ''`)
+	if err != nil {
+		return err
+	}
+	legacy := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy[id] = path
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, path := range legacy {
+		key, err := treeKey(path)
+		if err != nil {
+			log.Printf("scorm: curso %d sem arquivos em %s, mantido sem conteúdo: %v", id, path, err)
+			continue
+		}
+		staged, err := stagePackage(key, path)
+		if err != nil {
+			return fmt.Errorf("erro ao migrar curso %d: %w", id, err)
+		}
+		packagesMu.Lock()
+		err = storePackage(key, path, staged)
+		staged.unstage()
+		packagesMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("erro ao migrar curso %d: %w", id, err)
+		}
+		if _, err := storage.DB.Exec(`UPDATE courses SET storage_key = ? WHERE id = ?`, key, id); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("scorm: erro ao remover pasta antiga do curso %d: %v", id, err)
+		}
+	}
+
+	_, err = storage.DB.Exec(`ALTER TABLE courses DROP COLUMN path`)
+	return err
+}
+
+// treeKey calcula a chave de uma pasta extraída a partir dos caminhos e
+// hashes dos seus arquivos
+func treeKey(dir string) (string, error) {
+	var lines []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum, _, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, filepath.ToSlash(rel)+"\x00"+sum)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(lines)
+	h := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(h[:]), nil
+}
+
+// openBlob abre um blob para servir. O hash foi conferido quando o blob foi
+// gravado; aqui só o tamanho é comparado com o registrado em package_files,
+// para não baixar o objeto inteiro a cada requisição (um Range no S3 busca
+// só o trecho pedido).
+func openBlob(ctx context.Context, sum string, size int64) (io.ReadSeekCloser, blobstore.Info, error) {
+	f, info, err := contentStore.Open(ctx, blobKey(sum))
+	if err != nil {
+		return nil, blobstore.Info{}, err
+	}
+	if info.Size != size {
+		f.Close()
+		return nil, blobstore.Info{}, errCorruptBlob
+	}
+	return f, info, nil
+}
+
+var errCorruptBlob = errors.New("conteúdo não confere com o hash")
@@ -0,0 +1,247 @@
+package scorm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guilherme-gatti/poc_scorm/internal/blobstore"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// countingStore conta os bytes lidos dos objetos abertos
+type countingStore struct {
+	blobstore.Store
+	read int64
+}
+
+type countingReader struct {
+	io.ReadSeekCloser
+	s *countingStore
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	r.s.read += int64(n)
+	return n, err
+}
+
+func (s *countingStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, blobstore.Info, error) {
+	f, info, err := s.Store.Open(ctx, key)
+	if err != nil {
+		return nil, info, err
+	}
+	return countingReader{f, s}, info, nil
+}
+
+// useStore troca o contentStore durante o teste
+func useStore(t *testing.T, store blobstore.Store) {
+	previous := contentStore
+	SetContentStore(store)
+	t.Cleanup(func() { SetContentStore(previous) })
+}
+
+func writeTemp(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "arquivo")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPutBlobRewritesBlobWithWrongSize(t *testing.T) {
+	store := blobstore.NewMemory()
+	useStore(t, store)
+	ctx := context.Background()
+
+	sum, size, err := putBlob(ctx, writeTemp(t, "conteúdo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// um blob truncado no armazenamento é gravado de novo na próxima importação
+	store.Put(ctx, blobKey(sum), strings.NewReader("con"), 3)
+	if _, _, err := openBlob(ctx, sum, size); !errors.Is(err, errCorruptBlob) {
+		t.Fatalf("openBlob de blob truncado: %v, esperado errCorruptBlob", err)
+	}
+	if _, _, err := putBlob(ctx, writeTemp(t, "conteúdo")); err != nil {
+		t.Fatal(err)
+	}
+	f, _, err := openBlob(ctx, sum, size)
+	if err != nil {
+		t.Fatalf("openBlob depois de reimportar: %v", err)
+	}
+	f.Close()
+}
+
+// um armazenamento que grava outra coisa falha a importação
+type corruptingStore struct {
+	*blobstore.Memory
+}
+
+func (s corruptingStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	io.Copy(io.Discard, r)
+	return s.Memory.Put(ctx, key, strings.NewReader(strings.Repeat("x", int(size))), size)
+}
+
+func TestPutBlobVerifiesStoredContent(t *testing.T) {
+	useStore(t, corruptingStore{blobstore.NewMemory()})
+	if _, _, err := putBlob(context.Background(), writeTemp(t, "conteúdo")); !errors.Is(err, errCorruptBlob) {
+		t.Errorf("putBlob = %v, esperado errCorruptBlob", err)
+	}
+}
+
+func TestServePackageFileRangeReadsOnlyTheRange(t *testing.T) {
+	store := &countingStore{Store: blobstore.NewMemory()}
+	useStore(t, store)
+
+	data := strings.Repeat("0123456789", 1000)
+	sum, size, err := putBlob(context.Background(), writeTemp(t, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.DB.Exec(`INSERT INTO package_files (storage_key, path, sha256, size) VALUES ('range-test', 'video.mp4', ?, ?)`, sum, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/f/*path", func(c *gin.Context) {
+		ServePackageFile(c, "range-test", strings.TrimPrefix(c.Param("path"), "/"))
+	})
+
+	store.read = 0
+	req := httptest.NewRequest(http.MethodGet, "/f/video.mp4", nil)
+	req.Header.Set("Range", "bytes=9000-9009")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusPartialContent || w.Body.String() != data[9000:9010] {
+		t.Fatalf("resposta = %d %q", w.Code, w.Body)
+	}
+	if store.read > 512 {
+		t.Errorf("lidos %d bytes do armazenamento para um Range de 10", store.read)
+	}
+	if w.Header().Get("ETag") != `"`+sum+`"` {
+		t.Errorf("ETag = %q", w.Header().Get("ETag"))
+	}
+}
+
+// blockingStore segura os Puts até release ser fechado
+type blockingStore struct {
+	*blobstore.Memory
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s blockingStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	s.started <- struct{}{}
+	<-s.release
+	return s.Memory.Put(ctx, key, r, size)
+}
+
+// packageDir grava os arquivos de um pacote extraído
+func packageDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestStagePackageDoesNotHoldTheLock(t *testing.T) {
+	store := blockingStore{blobstore.NewMemory(), make(chan struct{}), make(chan struct{})}
+	useStore(t, store)
+	dir := packageDir(t, map[string]string{"index.html": "grande"})
+
+	done := make(chan error)
+	var staged *stagedPackage
+	go func() {
+		var err error
+		staged, err = stagePackage("stage-sem-lock", dir)
+		done <- err
+	}()
+
+	<-store.started
+	if !packagesMu.TryLock() {
+		t.Error("packagesMu preso enquanto os blobs são gravados")
+	} else {
+		packagesMu.Unlock()
+	}
+	close(store.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	packagesMu.Lock()
+	defer packagesMu.Unlock()
+	defer staged.unstage()
+	if err := storePackage("stage-sem-lock", dir, staged); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := packageFile("stage-sem-lock", "index.html"); err != nil {
+		t.Errorf("arquivo não registrado: %v", err)
+	}
+}
+
+func TestReleasePackageKeepsPendingBlobs(t *testing.T) {
+	useStore(t, blobstore.NewMemory())
+	ctx := context.Background()
+	shared := map[string]string{"comum.js": "compartilhado"}
+
+	old, err := stagePackage("pendente-antigo", packageDir(t, shared))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packagesMu.Lock()
+	err = storePackage("pendente-antigo", "", old)
+	old.unstage()
+	packagesMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// outra importação grava o mesmo blob e ainda não registrou o pacote
+	newDir := packageDir(t, shared)
+	staged, err := stagePackage("pendente-novo", newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := staged.files[0].SHA256
+
+	packagesMu.Lock()
+	if err := releasePackage("pendente-antigo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := contentStore.Stat(ctx, blobKey(sum)); err != nil {
+		t.Errorf("blob pendente removido: %v", err)
+	}
+	err = storePackage("pendente-novo", newDir, staged)
+	staged.unstage()
+	packagesMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sem pendência o blob sai com o último pacote que o usa
+	packagesMu.Lock()
+	err = releasePackage("pendente-novo")
+	packagesMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := contentStore.Stat(ctx, blobKey(sum)); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Errorf("blob sem pacote mantido: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package scorm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// contentURLTTL é a validade padrão de uma URL assinada
+const contentURLTTL = 15 * time.Minute
+
+// contentURLSecret assina as URLs de conteúdo. Vem de CONTENT_URL_SECRET;
+// sem ela é sorteada na inicialização, e as URLs deixam de valer quando o
+// servidor reinicia (com mais de uma instância a variável é obrigatória para
+// uma instância aceitar as URLs da outra).
+var contentURLSecret = loadContentURLSecret()
+
+func loadContentURLSecret() []byte {
+	if secret := os.Getenv("CONTENT_URL_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("scorm: erro ao gerar segredo das URLs de conteúdo: %v", err)
+	}
+	return secret
+}
+
+// contentGrant é o segmento que autoriza uma URL assinada:
+// <expiração em segundos Unix>-<HMAC-SHA256 da chave e da expiração>. A
+// assinatura cobre o pacote inteiro, não só o arquivo pedido, porque os
+// recursos que a página carrega por caminho relativo herdam o segmento.
+func contentGrant(key string, expires int64) string {
+	exp := strconv.FormatInt(expires, 10)
+	mac := hmac.New(sha256.New, contentURLSecret)
+	mac.Write([]byte(key + "\n" + exp))
+	return exp + "-" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validGrant confere a assinatura e a validade de um contentGrant
+func validGrant(key, grant string) bool {
+	exp, _, ok := strings.Cut(grant, "-")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(grant), []byte(contentGrant(key, expires)))
+}
+
+// SignedContentURL monta a URL assinada de um arquivo do pacote, válida
+// por ttl
+func SignedContentURL(key, path string, ttl time.Duration) (string, time.Time) {
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	return "/packages/" + key + "/" + contentGrant(key, expires.Unix()) + "/" + strings.TrimPrefix(path, "/"), expires
+}
+
+// maxContentURLTTL limita a validade de uma URL assinada
+const maxContentURLTTL = time.Hour
+
+// ContentSessionAge é a idade máxima, como modificador de datetime do
+// SQLite, de uma sessão de launch que ainda acessa o conteúdo: tanto para
+// pedir uma URL assinada quanto para ler os arquivos em /content/:session.
+// Passa da duração da sessão do runtime para que um SCO aberto numa aula
+// longa continue carregando seus arquivos.
+const ContentSessionAge = "-12 hours"
+
+// ContentURLHandler gera uma URL assinada e temporária para um arquivo do
+// pacote do curso (GET /courses/:id/content-url?session=...&path=index.html&ttl=600).
+// Só uma sessão de launch do curso, ainda não terminada e com menos de 12
+// horas, pode pedir a URL, que assina o pacote da versão da sessão. O ttl é
+// em segundos, de 1 a 3600; sem ele vale 15 minutos.
+func ContentURLHandler(c *gin.Context) {
+	courseID := c.Param("id")
+
+	path := strings.TrimPrefix(c.Query("path"), "/")
+	if !safeContentPath(path) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Caminho inválido"})
+		return
+	}
+
+	ttl := contentURLTTL
+	if v := c.Query("ttl"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 1 || time.Duration(seconds)*time.Second > maxContentURLTTL {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl deve ser entre 1 e 3600 segundos"})
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	session := c.Query("session")
+	if session == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sessão de launch obrigatória"})
+		return
+	}
+
+	storageKey, err := sessionStorageKey(courseID, session)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sessão inválida para o curso"})
+		return
+	}
+	if err != nil {
+		log.Printf("scorm: erro ao buscar sessão do curso %s: %v", courseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessão"})
+		return
+	}
+
+	url, expires := SignedContentURL(storageKey, path, ttl)
+	c.JSON(http.StatusOK, gin.H{"url": url, "expiresAt": expires.UTC().Format(time.RFC3339)})
+}
+
+// sessionStorageKey devolve a chave do pacote da versão em que a sessão de
+// launch roda, ou sql.ErrNoRows quando a sessão não é do curso, terminou ou
+// passou de ContentSessionAge
+func sessionStorageKey(courseID, token string) (string, error) {
+	var storageKey string
+	err := storage.DB.QueryRow(`
+		SELECT v.storage_key
+		FROM runtime_sessions s
+		JOIN course_versions v ON v.id = s.version_id
+		WHERE s.token = ? AND s.course_id = ? AND s.state != 'terminated'
+		  AND s.created_at >= datetime('now', ?)
+	`, token, courseID, ContentSessionAge).Scan(&storageKey)
+	return storageKey, err
+}
+
+// SignedContentHandler serve um arquivo do pacote por uma URL assinada
+// (GET /packages/:key/:grant/*path). Uma assinatura inválida ou vencida
+// responde 403.
+func SignedContentHandler(c *gin.Context) {
+	key := c.Param("key")
+	if !validGrant(key, c.Param("grant")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "URL inválida ou expirada"})
+		return
+	}
+	ServePackageFile(c, key, strings.TrimPrefix(c.Param("path"), "/"))
+}
+
+// safeContentPath recusa caminhos vazios, absolutos, com barra invertida,
+// com segmentos vazios, "." ou ".." e arquivos ou pastas ocultos (começando
+// com ".")
+func safeContentPath(path string) bool {
+	if path == "" || strings.HasPrefix(path, "/") || strings.Contains(path, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(path, "/") {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// ServePackageFile serve um arquivo de um pacote armazenado, depois que o
+// chamador autorizou o acesso ao pacote. Só arquivos extraídos do pacote
+// (registrados em package_files) são servidos; o banco, os zips enviados e
+// qualquer outro arquivo do servidor ficam fora de alcance. O ETag é o
+// SHA-256 do conteúdo, conferido quando o blob foi gravado.
+// O conteúdo vem do contentStore sob demanda, e Range e If-None-Match são
+// tratados pelo http.ServeContent.
+func ServePackageFile(c *gin.Context, key, path string) {
+	if !safeContentPath(path) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		return
+	}
+
+	f, err := packageFile(key, path)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar arquivo"})
+		return
+	}
+
+	blob, info, err := openBlob(c.Request.Context(), f.SHA256, f.Size)
+	if err != nil {
+		log.Printf("scorm: erro ao abrir %s do pacote %s (blob %s): %v", path, key, f.SHA256, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler arquivo"})
+		return
+	}
+	defer blob.Close()
+
+	if contentType := contentTypeFor(path); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.Header("ETag", `"`+f.SHA256+`"`)
+	// o acesso é autorizado por aluno, então caches compartilhados não guardam
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, path, info.ModTime, blob)
+}
+
+// contentTypes cobre extensões comuns em pacotes SCORM que a tabela de MIME
+// do sistema pode não ter (em contêineres mínimos ela costuma estar vazia)
+var contentTypes = map[string]string{
+	".html":  "text/html; charset=utf-8",
+	".htm":   "text/html; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".json":  "application/json",
+	".xml":   "text/xml; charset=utf-8",
+	".xsd":   "text/xml; charset=utf-8",
+	".svg":   "image/svg+xml",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".mp4":   "video/mp4",
+	".webm":  "video/webm",
+	".mp3":   "audio/mpeg",
+	".wav":   "audio/wav",
+	".ogg":   "audio/ogg",
+	".vtt":   "text/vtt; charset=utf-8",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".swf":   "application/x-shockwave-flash",
+	".pdf":   "application/pdf",
+}
+
+// contentTypeFor retorna o tipo MIME pela extensão, ou "" para o
+// http.ServeContent deduzir pelo conteúdo
+func contentTypeFor(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
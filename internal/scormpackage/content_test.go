@@ -0,0 +1,127 @@
+package scorm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+func TestSafeContentPath(t *testing.T) {
+	tests := map[string]bool{
+		"index.html":         true,
+		"assets/app.js":      true,
+		"a b/c%20d.html":     true,
+		"":                   false,
+		"/etc/passwd":        false,
+		"../scorm.db":        false,
+		"assets/../../x":     false,
+		"assets//app.js":     false,
+		"./index.html":       false,
+		".env":               false,
+		"assets/.git/config": false,
+		"assets\\..\\app.js": false,
+		"assets/app.js/":     false,
+	}
+	for path, want := range tests {
+		if got := safeContentPath(path); got != want {
+			t.Errorf("safeContentPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestValidGrant(t *testing.T) {
+	future := time.Now().Add(time.Minute).Unix()
+	grant := contentGrant("key", future)
+
+	if !validGrant("key", grant) {
+		t.Error("valid grant refused")
+	}
+	if validGrant("other", grant) {
+		t.Error("grant accepted for another package")
+	}
+	if validGrant("key", contentGrant("key", time.Now().Add(-time.Second).Unix())) {
+		t.Error("expired grant accepted")
+	}
+
+	// estender a expiração invalida a assinatura
+	_, mac, _ := strings.Cut(grant, "-")
+	if validGrant("key", strconv.FormatInt(future+3600, 10)+"-"+mac) {
+		t.Error("grant with a tampered expiry accepted")
+	}
+	for _, bad := range []string{"", "123", "abc-def", grant + "0"} {
+		if validGrant("key", bad) {
+			t.Errorf("malformed grant %q accepted", bad)
+		}
+	}
+}
+
+func TestContentURLHandlerRequiresLiveSession(t *testing.T) {
+	res, err := storage.DB.Exec(`
+		INSERT INTO course_versions (course_id, number, manifest_json, storage_key)
+		VALUES (4101, 1, '{}', 'content-test-key')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versionID, _ := res.LastInsertId()
+	sessions := []struct{ token, state, age string }{
+		{"live", "running", "+0 seconds"},
+		{"ended", "terminated", "+0 seconds"},
+		{"stale", "running", "-13 hours"},
+	}
+	for _, s := range sessions {
+		_, err := storage.DB.Exec(`
+			INSERT INTO runtime_sessions (token, attempt_id, course_id, version, version_id, state, created_at)
+			VALUES (?, 1, 4101, '2004', ?, ?, datetime('now', ?))
+		`, s.token, versionID, s.state, s.age)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/courses/:id/content-url", ContentURLHandler)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"no session", "/courses/4101/content-url?path=index.html", http.StatusUnauthorized},
+		{"unknown session", "/courses/4101/content-url?path=index.html&session=nope", http.StatusForbidden},
+		{"other course", "/courses/4102/content-url?path=index.html&session=live", http.StatusForbidden},
+		{"terminated session", "/courses/4101/content-url?path=index.html&session=ended", http.StatusForbidden},
+		{"old session", "/courses/4101/content-url?path=index.html&session=stale", http.StatusForbidden},
+		{"ttl above the cap", "/courses/4101/content-url?path=index.html&session=live&ttl=86400", http.StatusBadRequest},
+		{"unsafe path", "/courses/4101/content-url?path=../scorm.db&session=live", http.StatusBadRequest},
+		{"live session", "/courses/4101/content-url?path=index.html&session=live&ttl=600", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.query, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var body struct{ URL string }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.SplitN(strings.TrimPrefix(body.URL, "/packages/"), "/", 3)
+		if len(parts) != 3 || parts[0] != "content-test-key" || parts[2] != "index.html" || !validGrant(parts[0], parts[1]) {
+			t.Errorf("signed url = %q, want a valid grant for the session's package", body.URL)
+		}
+	}
+}
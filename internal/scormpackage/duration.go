@@ -0,0 +1,62 @@
+package scorm
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// As unidades de calendário das durações ISO 8601 não têm tamanho fixo;
+// como a maioria dos LMS, contamos o ano como 365 dias e o mês como 30 dias
+const (
+	durationDay   = 24 * time.Hour
+	durationMonth = 30 * durationDay
+	durationYear  = 365 * durationDay
+)
+
+// ParseDuration lê uma duração ISO 8601 como P1DT2H3M4.5S, o formato dos
+// timeinterval do SCORM 2004 e dos limites de tempo do manifesto
+func ParseDuration(value string) (time.Duration, bool) {
+	rest, ok := strings.CutPrefix(value, "P")
+	if !ok || rest == "" || strings.HasSuffix(rest, "T") {
+		return 0, false
+	}
+
+	var total float64
+	inTime := false
+	num := ""
+	for _, r := range rest {
+		switch {
+		case r == 'T' && !inTime && num == "":
+			inTime = true
+		case r >= '0' && r <= '9' || r == '.':
+			num += string(r)
+		default:
+			n, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, false
+			}
+			num = ""
+			switch {
+			case r == 'Y' && !inTime:
+				total += n * float64(durationYear)
+			case r == 'M' && !inTime:
+				total += n * float64(durationMonth)
+			case r == 'D' && !inTime:
+				total += n * float64(durationDay)
+			case r == 'H' && inTime:
+				total += n * float64(time.Hour)
+			case r == 'M' && inTime:
+				total += n * float64(time.Minute)
+			case r == 'S' && inTime:
+				total += n * float64(time.Second)
+			default:
+				return 0, false
+			}
+		}
+	}
+	if num != "" {
+		return 0, false
+	}
+	return time.Duration(total), true
+}
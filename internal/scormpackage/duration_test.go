@@ -0,0 +1,51 @@
+package scorm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"PT1H30M", 90 * time.Minute, true},
+		{"P1DT2H3M4.5S", 26*time.Hour + 3*time.Minute + 4500*time.Millisecond, true},
+		{"P1Y", 365 * 24 * time.Hour, true},
+		{"P2M", 60 * 24 * time.Hour, true},
+		{"PT0S", 0, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"P1H", 0, false},
+		{"PT1D", 0, false},
+		{"PT5", 0, false},
+		{"1H", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseDuration(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDefaultOrganization(t *testing.T) {
+	m := Manifest{Organizations: Organizations{
+		Default:      "second",
+		Organization: []Organization{{Identifier: "first"}, {Identifier: "second"}},
+	}}
+	if org, ok := m.DefaultOrganization(); !ok || org.Identifier != "second" {
+		t.Errorf("DefaultOrganization() = %q, %v; want second", org.Identifier, ok)
+	}
+
+	m.Organizations.Default = "missing"
+	if org, ok := m.DefaultOrganization(); !ok || org.Identifier != "first" {
+		t.Errorf("DefaultOrganization() with unknown default = %q, %v; want first", org.Identifier, ok)
+	}
+
+	if _, ok := (Manifest{}).DefaultOrganization(); ok {
+		t.Error("DefaultOrganization() found an organization in an empty manifest")
+	}
+}
@@ -1,15 +1,19 @@
 package scorm
 
 import (
+	"database/sql"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/jung-kurt/gofpdf"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/guilherme-gatti/poc_scorm/internal/storage"
 )
 
@@ -29,7 +33,9 @@ func UploadHandler(c *gin.Context) {
 		return
 	}
 
-	filePath := "./storage/" + file.Filename
+	// cada envio ganha um nome próprio, então dois arquivos com o mesmo
+	// nome não se sobrescrevem
+	filePath := filepath.Join(incomingDir, uuid.New().String()+".zip")
 
 	err = c.SaveUploadedFile(file, filePath)
 	if err != nil {
@@ -39,16 +45,22 @@ func UploadHandler(c *gin.Context) {
 		return
 	}
 
-	err = ProcessScormPackage(filePath)
+	// a importação roda em segundo plano; o andamento é consultado em
+	// GET /imports/:id
+	job, err := enqueueImport(filepath.Base(file.Filename), filePath)
 	if err != nil {
+		// sem job ninguém mais apaga o zip
+		os.Remove(filePath)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status": "uploaded and processed",
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":    job.Status,
+		"jobId":     job.ID,
+		"statusUrl": fmt.Sprintf("/imports/%d", job.ID),
 	})
 }
 
@@ -111,8 +123,9 @@ func GetCourseValidatedHandler(c *gin.Context) {
 func ListCoursesHandler(c *gin.Context) {
 	// Query simples sem a coluna digital_course_json por enquanto
 	rows, err := storage.DB.Query(`
-		SELECT id, identifier, version, path
-		FROM courses
+		SELECT c.id, c.identifier, c.version, c.storage_key, COALESCE(v.number, 0)
+		FROM courses c
+		LEFT JOIN course_versions v ON v.id = c.version_id
 	`)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -124,10 +137,10 @@ func ListCoursesHandler(c *gin.Context) {
 
 	var courses []gin.H
 	for rows.Next() {
-		var id int
-		var identifier, version, path string
+		var id, currentVersion int
+		var identifier, version, storageKey string
 
-		err := rows.Scan(&id, &identifier, &version, &path)
+		err := rows.Scan(&id, &identifier, &version, &storageKey, &currentVersion)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Erro ao processar dados",
@@ -139,7 +152,8 @@ func ListCoursesHandler(c *gin.Context) {
 			"id":                 id,
 			"identifier":         identifier,
 			"version":            version,
-			"path":               path,
+			"storage_key":        storageKey,
+			"current_version":    currentVersion,
 			"has_validated_data": false, // Por enquanto sempre false
 		})
 	}
@@ -153,12 +167,12 @@ func ListCoursesHandler(c *gin.Context) {
 func ValidateExistingCourseHandler(c *gin.Context) {
 	courseID := c.Param("id")
 
-	var manifestJSON, path string
+	var manifestJSON string
 	err := storage.DB.QueryRow(`
-		SELECT manifest_json, path 
+		SELECT manifest_json
 		FROM courses 
 		WHERE id = ?
-	`, courseID).Scan(&manifestJSON, &path)
+	`, courseID).Scan(&manifestJSON)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
@@ -228,34 +242,75 @@ func ValidateExistingCourseHandler(c *gin.Context) {
 func DeleteCourseHandler(c *gin.Context) {
 	courseID := c.Param("id")
 
-	var path string
-	err := storage.DB.QueryRow(`SELECT path FROM courses WHERE id = ?`, courseID).Scan(&path)
+	var exists bool
+	err := storage.DB.QueryRow(`SELECT 1 FROM courses WHERE id = ?`, courseID).Scan(&exists)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Curso não encontrado"})
 		return
 	}
 
-	_, err = storage.DB.Exec(`DELETE FROM progress WHERE course_id = ?`, courseID)
+	// o conteúdo só é apagado se nenhum outro curso usa o mesmo pacote
+	packagesMu.Lock()
+	defer packagesMu.Unlock()
+
+	storageKeys, err := courseStorageKeys(courseID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover progressos"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar versões do curso"})
 		return
 	}
 
-	_, err = storage.DB.Exec(`DELETE FROM courses WHERE id = ?`, courseID)
+	tx, err := storage.DB.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover curso"})
 		return
 	}
+	defer tx.Rollback()
 
-	err = os.RemoveAll(path)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover arquivos"})
+	if err := deleteCourse(tx, courseID); err != nil {
+		log.Printf("scorm: erro ao remover o curso %s: %v", courseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover curso"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover curso"})
 		return
 	}
 
+	for _, key := range storageKeys {
+		if err := releasePackage(key); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover arquivos"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"status": "Curso removido"})
 }
 
+// deleteCourse apaga o curso com as versões, os itens e tudo o que os
+// alunos gravaram nele: matrículas, tentativas com interações e objetivos,
+// sessões de runtime, estado de sequenciamento, progresso e rollups
+func deleteCourse(tx *sql.Tx, courseID string) error {
+	statements := []string{
+		`DELETE FROM interactions WHERE attempt_id IN (SELECT id FROM attempts WHERE course_id = ?)`,
+		`DELETE FROM objectives WHERE attempt_id IN (SELECT id FROM attempts WHERE course_id = ?)`,
+		`DELETE FROM runtime_sessions WHERE course_id = ?1 OR attempt_id IN (SELECT id FROM attempts WHERE course_id = ?1)`,
+		`DELETE FROM attempts WHERE course_id = ?`,
+		`DELETE FROM sequencing_state WHERE registration_id IN (SELECT id FROM registrations WHERE course_id = ?)`,
+		`DELETE FROM course_rollups WHERE course_id = ?`,
+		`DELETE FROM registrations WHERE course_id = ?`,
+		`DELETE FROM progress WHERE course_id = ?`,
+		`DELETE FROM course_items WHERE course_id = ?`,
+		`DELETE FROM course_versions WHERE course_id = ?`,
+		`DELETE FROM courses WHERE id = ?`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, courseID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // TrackHandler recebe tracking SCORM multi-SCO
 func TrackHandler(c *gin.Context) {
 	var payload struct {
@@ -271,8 +326,12 @@ func TrackHandler(c *gin.Context) {
 		return
 	}
 
+	// o mesmo identifier é um só curso, com várias versões; bancos anteriores
+	// ao versionamento podem ter cópias, e vale a mais recente
 	var courseID int
-	err := storage.DB.QueryRow(`SELECT id FROM courses WHERE identifier = ?`, payload.ScormID).Scan(&courseID)
+	err := storage.DB.QueryRow(`
+		SELECT id FROM courses WHERE identifier = ? ORDER BY id DESC LIMIT 1
+	`, payload.ScormID).Scan(&courseID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Curso não encontrado"})
 		return
@@ -299,7 +358,8 @@ func ProgressHandler(c *gin.Context) {
 	userID := c.Param("userId")
 
 	rows, err := storage.DB.Query(`
-		SELECT p.id, p.course_id, c.identifier, p.status, p.score, p.updated_at
+		SELECT p.id, p.course_id, c.identifier, COALESCE(p.sco_id, ''), p.status, p.score,
+		       COALESCE(p.total_time, ''), p.updated_at
 		FROM progress p
 		JOIN courses c ON p.course_id = c.id
 		WHERE p.user_id = ?
@@ -313,24 +373,72 @@ func ProgressHandler(c *gin.Context) {
 	var result []gin.H
 	for rows.Next() {
 		var id, courseID, score int
-		var identifier, status, updatedAt string
+		var identifier, scoID, status, totalTime, updatedAt string
 
-		if err := rows.Scan(&id, &courseID, &identifier, &status, &score, &updatedAt); err != nil {
+		if err := rows.Scan(&id, &courseID, &identifier, &scoID, &status, &score, &totalTime, &updatedAt); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar linhas"})
 			return
 		}
 
 		result = append(result, gin.H{
-			"id":        id,
+			"id":         id,
+			"course_id":  courseID,
+			"scorm_id":   identifier,
+			"sco_id":     scoID,
+			"status":     status,
+			"score":      score,
+			"total_time": totalTime,
+			"updatedAt":  updatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// SeatTimeHandler soma o tempo total das tentativas do usuário por curso e SCO
+func SeatTimeHandler(c *gin.Context) {
+	userID := c.Param("userId")
+
+	rows, err := storage.DB.Query(`
+		SELECT a.course_id, c.identifier, a.sco_id, COUNT(*), SUM(a.total_seconds)
+		FROM attempts a
+		JOIN courses c ON a.course_id = c.id
+		WHERE a.user_id = ?
+		GROUP BY a.course_id, a.sco_id
+		ORDER BY a.course_id, a.sco_id
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar tempo de estudo"})
+		return
+	}
+	defer rows.Close()
+
+	result := []gin.H{}
+	var total float64
+	for rows.Next() {
+		var courseID, attempts int
+		var identifier, scoID string
+		var seconds float64
+
+		if err := rows.Scan(&courseID, &identifier, &scoID, &attempts, &seconds); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar linhas"})
+			return
+		}
+		total += seconds
+
+		result = append(result, gin.H{
 			"course_id": courseID,
 			"scorm_id":  identifier,
-			"status":    status,
-			"score":     score,
-			"updatedAt": updatedAt,
+			"sco_id":    scoID,
+			"attempts":  attempts,
+			"seconds":   seconds,
 		})
 	}
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, gin.H{
+		"items":         result,
+		"total_seconds": total,
+	})
 }
 
 // CSV
@@ -338,7 +446,7 @@ func ExportCSVHandler(c *gin.Context) {
 	userID := c.Param("userId")
 
 	rows, err := storage.DB.Query(`
-		SELECT c.identifier, p.sco_id, p.status, p.score, p.updated_at
+		SELECT c.identifier, COALESCE(p.sco_id, ''), p.status, p.score, COALESCE(p.total_time, ''), p.updated_at
 		FROM progress p JOIN courses c ON p.course_id = c.id
 		WHERE p.user_id = ?`, userID)
 	if err != nil {
@@ -353,12 +461,12 @@ func ExportCSVHandler(c *gin.Context) {
 	w := csv.NewWriter(c.Writer)
 	defer w.Flush()
 
-	w.Write([]string{"Course", "SCO", "Status", "Score", "UpdatedAt"})
+	w.Write([]string{"Course", "SCO", "Status", "Score", "TotalTime", "UpdatedAt"})
 	for rows.Next() {
-		var id, sco, status, updated string
+		var id, sco, status, totalTime, updated string
 		var score int
-		rows.Scan(&id, &sco, &status, &score, &updated)
-		w.Write([]string{id, sco, status, fmt.Sprint(score), updated})
+		rows.Scan(&id, &sco, &status, &score, &totalTime, &updated)
+		w.Write([]string{id, sco, status, fmt.Sprint(score), totalTime, updated})
 	}
 }
 
@@ -367,7 +475,7 @@ func ExportPDFHandler(c *gin.Context) {
 	userID := c.Param("userId")
 
 	rows, err := storage.DB.Query(`
-		SELECT c.identifier, p.sco_id, p.status, p.score, p.updated_at
+		SELECT c.identifier, COALESCE(p.sco_id, ''), p.status, p.score, COALESCE(p.total_time, ''), p.updated_at
 		FROM progress p JOIN courses c ON p.course_id = c.id
 		WHERE p.user_id = ?`, userID)
 	if err != nil {
@@ -384,10 +492,10 @@ func ExportPDFHandler(c *gin.Context) {
 	pdf.Ln(12)
 	pdf.SetFont("Arial", "", 12)
 	for rows.Next() {
-		var id, sco, status, updated string
+		var id, sco, status, totalTime, updated string
 		var score int
-		rows.Scan(&id, &sco, &status, &score, &updated)
-		line := fmt.Sprintf("%s - %s - %s - %d - %s", id, sco, status, score, updated)
+		rows.Scan(&id, &sco, &status, &score, &totalTime, &updated)
+		line := fmt.Sprintf("%s - %s - %s - %d - %s - %s", id, sco, status, score, totalTime, updated)
 		pdf.Cell(0, 10, line)
 		pdf.Ln(8)
 	}
@@ -399,3 +507,33 @@ func ExportPDFHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao exportar PDF"})
 	}
 }
+
+// AttemptLimitRequest é o corpo de PUT /courses/:id/attempt-limit
+type AttemptLimitRequest struct {
+	AttemptLimit *int `json:"attemptLimit"`
+}
+
+// UpdateAttemptLimitHandler define quantas tentativas cada aluno pode fazer
+// em cada SCO do curso (0 = ilimitado). Itens com imsss:limitConditions
+// attemptLimit no manifesto mantêm o limite do manifesto.
+func UpdateAttemptLimitHandler(c *gin.Context) {
+	courseID := c.Param("id")
+
+	var req AttemptLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.AttemptLimit == nil || *req.AttemptLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "attemptLimit deve ser um inteiro maior ou igual a zero"})
+		return
+	}
+
+	res, err := storage.DB.Exec(`UPDATE courses SET attempt_limit = ? WHERE id = ?`, *req.AttemptLimit, courseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar limite de tentativas"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Curso não encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"course_id": courseID, "attempt_limit": *req.AttemptLimit})
+}
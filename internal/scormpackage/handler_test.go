@@ -0,0 +1,154 @@
+package scorm
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// seedCourseData grava um curso com uma matrícula e tudo o que o runtime
+// grava para ela, e retorna a matrícula e a tentativa
+func seedCourseData(t *testing.T, courseID int64) (int64, int64) {
+	t.Helper()
+	exec := func(query string, args ...any) int64 {
+		t.Helper()
+		res, err := storage.DB.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		return id
+	}
+
+	exec(`INSERT INTO courses (id, identifier, version, manifest_json, storage_key) VALUES (?, 'c', '2004', '{}', ?)`, courseID, "delete-test-"+strconv.FormatInt(courseID, 10))
+	exec(`INSERT INTO course_versions (course_id, number, manifest_json, storage_key) VALUES (?, 1, '{}', ?)`, courseID, "delete-test-"+strconv.FormatInt(courseID, 10))
+	exec(`INSERT INTO course_items (course_id, organization, identifier, title) VALUES (?, 'org', 'item', 'Item')`, courseID)
+	regID := exec(`INSERT INTO registrations (user_id, course_id) VALUES (1, ?)`, courseID)
+	attemptID := exec(`INSERT INTO attempts (registration_id, user_id, course_id, sco_id) VALUES (?, 1, ?, 'sco')`, regID, courseID)
+	exec(`INSERT INTO interactions (attempt_id, idx, interaction_id) VALUES (?, 0, 'q1')`, attemptID)
+	exec(`INSERT INTO objectives (attempt_id, idx, objective_id) VALUES (?, 0, 'obj')`, attemptID)
+	exec(`INSERT INTO runtime_sessions (token, attempt_id, course_id, version) VALUES (?, ?, ?, '2004')`, "delete-test-"+strconv.FormatInt(attemptID, 10), attemptID, courseID)
+	exec(`INSERT INTO sequencing_state (registration_id, state_json) VALUES (?, '{}')`, regID)
+	exec(`INSERT INTO course_rollups (registration_id, user_id, course_id, completion_status, success_status, activities_json) VALUES (?, 1, ?, 'unknown', 'unknown', '[]')`, regID, courseID)
+	exec(`INSERT INTO progress (user_id, course_id, status) VALUES (1, ?, 'incomplete')`, courseID)
+	return regID, attemptID
+}
+
+// courseRows conta as linhas que ainda referenciam o curso, a matrícula ou a
+// tentativa em cada tabela
+func courseRows(t *testing.T, courseID, regID, attemptID int64) map[string]int {
+	t.Helper()
+	queries := map[string]string{
+		"courses":          `SELECT COUNT(*) FROM courses WHERE id = ?1`,
+		"course_versions":  `SELECT COUNT(*) FROM course_versions WHERE course_id = ?1`,
+		"course_items":     `SELECT COUNT(*) FROM course_items WHERE course_id = ?1`,
+		"registrations":    `SELECT COUNT(*) FROM registrations WHERE id = ?3`,
+		"attempts":         `SELECT COUNT(*) FROM attempts WHERE id = ?2`,
+		"interactions":     `SELECT COUNT(*) FROM interactions WHERE attempt_id = ?2`,
+		"objectives":       `SELECT COUNT(*) FROM objectives WHERE attempt_id = ?2`,
+		"runtime_sessions": `SELECT COUNT(*) FROM runtime_sessions WHERE attempt_id = ?2`,
+		"sequencing_state": `SELECT COUNT(*) FROM sequencing_state WHERE registration_id = ?3`,
+		"course_rollups":   `SELECT COUNT(*) FROM course_rollups WHERE registration_id = ?3`,
+		"progress":         `SELECT COUNT(*) FROM progress WHERE course_id = ?1`,
+	}
+	counts := map[string]int{}
+	for table, query := range queries {
+		var n int
+		if err := storage.DB.QueryRow(query, courseID, attemptID, regID).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		counts[table] = n
+	}
+	return counts
+}
+
+func TestDeleteCourseRemovesLearnerData(t *testing.T) {
+	regID, attemptID := seedCourseData(t, 5101)
+	otherRegID, otherAttemptID := seedCourseData(t, 5102)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.DELETE("/courses/:id", DeleteCourseHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/courses/5101", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", w.Code, w.Body)
+	}
+
+	for table, n := range courseRows(t, 5101, regID, attemptID) {
+		if n != 0 {
+			t.Errorf("%s keeps %d rows of the deleted course", table, n)
+		}
+	}
+	for table, n := range courseRows(t, 5102, otherRegID, otherAttemptID) {
+		if n == 0 {
+			t.Errorf("%s lost the rows of another course", table)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/courses/5101", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want 404", w.Code)
+	}
+}
+
+// withoutImportJobs faz enqueueImport falhar enquanto o teste roda
+func withoutImportJobs(t *testing.T) {
+	t.Helper()
+	if _, err := storage.DB.Exec(`ALTER TABLE import_jobs RENAME TO import_jobs_off`); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := storage.DB.Exec(`ALTER TABLE import_jobs_off RENAME TO import_jobs`); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// incomingZips lista os zips que aguardam importação
+func incomingZips(t *testing.T) []string {
+	t.Helper()
+	zips, err := filepath.Glob(filepath.Join(incomingDir, "*.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zips
+}
+
+func TestUploadRemovesZipWhenEnqueueFails(t *testing.T) {
+	before := len(incomingZips(t))
+	withoutImportJobs(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "course.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("zip"))
+	form.Close()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/upload", UploadHandler)
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 (%s)", w.Code, w.Body)
+	}
+	if after := len(incomingZips(t)); after != before {
+		t.Errorf("%d zips left in %s, want %d", after, incomingDir, before)
+	}
+}
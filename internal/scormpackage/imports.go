@@ -0,0 +1,337 @@
+package scorm
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// Etapas de uma importação, na ordem em que acontecem
+const (
+	StageStored         = "stored"
+	StageExtracted      = "extracted"
+	StageManifestParsed = "manifest_parsed"
+	StageValidated      = "validated"
+	StagePublished      = "published"
+)
+
+// Situações de um job de importação
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportSucceeded = "succeeded"
+	ImportFailed    = "failed"
+)
+
+// ImportJob é a importação de um pacote enviado. Stage é a última etapa
+// concluída e Stages o histórico delas; Rule é a regra de segurança violada
+// quando o pacote foi rejeitado ao descompactar.
+type ImportJob struct {
+	ID       int64         `json:"id"`
+	Filename string        `json:"filename"`
+	Status   string        `json:"status"`
+	Stage    string        `json:"stage"`
+	Stages   []ImportStage `json:"stages"`
+	Warnings []string      `json:"warnings"`
+	Error    string        `json:"error,omitempty"`
+	Rule     string        `json:"rule,omitempty"`
+	CourseID *int64        `json:"courseId"`
+	// Version é o número da versão do curso publicada pela importação
+	Version *int64 `json:"version,omitempty"`
+	// StorageKey é o SHA-256 do zip, que identifica o conteúdo armazenado
+	StorageKey string `json:"storageKey,omitempty"`
+	// Lint é o relatório de validação do manifesto
+	Lint      *LintReport `json:"lint,omitempty"`
+	CreatedAt string      `json:"createdAt"`
+	UpdatedAt string      `json:"updatedAt"`
+
+	zipPath string
+}
+
+// ImportStage registra quando uma etapa foi concluída
+type ImportStage struct {
+	Stage string `json:"stage"`
+	At    string `json:"at"`
+}
+
+// Importer processa em segundo plano os jobs de importação gravados no
+// banco. Os workers são acordados por notify e pegam os jobs na ordem em que
+// foram criados, então jobs que não couberam na fila ou que estavam em
+// andamento quando o servidor parou não se perdem.
+type Importer struct {
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+// NewImporter cria um Importer sem workers; use Start para iniciá-los
+func NewImporter() *Importer {
+	return &Importer{wake: make(chan struct{}, 1)}
+}
+
+var defaultImporter = NewImporter()
+
+// StartImportWorkers inicia n workers de importação
+func StartImportWorkers(n int) {
+	defaultImporter.Start(n)
+}
+
+// Start devolve para a fila os jobs interrompidos por uma parada do servidor
+// e inicia n workers
+func (i *Importer) Start(n int) {
+	_, err := storage.DB.Exec(`
+		UPDATE import_jobs SET status = ?, updated_at = ? WHERE status = ?
+	`, ImportQueued, now(), ImportRunning)
+	if err != nil {
+		log.Printf("scorm: erro ao retomar importações interrompidas: %v", err)
+	}
+
+	for range n {
+		go i.work()
+	}
+	i.notify()
+}
+
+// notify acorda um worker parado, se houver
+func (i *Importer) notify() {
+	select {
+	case i.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (i *Importer) work() {
+	for range i.wake {
+		for {
+			job, err := i.claim()
+			if err != nil {
+				if err != sql.ErrNoRows {
+					log.Printf("scorm: erro ao buscar importação na fila: %v", err)
+				}
+				break
+			}
+			// pode haver mais jobs na fila para outro worker
+			i.notify()
+			i.run(job)
+		}
+	}
+}
+
+// claim marca o job mais antigo da fila como em andamento e o retorna
+func (i *Importer) claim() (*ImportJob, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var id int64
+	err := storage.DB.QueryRow(`
+		SELECT id FROM import_jobs WHERE status = ? ORDER BY id LIMIT 1
+	`, ImportQueued).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := loadImportJob(id)
+	if err != nil {
+		return nil, err
+	}
+	job.Status = ImportRunning
+	return job, saveImportJob(job)
+}
+
+// run processa um job, registrando cada etapa concluída
+func (i *Importer) run(job *ImportJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			i.fail(job, fmt.Errorf("erro inesperado: %v", r))
+		}
+	}()
+
+	// o conteúdo fica no armazenamento; o zip enviado não é mais necessário
+	defer os.Remove(job.zipPath)
+
+	result, err := ProcessScormPackage(job.zipPath, func(stage string) {
+		job.advance(stage)
+		if err := saveImportJob(job); err != nil {
+			log.Printf("scorm: erro ao salvar importação %d: %v", job.ID, err)
+		}
+	})
+	if err != nil {
+		i.fail(job, err)
+		return
+	}
+
+	for _, sub := range result.SubManifests {
+		job.Warnings = append(job.Warnings, fmt.Sprintf("manifesto em subpasta não importado: %s", sub))
+	}
+	job.Status = ImportSucceeded
+	job.CourseID = &result.CourseID
+	version := int64(result.Version)
+	job.Version = &version
+	job.StorageKey = result.StorageKey
+	job.Lint = result.Lint
+	if err := saveImportJob(job); err != nil {
+		log.Printf("scorm: erro ao salvar importação %d: %v", job.ID, err)
+	}
+}
+
+func (i *Importer) fail(job *ImportJob, err error) {
+	job.Status = ImportFailed
+	job.Error = err.Error()
+	var unzipErr *UnzipError
+	if errors.As(err, &unzipErr) {
+		job.Rule = unzipErr.Rule
+	}
+	var lintErr *ManifestLintError
+	if errors.As(err, &lintErr) {
+		job.Rule = lintErr.Rule
+		job.Lint = lintErr.Report
+	}
+	if err := saveImportJob(job); err != nil {
+		log.Printf("scorm: erro ao salvar importação %d: %v", job.ID, err)
+	}
+}
+
+func (job *ImportJob) advance(stage string) {
+	job.Stage = stage
+	job.Stages = append(job.Stages, ImportStage{Stage: stage, At: now()})
+}
+
+// enqueueImport cria o job de um pacote já gravado em zipPath e acorda os
+// workers. O zip é removido quando a importação termina.
+func enqueueImport(filename, zipPath string) (*ImportJob, error) {
+	job, err := insertImportJob(storage.DB, filename, zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defaultImporter.notify()
+	return job, nil
+}
+
+// execer é o que insertImportJob usa do banco: *sql.DB ou uma *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertImportJob grava o job de um pacote sem acordar os workers, para quem
+// cria o job dentro de uma transação chamar notify depois do commit
+func insertImportJob(db execer, filename, zipPath string) (*ImportJob, error) {
+	job := &ImportJob{
+		Filename:  filename,
+		Status:    ImportQueued,
+		Warnings:  []string{},
+		CreatedAt: now(),
+		zipPath:   zipPath,
+	}
+	job.advance(StageStored)
+
+	stagesJSON, err := json.Marshal(job.Stages)
+	if err != nil {
+		return nil, err
+	}
+	res, err := db.Exec(`
+		INSERT INTO import_jobs (filename, zip_path, status, stage, stages_json, warnings_json, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, '[]', ?, ?)
+	`, job.Filename, job.zipPath, job.Status, job.Stage, stagesJSON, job.CreatedAt, job.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	job.UpdatedAt = job.CreatedAt
+	return job, nil
+}
+
+func saveImportJob(job *ImportJob) error {
+	stagesJSON, err := json.Marshal(job.Stages)
+	if err != nil {
+		return err
+	}
+	warningsJSON, err := json.Marshal(job.Warnings)
+	if err != nil {
+		return err
+	}
+	lintJSON := []byte{}
+	if job.Lint != nil {
+		if lintJSON, err = json.Marshal(job.Lint); err != nil {
+			return err
+		}
+	}
+
+	job.UpdatedAt = now()
+	_, err = storage.DB.Exec(`
+		UPDATE import_jobs
+		SET status = ?, stage = ?, stages_json = ?, warnings_json = ?, error = ?, rule = ?, course_id = ?, course_version = ?, storage_key = ?, lint_json = ?, updated_at = ?
+		WHERE id = ?
+	`, job.Status, job.Stage, stagesJSON, warningsJSON, job.Error, job.Rule, job.CourseID, job.Version, job.StorageKey, lintJSON, job.UpdatedAt, job.ID)
+	return err
+}
+
+func loadImportJob(id int64) (*ImportJob, error) {
+	job := &ImportJob{ID: id}
+	var stagesJSON, warningsJSON, lintJSON string
+	var courseID, version sql.NullInt64
+	err := storage.DB.QueryRow(`
+		SELECT filename, zip_path, status, stage, stages_json, warnings_json, error, rule, course_id, course_version, storage_key, lint_json, created_at, updated_at
+		FROM import_jobs WHERE id = ?
+	`, id).Scan(&job.Filename, &job.zipPath, &job.Status, &job.Stage, &stagesJSON, &warningsJSON,
+		&job.Error, &job.Rule, &courseID, &version, &job.StorageKey, &lintJSON, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if courseID.Valid {
+		job.CourseID = &courseID.Int64
+	}
+	if version.Valid {
+		job.Version = &version.Int64
+	}
+	if err := json.Unmarshal([]byte(stagesJSON), &job.Stages); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(warningsJSON), &job.Warnings); err != nil {
+		return nil, err
+	}
+	if lintJSON != "" {
+		job.Lint = &LintReport{}
+		if err := json.Unmarshal([]byte(lintJSON), job.Lint); err != nil {
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// ImportStatusHandler retorna a situação de um job de importação
+func ImportStatusHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de importação inválido"})
+		return
+	}
+
+	job, err := loadImportJob(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Importação não encontrada"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar importação"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
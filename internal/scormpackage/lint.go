@@ -0,0 +1,1115 @@
+package scorm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Severidades dos problemas encontrados na validação do manifesto
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// Regras verificadas na validação do manifesto
+const (
+	LintRuleSyntax        = "xml_syntax"
+	LintRuleNamespace     = "namespace"
+	LintRuleSchemaVersion = "schemaversion"
+	LintRuleSchema        = "schema"
+	LintRuleDuplicateID   = "duplicate_identifier"
+	LintRuleDanglingRef   = "dangling_identifierref"
+	LintRuleScormType     = "missing_scormtype"
+	LintRuleStructure     = "structure"
+)
+
+// RuleManifestLint é a regra registrada no job de importação quando o
+// manifesto é rejeitado pela validação
+const RuleManifestLint = "manifest_lint"
+
+// Edições do SCORM reconhecidas pela validação
+const (
+	EditionSCORM12     = "SCORM 1.2"
+	EditionSCORM2004v2 = "SCORM 2004 2nd Edition"
+	EditionSCORM2004v3 = "SCORM 2004 3rd Edition"
+	EditionSCORM2004v4 = "SCORM 2004 4th Edition"
+)
+
+// Namespaces dos esquemas do IMS CP, ADL CP, IMSSS e ADL Nav
+const (
+	nsIMSCP12   = "http://www.imsproject.org/xsd/imscp_rootv1p1p2"
+	nsADLCP12   = "http://www.adlnet.org/xsd/adlcp_rootv1p2"
+	nsIMSCP2004 = "http://www.imsglobal.org/xsd/imscp_v1p1"
+	nsADLCP2004 = "http://www.adlnet.org/xsd/adlcp_v1p3"
+	nsIMSSS     = "http://www.imsglobal.org/xsd/imsss"
+	nsADLSeq    = "http://www.adlnet.org/xsd/adlseq_v1p3"
+	nsADLNav    = "http://www.adlnet.org/xsd/adlnav_v1p3"
+	nsXML       = "http://www.w3.org/XML/1998/namespace"
+)
+
+const (
+	family12   = "1.2"
+	family2004 = "2004"
+)
+
+// lintNamespaces associa cada namespace conhecido ao vocabulário usado nas
+// tabelas de elementos e à família do SCORM em que ele é válido
+var lintNamespaces = map[string]struct{ vocab, family string }{
+	nsIMSCP12:   {"imscp", family12},
+	nsADLCP12:   {"adlcp", family12},
+	nsIMSCP2004: {"imscp", family2004},
+	nsADLCP2004: {"adlcp", family2004},
+	nsIMSSS:     {"imsss", family2004},
+	nsADLSeq:    {"adlseq", family2004},
+	nsADLNav:    {"adlnav", family2004},
+}
+
+// lintVocabularies são os prefixos dos vocabulários, na ordem em que são
+// tentados para elementos sem namespace
+var lintVocabularies = []string{"imscp", "adlcp", "imsss", "adlseq", "adlnav"}
+
+// strictManifestLint faz a importação recusar manifestos com erros de
+// validação (MANIFEST_LINT=strict). Sem ela o relatório só é registrado.
+var strictManifestLint = os.Getenv("MANIFEST_LINT") == "strict"
+
+// maxManifestSize limita o manifesto enviado a LintManifestHandler
+const maxManifestSize = 10 << 20
+
+// LintIssue é um problema encontrado no manifesto. Line e Column apontam
+// para a tag do elemento em que o problema foi encontrado; problemas de um
+// arquivo do pacote sem elemento no manifesto trazem só File.
+type LintIssue struct {
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Element  string `json:"element,omitempty"`
+	File     string `json:"file,omitempty"`
+	Message  string `json:"message"`
+}
+
+// LintReport é o relatório da validação de um imsmanifest.xml. Valid é
+// falso quando há ao menos um erro; avisos não invalidam o manifesto.
+type LintReport struct {
+	Edition  string      `json:"edition"`
+	Valid    bool        `json:"valid"`
+	Errors   int         `json:"errors"`
+	Warnings int         `json:"warnings"`
+	Issues   []LintIssue `json:"issues"`
+}
+
+// ManifestLintError indica um pacote recusado pela validação. Rule é
+// RuleManifestLint quando qualquer erro recusa o pacote, ou a regra dos
+// erros que levaram à recusa.
+type ManifestLintError struct {
+	Rule   string
+	Report *LintReport
+}
+
+func (e *ManifestLintError) Error() string {
+	var first *LintIssue
+	count := 0
+	for i, issue := range e.Report.Issues {
+		if issue.Severity != LintError || e.Rule != RuleManifestLint && issue.Rule != e.Rule {
+			continue
+		}
+		if first == nil {
+			first = &e.Report.Issues[i]
+		}
+		count++
+	}
+	if first == nil {
+		return fmt.Sprintf("pacote rejeitado (%s)", e.Rule)
+	}
+	return fmt.Sprintf("pacote rejeitado (%s): %d erro(s), o primeiro na linha %d: %s", e.Rule, count, first.Line, first.Message)
+}
+
+// LintManifest valida o imsmanifest.xml contra os modelos de conteúdo do IMS
+// CP, ADL CP, IMSSS e ADL Nav da edição declarada em schemaversion (SCORM
+// 1.2 e 2004 2nd, 3rd e 4th Edition) e faz as verificações semânticas que os
+// esquemas não cobrem: identifiers duplicados, identifierref sem destino e
+// resources sem adlcp:scormtype.
+//
+// Os XSDs oficiais não são empacotados nem carregados (não há validador de
+// XML Schema na biblioteca padrão do Go): os modelos são um subconjunto
+// deles codificado à mão em lintSchema, sem acesso à rede. O que fica de
+// fora está listado no comentário de lintSchema.
+func LintManifest(data []byte) *LintReport {
+	return lintManifest(data, nil)
+}
+
+// lintManifest valida o manifesto e, quando files não é nil, confere os
+// arquivos do pacote com checkFiles
+func lintManifest(data []byte, files []string) *LintReport {
+	l := &manifestLinter{
+		report: &LintReport{Issues: []LintIssue{}},
+		warned: map[string]bool{},
+	}
+	if root := l.parse(data); root != nil && l.check(root) && files != nil {
+		l.checkFiles(root, files)
+	}
+
+	// problemas sem linha (arquivos do pacote) vão para o fim
+	sort.SliceStable(l.report.Issues, func(i, j int) bool {
+		a, b := l.report.Issues[i], l.report.Issues[j]
+		if (a.Line == 0) != (b.Line == 0) {
+			return b.Line == 0
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	l.report.Valid = l.report.Errors == 0
+	return l.report
+}
+
+// hasIssue informa se o relatório tem algum erro da regra
+func (r *LintReport) hasIssue(rule string) bool {
+	return slices.ContainsFunc(r.Issues, func(issue LintIssue) bool {
+		return issue.Severity == LintError && issue.Rule == rule
+	})
+}
+
+// LintManifestHandler valida um imsmanifest.xml sem importar o pacote
+// (POST /manifests/lint). O manifesto vai no campo manifest de um formulário
+// multipart ou direto no corpo da requisição.
+func LintManifestHandler(c *gin.Context) {
+	var body io.Reader = c.Request.Body
+	if file, err := c.FormFile("manifest"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler o manifesto"})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxManifestSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler o manifesto"})
+		return
+	}
+	if len(data) > maxManifestSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Manifesto maior que o tamanho máximo"})
+		return
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Manifesto não enviado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, LintManifest(data))
+}
+
+// lintNode é um elemento do manifesto com a posição da sua tag de abertura.
+// key é o nome qualificado pelo vocabulário ("imscp:item"), ou vazio para
+// elementos de namespaces que a validação não conhece.
+type lintNode struct {
+	name     xml.Name
+	rawAttrs []xml.Attr
+	attrs    []lintAttr
+	key      string
+	line     int
+	col      int
+	text     strings.Builder
+	parent   *lintNode
+	children []*lintNode
+}
+
+type lintAttr struct {
+	key   string
+	value string
+}
+
+func (n *lintNode) attr(key string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.key == key {
+			return strings.TrimSpace(a.value), true
+		}
+	}
+	return "", false
+}
+
+type manifestLinter struct {
+	report *LintReport
+	lines  []int
+	family string
+	specs  map[string]*elemSpec
+	warned map[string]bool
+}
+
+func (l *manifestLinter) add(severity, rule string, n *lintNode, format string, args ...any) {
+	issue := LintIssue{Severity: severity, Rule: rule, Message: fmt.Sprintf(format, args...)}
+	if n != nil {
+		issue.Line, issue.Column, issue.Element = n.line, n.col, displayName(n)
+	}
+	l.append(issue)
+}
+
+// addFile registra um problema de um arquivo do pacote
+func (l *manifestLinter) addFile(severity, rule, file, message string) {
+	l.append(LintIssue{Severity: severity, Rule: rule, File: file, Message: message})
+}
+
+func (l *manifestLinter) append(issue LintIssue) {
+	l.report.Issues = append(l.report.Issues, issue)
+	if issue.Severity == LintError {
+		l.report.Errors++
+	} else {
+		l.report.Warnings++
+	}
+}
+
+// position converte um deslocamento em bytes em linha e coluna, ambas a
+// partir de 1
+func (l *manifestLinter) position(offset int64) (int, int) {
+	i := sort.Search(len(l.lines), func(i int) bool { return int64(l.lines[i]) > offset }) - 1
+	return i + 1, int(offset) - l.lines[i] + 1
+}
+
+// parse monta a árvore de elementos. Um erro de sintaxe vira um problema do
+// relatório e interrompe a validação.
+func (l *manifestLinter) parse(data []byte) *lintNode {
+	l.lines = []int{0}
+	for i, b := range data {
+		if b == '\n' {
+			l.lines = append(l.lines, i+1)
+		}
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var root, current *lintNode
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			issue := LintIssue{Severity: LintError, Rule: LintRuleSyntax, Message: err.Error()}
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				issue.Line, issue.Message = syntaxErr.Line, syntaxErr.Msg
+			} else {
+				issue.Line, issue.Column = l.position(d.InputOffset())
+			}
+			l.append(issue)
+			return nil
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &lintNode{name: t.Name, rawAttrs: t.Attr, parent: current}
+			n.line, n.col = l.position(offset)
+			if current == nil {
+				root = n
+			} else {
+				current.children = append(current.children, n)
+			}
+			current = n
+		case xml.EndElement:
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.text.Write(t)
+			}
+		}
+	}
+
+	if root == nil {
+		l.append(LintIssue{Severity: LintError, Rule: LintRuleSyntax, Line: 1, Message: "documento vazio"})
+	}
+	return root
+}
+
+// check valida a árvore e informa se a raiz é um manifesto, o que permite
+// conferir os arquivos do pacote
+func (l *manifestLinter) check(root *lintNode) bool {
+	edition := l.detectEdition(root)
+	l.report.Edition = edition
+	l.family = family2004
+	if edition == EditionSCORM12 {
+		l.family = family12
+	}
+	l.specs = lintSchema(edition)
+
+	if root.name.Space == "" {
+		expected := nsIMSCP2004
+		if l.family == family12 {
+			expected = nsIMSCP12
+		}
+		l.add(LintWarning, LintRuleNamespace, root, "manifesto sem namespace; o IMS CP usa xmlns=%q", expected)
+	}
+	l.resolve(root)
+
+	if root.key != "imscp:manifest" {
+		l.add(LintError, LintRuleSchema, root, "o elemento raiz deve ser <manifest>, não <%s>", root.name.Local)
+		return false
+	}
+	l.validate(root, l.specs["imscp:manifest"])
+	l.checkReferences(root)
+	return true
+}
+
+// detectEdition lê a edição de metadata/schemaversion. Sem schemaversion, ou
+// com um valor desconhecido, a edição é deduzida dos namespaces usados.
+func (l *manifestLinter) detectEdition(root *lintNode) string {
+	var schemaVersion *lintNode
+	for _, child := range root.children {
+		if child.name.Local != "metadata" {
+			continue
+		}
+		for _, grandchild := range child.children {
+			if grandchild.name.Local == "schemaversion" {
+				schemaVersion = grandchild
+			}
+		}
+	}
+
+	value := ""
+	if schemaVersion != nil {
+		value = strings.TrimSpace(schemaVersion.text.String())
+		switch strings.ToLower(value) {
+		case "1.2":
+			return EditionSCORM12
+		case "cam 1.3":
+			return EditionSCORM2004v2
+		case "2004 3rd edition":
+			return EditionSCORM2004v3
+		case "2004 4th edition":
+			return EditionSCORM2004v4
+		}
+	}
+
+	edition := EditionSCORM12
+	if families := namespaceFamilies(root); families[family2004] {
+		edition = EditionSCORM2004v3
+	} else if !families[family12] && (strings.Contains(value, "2004") || strings.Contains(value, "1.3")) {
+		edition = EditionSCORM2004v3
+	}
+
+	if schemaVersion == nil {
+		l.add(LintWarning, LintRuleSchemaVersion, root, "metadata/schemaversion ausente; validado como %s", edition)
+	} else {
+		l.add(LintWarning, LintRuleSchemaVersion, schemaVersion, "schemaversion %q não reconhecido; validado como %s", value, edition)
+	}
+	return edition
+}
+
+func namespaceFamilies(n *lintNode) map[string]bool {
+	families := map[string]bool{}
+	var walk func(n *lintNode)
+	walk = func(n *lintNode) {
+		if ns, ok := lintNamespaces[n.name.Space]; ok {
+			families[ns.family] = true
+		}
+		for _, a := range n.rawAttrs {
+			if ns, ok := lintNamespaces[a.Name.Space]; ok {
+				families[ns.family] = true
+			}
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(n)
+	return families
+}
+
+// resolve preenche key e attrs dos elementos conhecidos. Elementos sem
+// namespace são procurados nos vocabulários pelo nome local, o que aceita
+// manifestos que não declaram xmlns.
+func (l *manifestLinter) resolve(n *lintNode) {
+	switch {
+	case n.name.Space == "":
+		for _, vocab := range lintVocabularies {
+			if _, ok := l.specs[vocab+":"+n.name.Local]; ok {
+				n.key = vocab + ":" + n.name.Local
+				break
+			}
+		}
+	default:
+		if vocab, ok := l.vocabulary(n, n.name.Space); ok {
+			n.key = vocab + ":" + n.name.Local
+		}
+	}
+	if n.key == "" {
+		return
+	}
+
+	for _, a := range n.rawAttrs {
+		switch {
+		case a.Name.Space == "" && a.Name.Local == "xmlns", a.Name.Space == "xmlns":
+		case a.Name.Space == "":
+			n.attrs = append(n.attrs, lintAttr{a.Name.Local, a.Value})
+		case a.Name.Space == nsXML:
+			n.attrs = append(n.attrs, lintAttr{"xml:" + a.Name.Local, a.Value})
+		default:
+			if vocab, ok := l.vocabulary(n, a.Name.Space); ok {
+				n.attrs = append(n.attrs, lintAttr{vocab + ":" + a.Name.Local, a.Value})
+			}
+		}
+	}
+
+	for _, child := range n.children {
+		l.resolve(child)
+	}
+}
+
+// vocabulary devolve o vocabulário de um namespace, avisando uma vez por
+// namespace quando ele é de outra edição ou quando o prefixo não foi
+// declarado
+func (l *manifestLinter) vocabulary(n *lintNode, space string) (string, bool) {
+	if ns, ok := lintNamespaces[space]; ok {
+		if ns.family != l.family && !l.warned[space] {
+			l.warned[space] = true
+			l.add(LintError, LintRuleNamespace, n, "o namespace %s é do SCORM %s, mas o manifesto é %s", space, ns.family, l.report.Edition)
+		}
+		return ns.vocab, true
+	}
+	if slices.Contains(lintVocabularies, space) {
+		if !l.warned[space] {
+			l.warned[space] = true
+			l.add(LintWarning, LintRuleNamespace, n, "prefixo %s usado sem declaração xmlns:%s", space, space)
+		}
+		return space, true
+	}
+	return "", false
+}
+
+// lookup devolve a regra do elemento, preferindo a específica do elemento
+// pai ("imsss:ruleAction@preConditionRule")
+func (l *manifestLinter) lookup(key, parent string) *elemSpec {
+	if spec, ok := l.specs[key+"@"+localName(parent)]; ok {
+		return spec
+	}
+	return l.specs[key]
+}
+
+// validate confere atributos, texto e filhos do elemento contra a regra do
+// esquema, recursivamente
+func (l *manifestLinter) validate(n *lintNode, spec *elemSpec) {
+	for _, a := range n.attrs {
+		check, ok := spec.attrs[a.key]
+		if !ok {
+			l.add(LintError, LintRuleSchema, n, "atributo %s não permitido em <%s>", a.key, displayName(n))
+			continue
+		}
+		if problem := check(strings.TrimSpace(a.value)); problem != "" {
+			l.add(LintError, LintRuleSchema, n, "valor %q inválido no atributo %s: %s", a.value, a.key, problem)
+		}
+	}
+	for _, required := range spec.required {
+		if _, ok := n.attr(required); !ok {
+			l.add(LintError, LintRuleSchema, n, "<%s> exige o atributo %s", displayName(n), required)
+		}
+	}
+
+	if spec.text != nil {
+		value := strings.TrimSpace(n.text.String())
+		if problem := spec.text(value); problem != "" {
+			l.add(LintError, LintRuleSchema, n, "valor %q inválido em <%s>: %s", value, displayName(n), problem)
+		}
+	}
+	if spec.skip {
+		return
+	}
+
+	counts := make([]int, len(spec.children))
+	lastSlot := -1
+	var last *lintNode
+	for _, child := range n.children {
+		if child.key == "" {
+			if !spec.open {
+				l.add(LintWarning, LintRuleSchema, child, "elemento <%s> de namespace desconhecido ignorado em <%s>", child.name.Local, displayName(n))
+			}
+			continue
+		}
+
+		i := spec.childIndex(child.key)
+		if i < 0 {
+			l.add(LintError, LintRuleSchema, child, "elemento <%s> não permitido em <%s>", displayName(child), displayName(n))
+			continue
+		}
+		counts[i]++
+		if rule := spec.children[i]; rule.max >= 0 && counts[i] > rule.max {
+			l.add(LintError, LintRuleSchema, child, "<%s> aparece mais de %d vez(es) em <%s>", displayName(child), rule.max, displayName(n))
+		}
+		if spec.slots[i] < lastSlot {
+			l.add(LintError, LintRuleSchema, child, "<%s> fora de ordem em <%s>: deve vir antes de <%s>", displayName(child), displayName(n), displayName(last))
+		} else {
+			lastSlot, last = spec.slots[i], child
+		}
+
+		if childSpec := l.lookup(child.key, n.key); childSpec != nil {
+			l.validate(child, childSpec)
+		}
+	}
+
+	for i, rule := range spec.children {
+		if counts[i] < rule.min {
+			l.add(LintError, LintRuleSchema, n, "<%s> exige ao menos %d <%s>", displayName(n), rule.min, displayKey(rule.key))
+		}
+	}
+}
+
+// checkReferences faz as verificações que os esquemas não expressam:
+// identifiers únicos, identifierref e IDRef com destino e os atributos que o
+// SCORM exige em resources e itens
+func (l *manifestLinter) checkReferences(root *lintNode) {
+	identifiers := map[string]*lintNode{}
+	targets := map[string]*lintNode{}
+	organizations := map[string]bool{}
+	sequencings := map[string]bool{}
+	var orgLists, items, resources, dependencies, seqRefs []*lintNode
+
+	var walk func(n *lintNode)
+	walk = func(n *lintNode) {
+		switch n.key {
+		case "imscp:manifest", "imscp:organization", "imscp:item", "imscp:resource":
+			id, ok := n.attr("identifier")
+			if ok && id != "" {
+				if first, dup := identifiers[id]; dup {
+					l.add(LintError, LintRuleDuplicateID, n, "identifier %q duplicado; já usado na linha %d", id, first.line)
+				} else {
+					identifiers[id] = n
+				}
+			}
+			switch n.key {
+			case "imscp:manifest":
+				if n != root && ok {
+					targets[id] = n
+				}
+			case "imscp:organization":
+				organizations[id] = true
+			case "imscp:item":
+				items = append(items, n)
+			case "imscp:resource":
+				resources = append(resources, n)
+				if ok {
+					if _, exists := targets[id]; !exists {
+						targets[id] = n
+					}
+				}
+			}
+		case "imscp:organizations":
+			orgLists = append(orgLists, n)
+		case "imscp:dependency":
+			dependencies = append(dependencies, n)
+		case "imsss:sequencing":
+			if id, ok := n.attr("ID"); ok && n.parent.key == "imsss:sequencingCollection" {
+				sequencings[id] = true
+			}
+			if _, ok := n.attr("IDRef"); ok {
+				seqRefs = append(seqRefs, n)
+			}
+		}
+		for _, child := range n.children {
+			if child.key != "" {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+
+	for _, n := range orgLists {
+		if def, ok := n.attr("default"); ok && !organizations[def] {
+			l.add(LintError, LintRuleDanglingRef, n, "default %q não corresponde a nenhuma organization", def)
+		}
+	}
+
+	// no SCORM 2004 só as folhas referenciam resources e toda folha precisa
+	// de um; no 1.2 os dois casos são tolerados pelos LMSs
+	structureSeverity := LintError
+	if l.family == family12 {
+		structureSeverity = LintWarning
+	}
+	for _, n := range items {
+		id, _ := n.attr("identifier")
+		ref, hasRef := n.attr("identifierref")
+		hasChildren := slices.ContainsFunc(n.children, func(c *lintNode) bool { return c.key == "imscp:item" })
+
+		if hasRef {
+			target, ok := targets[ref]
+			if !ok {
+				l.add(LintError, LintRuleDanglingRef, n, "identifierref %q do item %q não corresponde a nenhum resource", ref, id)
+			} else if href, _ := target.attr("href"); target.key == "imscp:resource" && href == "" {
+				l.add(LintError, LintRuleStructure, n, "o item %q referencia o resource %q, que não tem href", id, ref)
+			}
+		}
+		switch {
+		case hasRef && hasChildren:
+			l.add(structureSeverity, LintRuleStructure, n, "o item %q tem itens filhos e identifierref; só folhas devem referenciar resources", id)
+		case !hasRef && !hasChildren:
+			l.add(structureSeverity, LintRuleStructure, n, "o item folha %q não tem identifierref", id)
+		}
+	}
+
+	for _, n := range dependencies {
+		ref, _ := n.attr("identifierref")
+		if target, ok := targets[ref]; ref != "" && (!ok || target.key != "imscp:resource") {
+			l.add(LintError, LintRuleDanglingRef, n, "dependency %q não corresponde a nenhum resource", ref)
+		}
+	}
+
+	scormType := "adlcp:scormType"
+	if l.family == family12 {
+		scormType = "adlcp:scormtype"
+	}
+	for _, n := range resources {
+		id, _ := n.attr("identifier")
+		value, ok := n.attr(scormType)
+		if !ok {
+			l.add(LintError, LintRuleScormType, n, "o resource %q não tem %s (sco ou asset)", id, scormType)
+			continue
+		}
+		if href, _ := n.attr("href"); value == "sco" && href == "" {
+			l.add(LintError, LintRuleStructure, n, "o resource SCO %q não tem href", id)
+		}
+	}
+
+	for _, n := range seqRefs {
+		ref, _ := n.attr("IDRef")
+		if !sequencings[ref] {
+			l.add(LintError, LintRuleDanglingRef, n, "IDRef %q não corresponde a nenhum sequencing de sequencingCollection", ref)
+		}
+	}
+}
+
+func localName(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[i+1:]
+	}
+	return key
+}
+
+// displayKey mostra os elementos do IMS CP sem prefixo, como aparecem nos
+// manifestos, e os demais com o prefixo usual do vocabulário
+func displayKey(key string) string {
+	if strings.HasPrefix(key, "imscp:") {
+		return localName(key)
+	}
+	return key
+}
+
+func displayName(n *lintNode) string {
+	if n.key == "" {
+		return n.name.Local
+	}
+	return displayKey(n.key)
+}
+
+// elemSpec é o modelo de conteúdo de um elemento nos esquemas
+type elemSpec struct {
+	attrs    map[string]valueCheck
+	required []string
+	children []childRule
+	// slots é a posição de cada regra na sequência; regras consecutivas
+	// marcadas com anyOrder dividem a mesma posição
+	slots []int
+	text  valueCheck
+	// open aceita elementos de outros namespaces, como o xs:any ##other
+	open bool
+	// skip não verifica o conteúdo do elemento
+	skip bool
+}
+
+type childRule struct {
+	key      string
+	min, max int
+	anyOrder bool
+}
+
+func newElemSpec(attrs map[string]valueCheck, required []string, children ...childRule) *elemSpec {
+	s := &elemSpec{attrs: attrs, required: required, children: children, slots: make([]int, len(children))}
+	for i, child := range children {
+		s.slots[i] = i
+		if i > 0 && child.anyOrder && children[i-1].anyOrder {
+			s.slots[i] = s.slots[i-1]
+		}
+	}
+	return s
+}
+
+func textSpec(check valueCheck) *elemSpec {
+	return &elemSpec{text: check}
+}
+
+func (s *elemSpec) openContent() *elemSpec {
+	s.open = true
+	return s
+}
+
+func (s *elemSpec) childIndex(key string) int {
+	for i, child := range s.children {
+		if child.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func childOne(key string) childRule      { return childRule{key: key, min: 1, max: 1} }
+func childOptional(key string) childRule { return childRule{key: key, min: 0, max: 1} }
+func childMany(key string) childRule     { return childRule{key: key, min: 0, max: -1} }
+func childSome(key string) childRule     { return childRule{key: key, min: 1, max: -1} }
+
+// extensions marca as regras como extensões (xs:any ##other do IMS CP), que
+// podem aparecer em qualquer ordem entre si
+func extensions(rules ...childRule) []childRule {
+	for i := range rules {
+		rules[i].anyOrder = true
+	}
+	return rules
+}
+
+// valueCheck devolve o problema do valor, ou "" quando ele é válido
+type valueCheck func(value string) string
+
+var (
+	isoDurationPattern  = regexp.MustCompile(`^-?P(\d+Y)?(\d+M)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+	cmiTimespanPattern  = regexp.MustCompile(`^\d{2,4}:\d{2}:\d{2}(\.\d{1,2})?$`)
+	xsDecimalPattern    = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+	sequencingTimings   = []string{"never", "once", "onEachNewAttempt"}
+	conditionOperators  = []string{"not", "noOp"}
+	conditionCombinings = []string{"all", "any"}
+	rollupRequirements  = []string{"always", "ifAttempted", "ifNotSkipped", "ifNotSuspended"}
+)
+
+func anyValue(string) string { return "" }
+
+func uriValue(v string) string {
+	if v == "" {
+		return "URI vazia"
+	}
+	return ""
+}
+
+// idValue aceita um xs:ID (NCName)
+func idValue(v string) string {
+	for i, r := range v {
+		if unicode.IsLetter(r) || r == '_' || i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return "não é um xs:ID válido"
+	}
+	if v == "" {
+		return "identificador vazio"
+	}
+	return ""
+}
+
+func boolValue(v string) string {
+	switch v {
+	case "true", "false", "1", "0":
+		return ""
+	}
+	return "esperado true ou false"
+}
+
+func nonNegativeIntValue(v string) string {
+	if n, err := strconv.Atoi(v); err != nil || n < 0 {
+		return "esperado inteiro não negativo"
+	}
+	return ""
+}
+
+func durationValue(v string) string {
+	if !isoDurationPattern.MatchString(v) || strings.HasSuffix(v, "P") || strings.HasSuffix(v, "T") {
+		return "esperada duração ISO 8601 (xs:duration)"
+	}
+	return ""
+}
+
+func timespanValue(v string) string {
+	if !cmiTimespanPattern.MatchString(v) {
+		return "esperado CMITimespan (HHHH:MM:SS.SS)"
+	}
+	return ""
+}
+
+func timeLimitActionValue(v string) string {
+	if !timeLimitActions[v] {
+		return "esperado exit,message, exit,no message, continue,message ou continue,no message"
+	}
+	return ""
+}
+
+func enumValue(values ...string) valueCheck {
+	return func(v string) string {
+		if slices.Contains(values, v) {
+			return ""
+		}
+		return "esperado um de: " + strings.Join(values, ", ")
+	}
+}
+
+// decimalValue aceita só a forma léxica de xs:decimal, sem a notação
+// exponencial, NaN ou Inf que o strconv.ParseFloat aceitaria
+func decimalValue(min, max float64) valueCheck {
+	return func(v string) string {
+		if !xsDecimalPattern.MatchString(v) {
+			return "não é um xs:decimal"
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsInf(f, 0) {
+			return "não é um xs:decimal"
+		}
+		if f < min || f > max {
+			return fmt.Sprintf("fora do intervalo [%g, %g]", min, max)
+		}
+		return ""
+	}
+}
+
+func optionalValue(check valueCheck) valueCheck {
+	return func(v string) string {
+		if v == "" {
+			return ""
+		}
+		return check(v)
+	}
+}
+
+func boolAttrs(names ...string) map[string]valueCheck {
+	attrs := map[string]valueCheck{}
+	for _, name := range names {
+		attrs[name] = boolValue
+	}
+	return attrs
+}
+
+// lintSchema monta as regras dos elementos da edição, seguindo os esquemas
+// do IMS CP 1.1.2/1.1.4, ADL CP, IMSSS, ADL Seq e ADL Nav publicados pela
+// ADL. Nas sequências com xs:any ##other, as extensões do SCORM podem vir em
+// qualquer ordem depois dos elementos do IMS CP. Regras com "@pai" valem só
+// dentro daquele pai.
+//
+// As regras cobrem os elementos permitidos em cada pai, a ordem e a
+// cardinalidade deles, os atributos permitidos e obrigatórios e os valores
+// dos tipos enumerados, booleanos, inteiros, decimais com intervalo, xs:ID e
+// durações. Restrições dos XSDs que não são verificadas:
+//   - o conteúdo de metadata além de schema, schemaversion e adlcp:location
+//     (o IEEE LOM não é validado) e o de imsss:auxiliaryResources;
+//   - elementos e atributos de namespaces desconhecidos (xs:any ##other e
+//     xs:anyAttribute), que só geram aviso ou são ignorados, como
+//     xsi:schemaLocation;
+//   - xs:anyURI (só é recusada a URI vazia), xs:dateTime de beginTimeLimit e
+//     endTimeLimit e os xs:string livres (title, version, structure,
+//     parameters, objectiveID, targetObjectiveID, referencedObjective);
+//   - os limites de tamanho (xs:maxLength) dos tipos string;
+//   - as restrições de identidade (xs:key, xs:keyref e xs:unique), que
+//     checkReferences substitui para identifier, identifierref e IDRef.
+func lintSchema(edition string) map[string]*elemSpec {
+	v12 := edition == EditionSCORM12
+	v2 := edition == EditionSCORM2004v2
+	v4 := edition == EditionSCORM2004v4
+	s := map[string]*elemSpec{}
+
+	// IMS Content Packaging
+	manifest := []childRule{childOptional("imscp:metadata"), childOne("imscp:organizations"), childOne("imscp:resources"), childMany("imscp:manifest")}
+	if !v12 {
+		manifest = append(manifest, extensions(childOptional("imsss:sequencingCollection"))...)
+	}
+	s["imscp:manifest"] = newElemSpec(map[string]valueCheck{
+		"identifier": idValue, "version": anyValue, "xml:base": uriValue,
+	}, []string{"identifier"}, manifest...).openContent()
+	s["imscp:metadata"] = newElemSpec(nil, nil, append([]childRule{
+		childOptional("imscp:schema"), childOptional("imscp:schemaversion"),
+	}, extensions(childMany("adlcp:location"))...)...).openContent()
+	s["imscp:schema"] = textSpec(anyValue)
+	s["imscp:schemaversion"] = textSpec(anyValue)
+	s["imscp:title"] = textSpec(anyValue)
+	s["imscp:organizations"] = newElemSpec(map[string]valueCheck{"default": idValue}, nil,
+		childMany("imscp:organization")).openContent()
+
+	orgAttrs := map[string]valueCheck{"identifier": idValue, "structure": anyValue}
+	org := []childRule{childOne("imscp:title"), childSome("imscp:item"), childOptional("imscp:metadata")}
+	itemAttrs := map[string]valueCheck{"identifier": idValue, "identifierref": idValue, "isvisible": boolValue, "parameters": anyValue}
+	item := []childRule{childOne("imscp:title"), childMany("imscp:item"), childOptional("imscp:metadata")}
+	resourceAttrs := map[string]valueCheck{"identifier": idValue, "type": anyValue, "href": uriValue, "xml:base": uriValue}
+	if v12 {
+		item = append(item, extensions(
+			childOptional("adlcp:prerequisites"), childOptional("adlcp:maxtimeallowed"), childOptional("adlcp:timelimitaction"),
+			childOptional("adlcp:datafromlms"), childOptional("adlcp:masteryscore"))...)
+		resourceAttrs["adlcp:scormtype"] = enumValue("sco", "asset")
+	} else {
+		orgAttrs["adlseq:objectivesGlobalToSystem"] = boolValue
+		org = append(org, extensions(childOptional("imsss:sequencing"))...)
+		ext := []childRule{childOptional("adlcp:timeLimitAction"), childOptional("adlcp:dataFromLMS")}
+		if !v2 {
+			ext = append(ext, childOptional("adlcp:completionThreshold"))
+		}
+		ext = append(ext, childOptional("imsss:sequencing"), childOptional("adlnav:presentation"))
+		if v4 {
+			orgAttrs["adlcp:sharedDataGlobalToSystem"] = boolValue
+			ext = append(ext, childOptional("adlcp:data"))
+		}
+		item = append(item, extensions(ext...)...)
+		resourceAttrs["adlcp:scormType"] = enumValue("sco", "asset")
+	}
+	s["imscp:organization"] = newElemSpec(orgAttrs, []string{"identifier"}, org...).openContent()
+	s["imscp:item"] = newElemSpec(itemAttrs, []string{"identifier"}, item...).openContent()
+	s["imscp:resources"] = newElemSpec(map[string]valueCheck{"xml:base": uriValue}, nil,
+		childMany("imscp:resource")).openContent()
+	s["imscp:resource"] = newElemSpec(resourceAttrs, []string{"identifier", "type"},
+		childOptional("imscp:metadata"), childMany("imscp:file"), childMany("imscp:dependency")).openContent()
+	s["imscp:file"] = newElemSpec(map[string]valueCheck{"href": uriValue}, []string{"href"},
+		childOptional("imscp:metadata")).openContent()
+	s["imscp:dependency"] = newElemSpec(map[string]valueCheck{"identifierref": idValue}, []string{"identifierref"}).openContent()
+	s["adlcp:location"] = textSpec(uriValue)
+
+	if v12 {
+		// ADL CP do SCORM 1.2
+		s["adlcp:prerequisites"] = newElemSpec(map[string]valueCheck{"type": enumValue("aicc_script")}, []string{"type"})
+		s["adlcp:prerequisites"].text = anyValue
+		s["adlcp:maxtimeallowed"] = textSpec(timespanValue)
+		s["adlcp:timelimitaction"] = textSpec(timeLimitActionValue)
+		s["adlcp:datafromlms"] = textSpec(anyValue)
+		s["adlcp:masteryscore"] = textSpec(decimalValue(0, 100))
+		return s
+	}
+
+	// ADL CP do SCORM 2004
+	s["adlcp:timeLimitAction"] = textSpec(timeLimitActionValue)
+	s["adlcp:dataFromLMS"] = textSpec(anyValue)
+	if v4 {
+		s["adlcp:completionThreshold"] = newElemSpec(map[string]valueCheck{
+			"completedByMeasure": boolValue, "minProgressMeasure": decimalValue(0, 1), "progressWeight": decimalValue(0, 1),
+		}, nil)
+		s["adlcp:completionThreshold"].text = optionalValue(decimalValue(0, 1))
+		s["adlcp:data"] = newElemSpec(nil, nil, childSome("adlcp:map"))
+		s["adlcp:map"] = newElemSpec(map[string]valueCheck{
+			"targetID": uriValue, "readSharedData": boolValue, "writeSharedData": boolValue,
+		}, []string{"targetID"})
+	} else if !v2 {
+		s["adlcp:completionThreshold"] = textSpec(decimalValue(0, 1))
+	}
+
+	// IMS Simple Sequencing
+	sequencing := []childRule{
+		childOptional("imsss:controlMode"), childOptional("imsss:sequencingRules"), childOptional("imsss:limitConditions"),
+		childOptional("imsss:auxiliaryResources"), childOptional("imsss:rollupRules"), childOptional("imsss:objectives"),
+		childOptional("imsss:randomizationControls"), childOptional("imsss:deliveryControls"),
+	}
+	adlseq := []childRule{childOptional("adlseq:constrainedChoiceConsiderations"), childOptional("adlseq:rollupConsiderations")}
+	if v4 {
+		adlseq = append(adlseq, childOptional("adlseq:objectives"))
+	}
+	sequencing = append(sequencing, extensions(adlseq...)...)
+	sequencingAttrs := map[string]valueCheck{"ID": idValue, "IDRef": idValue}
+	s["imsss:sequencingCollection"] = newElemSpec(nil, nil, childSome("imsss:sequencing"))
+	s["imsss:sequencing"] = newElemSpec(sequencingAttrs, nil, sequencing...).openContent()
+	s["imsss:sequencing@sequencingCollection"] = newElemSpec(sequencingAttrs, []string{"ID"}, sequencing...).openContent()
+
+	s["imsss:controlMode"] = newElemSpec(boolAttrs("choice", "choiceExit", "flow", "forwardOnly",
+		"useCurrentAttemptObjectiveInfo", "useCurrentAttemptProgressInfo"), nil)
+	s["imsss:sequencingRules"] = newElemSpec(nil, nil,
+		childMany("imsss:preConditionRule"), childMany("imsss:exitConditionRule"), childMany("imsss:postConditionRule"))
+	for _, rule := range []string{"imsss:preConditionRule", "imsss:exitConditionRule", "imsss:postConditionRule"} {
+		s[rule] = newElemSpec(nil, nil, childOne("imsss:ruleConditions"), childOne("imsss:ruleAction"))
+	}
+	s["imsss:ruleConditions"] = newElemSpec(map[string]valueCheck{"conditionCombination": enumValue(conditionCombinings...)}, nil,
+		childSome("imsss:ruleCondition"))
+	s["imsss:ruleCondition"] = newElemSpec(map[string]valueCheck{
+		"referencedObjective": anyValue,
+		"measureThreshold":    decimalValue(-1, 1),
+		"operator":            enumValue(conditionOperators...),
+		"condition": enumValue("satisfied", "objectiveStatusKnown", "objectiveMeasureKnown",
+			"objectiveMeasureGreaterThan", "objectiveMeasureLessThan", "completed", "activityProgressKnown",
+			"attempted", "attemptLimitExceeded", "timeLimitExceeded", "outsideAvailableTimeRange", "always"),
+	}, []string{"condition"})
+	s["imsss:ruleAction@preConditionRule"] = newElemSpec(map[string]valueCheck{
+		"action": enumValue("skip", "disabled", "hiddenFromChoice", "stopForwardTraversal"),
+	}, []string{"action"})
+	s["imsss:ruleAction@exitConditionRule"] = newElemSpec(map[string]valueCheck{"action": enumValue("exit")}, []string{"action"})
+	s["imsss:ruleAction@postConditionRule"] = newElemSpec(map[string]valueCheck{
+		"action": enumValue("exitParent", "exitAll", "retry", "retryAll", "continue", "previous"),
+	}, []string{"action"})
+	s["imsss:limitConditions"] = newElemSpec(map[string]valueCheck{
+		"attemptLimit":                     nonNegativeIntValue,
+		"attemptAbsoluteDurationLimit":     durationValue,
+		"attemptExperiencedDurationLimit":  durationValue,
+		"activityAbsoluteDurationLimit":    durationValue,
+		"activityExperiencedDurationLimit": durationValue,
+		"beginTimeLimit":                   anyValue,
+		"endTimeLimit":                     anyValue,
+	}, nil)
+	s["imsss:auxiliaryResources"] = &elemSpec{skip: true}
+	s["imsss:rollupRules"] = newElemSpec(map[string]valueCheck{
+		"rollupObjectiveSatisfied": boolValue, "rollupProgressCompletion": boolValue, "objectiveMeasureWeight": decimalValue(0, 1),
+	}, nil, childMany("imsss:rollupRule"))
+	s["imsss:rollupRule"] = newElemSpec(map[string]valueCheck{
+		"childActivitySet": enumValue("all", "any", "none", "atLeastCount", "atLeastPercent"),
+		"minimumCount":     nonNegativeIntValue,
+		"minimumPercent":   decimalValue(0, 1),
+	}, nil, childOne("imsss:rollupConditions"), childOne("imsss:rollupAction"))
+	s["imsss:rollupConditions"] = newElemSpec(map[string]valueCheck{"conditionCombination": enumValue(conditionCombinings...)}, nil,
+		childSome("imsss:rollupCondition"))
+	s["imsss:rollupCondition"] = newElemSpec(map[string]valueCheck{
+		"operator": enumValue(conditionOperators...),
+		"condition": enumValue("satisfied", "objectiveStatusKnown", "objectiveMeasureKnown", "completed",
+			"activityProgressKnown", "attempted", "attemptLimitExceeded", "timeLimitExceeded", "outsideAvailableTimeRange"),
+	}, []string{"condition"})
+	s["imsss:rollupAction"] = newElemSpec(map[string]valueCheck{
+		"action": enumValue("satisfied", "notSatisfied", "completed", "incomplete"),
+	}, []string{"action"})
+	s["imsss:objectives"] = newElemSpec(nil, nil, childOne("imsss:primaryObjective"), childMany("imsss:objective"))
+	objectiveAttrs := map[string]valueCheck{"objectiveID": anyValue, "satisfiedByMeasure": boolValue}
+	s["imsss:primaryObjective"] = newElemSpec(objectiveAttrs, nil, childOptional("imsss:minNormalizedMeasure"), childMany("imsss:mapInfo"))
+	s["imsss:objective"] = newElemSpec(objectiveAttrs, []string{"objectiveID"}, childOptional("imsss:minNormalizedMeasure"), childMany("imsss:mapInfo"))
+	s["imsss:minNormalizedMeasure"] = textSpec(decimalValue(-1, 1))
+	mapInfo := boolAttrs("readSatisfiedStatus", "readNormalizedMeasure", "writeSatisfiedStatus", "writeNormalizedMeasure")
+	mapInfo["targetObjectiveID"] = anyValue
+	s["imsss:mapInfo"] = newElemSpec(mapInfo, []string{"targetObjectiveID"})
+	s["imsss:randomizationControls"] = newElemSpec(map[string]valueCheck{
+		"randomizationTiming": enumValue(sequencingTimings...),
+		"selectCount":         nonNegativeIntValue,
+		"reorderChildren":     boolValue,
+		"selectionTiming":     enumValue(sequencingTimings...),
+	}, nil)
+	s["imsss:deliveryControls"] = newElemSpec(boolAttrs("tracked", "completionSetByContent", "objectiveSetByContent"), nil)
+
+	// ADL Sequencing
+	s["adlseq:constrainedChoiceConsiderations"] = newElemSpec(boolAttrs("preventActivation", "constrainChoice"), nil)
+	rollupConsiderations := boolAttrs("measureSatisfactionIfActive")
+	for _, name := range []string{"requiredForSatisfied", "requiredForNotSatisfied", "requiredForCompleted", "requiredForIncomplete"} {
+		rollupConsiderations[name] = enumValue(rollupRequirements...)
+	}
+	s["adlseq:rollupConsiderations"] = newElemSpec(rollupConsiderations, nil)
+	if v4 {
+		s["adlseq:objectives"] = newElemSpec(nil, nil, childSome("adlseq:objective"))
+		s["adlseq:objective"] = newElemSpec(map[string]valueCheck{"objectiveID": anyValue}, []string{"objectiveID"},
+			childSome("adlseq:mapInfo"))
+		adlMapInfo := boolAttrs("readRawScore", "readMinScore", "readMaxScore", "readCompletionStatus", "readProgressMeasure",
+			"writeRawScore", "writeMinScore", "writeMaxScore", "writeCompletionStatus", "writeProgressMeasure")
+		adlMapInfo["targetObjectiveID"] = anyValue
+		s["adlseq:mapInfo"] = newElemSpec(adlMapInfo, []string{"targetObjectiveID"})
+	}
+
+	// ADL Navigation
+	hideLMSUI := []string{"previous", "continue", "exit", "abandon"}
+	if !v2 {
+		hideLMSUI = append(hideLMSUI, "exitAll", "abandonAll", "suspendAll")
+	}
+	s["adlnav:presentation"] = newElemSpec(nil, nil, childOptional("adlnav:navigationInterface"))
+	s["adlnav:navigationInterface"] = newElemSpec(nil, nil, childMany("adlnav:hideLMSUI"))
+	s["adlnav:hideLMSUI"] = textSpec(enumValue(hideLMSUI...))
+	return s
+}
@@ -0,0 +1,192 @@
+package scorm
+
+import (
+	"strings"
+	"testing"
+)
+
+// manifest2004 monta um manifesto do SCORM 2004 4th Edition com resources
+// e itens dados
+func manifest2004(items, resources string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<manifest identifier="m" version="1"
+  xmlns="http://www.imsglobal.org/xsd/imscp_v1p1"
+  xmlns:adlcp="http://www.adlnet.org/xsd/adlcp_v1p3"
+  xmlns:imsss="http://www.imsglobal.org/xsd/imsss"
+  xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+  xsi:schemaLocation="http://www.imsglobal.org/xsd/imscp_v1p1 imscp_v1p1.xsd">
+  <metadata>
+    <schema>ADL SCORM</schema>
+    <schemaversion>2004 4th Edition</schemaversion>
+  </metadata>
+  <organizations default="org">
+    <organization identifier="org">
+      <title>Course</title>
+` + items + `
+    </organization>
+  </organizations>
+  <resources>
+` + resources + `
+  </resources>
+</manifest>`
+}
+
+const validItems = `      <item identifier="i1" identifierref="r1"><title>One</title></item>`
+
+const validResources = `    <resource identifier="r1" type="webcontent" adlcp:scormType="sco" href="index.html">
+      <file href="index.html"/>
+    </resource>`
+
+// issues devolve os problemas da regra no relatório
+func issues(r *LintReport, rule string) []LintIssue {
+	var found []LintIssue
+	for _, issue := range r.Issues {
+		if issue.Rule == rule {
+			found = append(found, issue)
+		}
+	}
+	return found
+}
+
+func TestLintManifestValid(t *testing.T) {
+	r := LintManifest([]byte(manifest2004(validItems, validResources)))
+	if !r.Valid || r.Errors != 0 {
+		t.Fatalf("valid manifest reported %+v", r.Issues)
+	}
+	if r.Edition != EditionSCORM2004v4 {
+		t.Errorf("edition = %q, want %q", r.Edition, EditionSCORM2004v4)
+	}
+}
+
+func TestLintManifestSyntax(t *testing.T) {
+	r := LintManifest([]byte("<manifest identifier=\"m\">\n<organizations>\n</manifest>"))
+	if r.Valid {
+		t.Fatal("malformed XML accepted")
+	}
+	found := issues(r, LintRuleSyntax)
+	if len(found) != 1 || found[0].Line != 3 {
+		t.Errorf("syntax issues = %+v, want one on line 3", found)
+	}
+}
+
+func TestLintManifestSemanticChecks(t *testing.T) {
+	items := validItems + `
+      <item identifier="i1" identifierref="missing"><title>Two</title></item>`
+	resources := validResources + `
+    <resource identifier="r2" type="webcontent" href="b.html"/>`
+	r := LintManifest([]byte(manifest2004(items, resources)))
+
+	for _, rule := range []string{LintRuleDuplicateID, LintRuleDanglingRef, LintRuleScormType} {
+		if len(issues(r, rule)) == 0 {
+			t.Errorf("no %s issue in %+v", rule, r.Issues)
+		}
+	}
+	dangling := issues(r, LintRuleDanglingRef)
+	if len(dangling) > 0 && dangling[0].Line != 16 {
+		t.Errorf("dangling identifierref reported on line %d, want 16", dangling[0].Line)
+	}
+}
+
+func TestLintManifestSchemaRules(t *testing.T) {
+	tests := []struct {
+		name, items, resources, want string
+	}{
+		{
+			"element out of order",
+			`      <item identifier="i1" identifierref="r1"><title>One</title></item>
+      <title>Late</title>`,
+			validResources,
+			"fora de ordem",
+		},
+		{
+			"missing required attribute",
+			validItems,
+			`    <resource identifier="r1" adlcp:scormType="sco" href="index.html"/>`,
+			"exige o atributo type",
+		},
+		{
+			"bad enumerated value",
+			validItems,
+			`    <resource identifier="r1" type="webcontent" adlcp:scormType="lesson" href="index.html"/>`,
+			"esperado um de: sco, asset",
+		},
+		{
+			"unknown element",
+			validItems + `
+      <bogus/>`,
+			validResources,
+			"não permitido",
+		},
+		{
+			"bad sequencing duration",
+			`      <item identifier="i1" identifierref="r1"><title>One</title>
+        <imsss:sequencing><imsss:limitConditions attemptAbsoluteDurationLimit="PT"/></imsss:sequencing>
+      </item>`,
+			validResources,
+			"xs:duration",
+		},
+		{
+			"exponent in xs:decimal",
+			`      <item identifier="i1" identifierref="r1"><title>One</title>
+        <imsss:sequencing><imsss:sequencingRules><imsss:preConditionRule>
+          <imsss:ruleConditions><imsss:ruleCondition condition="objectiveMeasureGreaterThan" measureThreshold="5e-1"/></imsss:ruleConditions>
+          <imsss:ruleAction action="skip"/>
+        </imsss:preConditionRule></imsss:sequencingRules></imsss:sequencing>
+      </item>`,
+			validResources,
+			"não é um xs:decimal",
+		},
+	}
+	for _, tt := range tests {
+		r := LintManifest([]byte(manifest2004(tt.items, tt.resources)))
+		found := issues(r, LintRuleSchema)
+		if !strings.Contains(messages(found), tt.want) {
+			t.Errorf("%s: schema issues %+v lack %q", tt.name, found, tt.want)
+		}
+		if r.Valid {
+			t.Errorf("%s: manifest reported valid", tt.name)
+		}
+	}
+}
+
+func messages(found []LintIssue) string {
+	var b strings.Builder
+	for _, issue := range found {
+		b.WriteString(issue.Message + "\n")
+	}
+	return b.String()
+}
+
+func TestLintManifestSCORM12(t *testing.T) {
+	data := `<manifest identifier="m"
+  xmlns="http://www.imsproject.org/xsd/imscp_rootv1p1p2"
+  xmlns:adlcp="http://www.adlnet.org/xsd/adlcp_rootv1p2">
+  <metadata><schema>ADL SCORM</schema><schemaversion>1.2</schemaversion></metadata>
+  <organizations default="org">
+    <organization identifier="org"><title>Course</title>
+      <item identifier="i1" identifierref="r1"><title>One</title>
+        <adlcp:masteryscore>150</adlcp:masteryscore>
+      </item>
+    </organization>
+  </organizations>
+  <resources>
+    <resource identifier="r1" type="webcontent" adlcp:scormtype="sco" href="index.html"/>
+  </resources>
+</manifest>`
+	r := LintManifest([]byte(data))
+	if r.Edition != EditionSCORM12 {
+		t.Errorf("edition = %q, want %q", r.Edition, EditionSCORM12)
+	}
+	if found := issues(r, LintRuleSchema); len(found) != 1 || !strings.Contains(found[0].Message, "fora do intervalo") {
+		t.Errorf("schema issues = %+v, want the mastery score out of range", found)
+	}
+}
+
+func TestManifestLintErrorNamesFirstError(t *testing.T) {
+	r := LintManifest([]byte(manifest2004(validItems+`
+      <item identifier="i2" identifierref="missing"><title>Two</title></item>`, validResources)))
+	err := &ManifestLintError{Rule: RuleManifestLint, Report: r}
+	if !strings.Contains(err.Error(), "missing") {
+		t.Errorf("error %q does not describe the dangling reference", err)
+	}
+}
@@ -0,0 +1,38 @@
+package scorm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guilherme-gatti/poc_scorm/internal/blobstore"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// repoRoot é a raiz do repositório, onde ficam os arquivos de exemplo
+var repoRoot string
+
+// TestMain roda os testes num banco novo e com os blobs em memória. O
+// InitDB lê o schema a partir da raiz do repositório; depois os testes rodam
+// na pasta temporária, onde ficam as pastas de storage dos envios.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "scorm-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	if repoRoot, err = os.Getwd(); err != nil {
+		panic(err)
+	}
+	storage.InitDB(filepath.Join(dir, "test.db"))
+	SetContentStore(blobstore.NewMemory())
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -7,12 +7,75 @@ import (
 
 // Estruturas para parsing do imsmanifest.xml
 type Manifest struct {
-	XMLName       xml.Name      `xml:"manifest"`
-	Identifier    string        `xml:"identifier,attr"`
-	Version       string        `xml:"version,attr"`
-	Metadata      Metadata      `xml:"metadata"`
-	Organizations Organizations `xml:"organizations"`
-	Resources     Resources     `xml:"resources"`
+	XMLName              xml.Name              `xml:"manifest"`
+	Identifier           string                `xml:"identifier,attr"`
+	Version              string                `xml:"version,attr"`
+	Metadata             Metadata              `xml:"metadata"`
+	Organizations        Organizations         `xml:"organizations"`
+	Resources            Resources             `xml:"resources"`
+	SequencingCollection *SequencingCollection `xml:"sequencingCollection"`
+}
+
+// DefaultOrganization devolve a organização padrão do manifesto, ou a
+// primeira quando o atributo default não cita nenhuma
+func (m Manifest) DefaultOrganization() (Organization, bool) {
+	orgs := m.Organizations.Organization
+	for _, org := range orgs {
+		if org.Identifier == m.Organizations.Default {
+			return org, true
+		}
+	}
+	if len(orgs) > 0 {
+		return orgs[0], true
+	}
+	return Organization{}, false
+}
+
+// ResolveSequencing aplica a definição de sequenciamento local de um item
+// ou organização sobre a que ela referencia via IDRef na
+// sequencingCollection: os elementos presentes localmente substituem os
+// referenciados. Devolve a definição vazia quando local é nil.
+func (m Manifest) ResolveSequencing(local *Sequencing) Sequencing {
+	if local == nil {
+		return Sequencing{}
+	}
+	if local.IDRef == "" || m.SequencingCollection == nil {
+		return *local
+	}
+	var merged Sequencing
+	found := false
+	for _, seq := range m.SequencingCollection.Sequencing {
+		if seq.ID == local.IDRef {
+			merged, found = seq, true
+			break
+		}
+	}
+	if !found {
+		return *local
+	}
+
+	if local.ControlMode != nil {
+		merged.ControlMode = local.ControlMode
+	}
+	if local.SequencingRules != nil {
+		merged.SequencingRules = local.SequencingRules
+	}
+	if local.LimitConditions != nil {
+		merged.LimitConditions = local.LimitConditions
+	}
+	if local.RollupRules != nil {
+		merged.RollupRules = local.RollupRules
+	}
+	if local.Objectives != nil {
+		merged.Objectives = local.Objectives
+	}
+	if local.DeliveryControls != nil {
+		merged.DeliveryControls = local.DeliveryControls
+	}
+	if local.RollupConsiderations != nil {
+		merged.RollupConsiderations = local.RollupConsiderations
+	}
+	return merged
 }
 
 type Metadata struct {
@@ -44,16 +107,144 @@ type Organizations struct {
 }
 
 type Organization struct {
-	Identifier string `xml:"identifier,attr"`
-	Title      string `xml:"title"`
-	Items      []Item `xml:"item"`
+	Identifier string      `xml:"identifier,attr"`
+	Title      string      `xml:"title"`
+	Items      []Item      `xml:"item"`
+	Sequencing *Sequencing `xml:"sequencing"`
 }
 
 type Item struct {
 	Identifier    string `xml:"identifier,attr"`
 	IdentifierRef string `xml:"identifierref,attr"`
+	Parameters    string `xml:"parameters,attr"`
 	Title         string `xml:"title"`
 	Items         []Item `xml:"item"`
+
+	// extensões adlcp do SCO: o SCORM 1.2 usa nomes em minúsculas e o 2004
+	// em camelCase
+	MasteryScore        string               `xml:"masteryscore"`
+	MaxTimeAllowed      string               `xml:"maxtimeallowed"`
+	TimeLimitAction     string               `xml:"timelimitaction"`
+	TimeLimitAction2004 string               `xml:"timeLimitAction"`
+	DataFromLMS         string               `xml:"datafromlms"`
+	DataFromLMS2004     string               `xml:"dataFromLMS"`
+	CompletionThreshold *CompletionThreshold `xml:"completionThreshold"`
+	Sequencing          *Sequencing          `xml:"sequencing"`
+}
+
+// CompletionThreshold aceita tanto o valor como texto (3ª edição) quanto os
+// atributos da 4ª edição
+type CompletionThreshold struct {
+	Value              string `xml:",chardata"`
+	CompletedByMeasure bool   `xml:"completedByMeasure,attr"`
+	MinProgressMeasure string `xml:"minProgressMeasure,attr"`
+}
+
+// Sequencing guarda as regras imsss:sequencing de um item ou organização.
+// Os atributos booleanos ficam como texto para distinguir "ausente" do
+// valor padrão da especificação
+type Sequencing struct {
+	ID                   string                `xml:"ID,attr"`
+	IDRef                string                `xml:"IDRef,attr"`
+	ControlMode          *ControlMode          `xml:"controlMode"`
+	SequencingRules      *SequencingRules      `xml:"sequencingRules"`
+	LimitConditions      *LimitConditions      `xml:"limitConditions"`
+	RollupRules          *RollupRules          `xml:"rollupRules"`
+	Objectives           *SequencingObjectives `xml:"objectives"`
+	DeliveryControls     *DeliveryControls     `xml:"deliveryControls"`
+	RollupConsiderations *RollupConsiderations `xml:"rollupConsiderations"`
+}
+
+// SequencingCollection reúne definições reutilizadas via IDRef
+type SequencingCollection struct {
+	Sequencing []Sequencing `xml:"sequencing"`
+}
+
+type ControlMode struct {
+	Choice                         string `xml:"choice,attr"`
+	ChoiceExit                     string `xml:"choiceExit,attr"`
+	Flow                           string `xml:"flow,attr"`
+	ForwardOnly                    string `xml:"forwardOnly,attr"`
+	UseCurrentAttemptObjectiveInfo string `xml:"useCurrentAttemptObjectiveInfo,attr"`
+	UseCurrentAttemptProgressInfo  string `xml:"useCurrentAttemptProgressInfo,attr"`
+}
+
+type SequencingRules struct {
+	PreConditionRule  []ConditionRule `xml:"preConditionRule"`
+	ExitConditionRule []ConditionRule `xml:"exitConditionRule"`
+	PostConditionRule []ConditionRule `xml:"postConditionRule"`
+}
+
+type ConditionRule struct {
+	RuleConditions RuleConditions `xml:"ruleConditions"`
+	RuleAction     RuleAction     `xml:"ruleAction"`
+}
+
+type RuleConditions struct {
+	ConditionCombination string          `xml:"conditionCombination,attr"`
+	RuleCondition        []RuleCondition `xml:"ruleCondition"`
+}
+
+type RuleCondition struct {
+	ReferencedObjective string `xml:"referencedObjective,attr"`
+	MeasureThreshold    string `xml:"measureThreshold,attr"`
+	Operator            string `xml:"operator,attr"`
+	Condition           string `xml:"condition,attr"`
+}
+
+type RuleAction struct {
+	Action string `xml:"action,attr"`
+}
+
+type RollupRules struct {
+	RollupObjectiveSatisfied string       `xml:"rollupObjectiveSatisfied,attr"`
+	RollupProgressCompletion string       `xml:"rollupProgressCompletion,attr"`
+	ObjectiveMeasureWeight   string       `xml:"objectiveMeasureWeight,attr"`
+	RollupRule               []RollupRule `xml:"rollupRule"`
+}
+
+type RollupRule struct {
+	ChildActivitySet string           `xml:"childActivitySet,attr"`
+	MinimumCount     string           `xml:"minimumCount,attr"`
+	MinimumPercent   string           `xml:"minimumPercent,attr"`
+	RollupConditions RollupConditions `xml:"rollupConditions"`
+	RollupAction     RuleAction       `xml:"rollupAction"`
+}
+
+type RollupConditions struct {
+	ConditionCombination string          `xml:"conditionCombination,attr"`
+	RollupCondition      []RuleCondition `xml:"rollupCondition"`
+}
+
+type DeliveryControls struct {
+	Tracked                string `xml:"tracked,attr"`
+	CompletionSetByContent string `xml:"completionSetByContent,attr"`
+	ObjectiveSetByContent  string `xml:"objectiveSetByContent,attr"`
+}
+
+// RollupConsiderations vem do namespace adlseq
+type RollupConsiderations struct {
+	RequiredForSatisfied        string `xml:"requiredForSatisfied,attr"`
+	RequiredForNotSatisfied     string `xml:"requiredForNotSatisfied,attr"`
+	RequiredForCompleted        string `xml:"requiredForCompleted,attr"`
+	RequiredForIncomplete       string `xml:"requiredForIncomplete,attr"`
+	MeasureSatisfactionIfActive string `xml:"measureSatisfactionIfActive,attr"`
+}
+
+type LimitConditions struct {
+	AttemptLimit                 string `xml:"attemptLimit,attr"`
+	AttemptAbsoluteDurationLimit string `xml:"attemptAbsoluteDurationLimit,attr"`
+}
+
+type SequencingObjectives struct {
+	PrimaryObjective *SequencingObjective  `xml:"primaryObjective"`
+	Objective        []SequencingObjective `xml:"objective"`
+}
+
+type SequencingObjective struct {
+	ObjectiveID          string `xml:"objectiveID,attr"`
+	SatisfiedByMeasure   bool   `xml:"satisfiedByMeasure,attr"`
+	MinNormalizedMeasure string `xml:"minNormalizedMeasure"`
 }
 
 type Resources struct {
@@ -81,7 +272,7 @@ type ProcessedCourse struct {
 	Modules      []ProcessedModule `json:"modules"`
 	CreatedAt    time.Time         `json:"created_at"`
 	ManifestJSON string            `json:"manifest_json"`
-	Path         string            `json:"path"`
+	StorageKey   string            `json:"storage_key"`
 }
 
 type ProcessedModule struct {
@@ -0,0 +1,172 @@
+package scorm
+
+import (
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Regras da conferência dos arquivos do pacote com o manifesto
+const (
+	LintRuleMissingLaunchFile = "missing_launch_file"
+	LintRuleMissingFile       = "missing_file"
+	LintRuleOrphanFile        = "orphan_file"
+)
+
+// maxOrphanIssues limita os avisos de arquivos sem referência; pacotes que
+// só declaram o href de cada resource teriam um aviso por arquivo
+const maxOrphanIssues = 50
+
+// rejectMissingLaunchFiles faz a importação recusar pacotes em que o href de
+// algum resource não existe (MISSING_LAUNCH_FILES=reject)
+var rejectMissingLaunchFiles = os.Getenv("MISSING_LAUNCH_FILES") == "reject"
+
+// LintPackage valida o manifesto como LintManifest e confere as referências
+// com files, os caminhos (com barras) dos arquivos extraídos do pacote: o
+// href de cada resource e de cada file precisa existir, e arquivos que
+// nenhum deles cita são avisados como órfãos.
+func LintPackage(data []byte, files []string) *LintReport {
+	return lintManifest(data, files)
+}
+
+// packageFiles lista os arquivos extraídos em dir, relativos a ele
+func packageFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// checkFiles confere os href de resources e files com os arquivos do
+// pacote. Os href são resolvidos com os xml:base de manifest, resources e
+// resource; URLs externas não são conferidas. Dependências não precisam de
+// conferência própria: o resource citado é conferido como qualquer outro e
+// dependências sem destino já são apontadas por checkReferences.
+func (l *manifestLinter) checkFiles(root *lintNode, files []string) {
+	present := make(map[string]bool, len(files))
+	folded := make(map[string]string, len(files))
+	for _, f := range files {
+		present[f] = true
+		folded[strings.ToLower(f)] = f
+	}
+	referenced := map[string]bool{"imsmanifest.xml": true}
+
+	// resolve devolve o caminho do href dentro do pacote, ou ok falso para
+	// URLs externas
+	resolve := func(n *lintNode, href string) (string, bool) {
+		parts := []string{href}
+		for a := n; a != nil && !isExternalURL(parts[0]); a = a.parent {
+			if base, ok := a.attr("xml:base"); ok && base != "" {
+				parts = append([]string{base}, parts...)
+			}
+		}
+		if isExternalURL(parts[0]) {
+			return "", false
+		}
+		target := strings.Join(parts, "/")
+		if i := strings.IndexAny(target, "?#"); i >= 0 {
+			target = target[:i]
+		}
+		return path.Clean(target), true
+	}
+
+	// lookup procura o arquivo como está no manifesto e decodificado (%20)
+	lookup := func(p string) (string, bool) {
+		if present[p] {
+			return p, true
+		}
+		if unescaped, err := url.PathUnescape(p); err == nil && present[unescaped] {
+			return unescaped, true
+		}
+		return "", false
+	}
+
+	check := func(n *lintNode, href, rule, kind string) {
+		p, ok := resolve(n, href)
+		if !ok {
+			return
+		}
+		if found, ok := lookup(p); ok {
+			referenced[found] = true
+			return
+		}
+		id, _ := n.attr("identifier")
+		if n.key == "imscp:file" && n.parent != nil {
+			id, _ = n.parent.attr("identifier")
+		}
+		if other, ok := folded[strings.ToLower(p)]; ok {
+			referenced[other] = true
+			l.add(LintError, rule, n, "%s %q do resource %q não existe no pacote; existe %q, com outra capitalização", kind, href, id, other)
+			return
+		}
+		l.add(LintError, rule, n, "%s %q do resource %q não existe no pacote", kind, href, id)
+	}
+
+	var walk func(n *lintNode)
+	walk = func(n *lintNode) {
+		switch n.key {
+		case "imscp:resource":
+			if href, ok := n.attr("href"); ok && href != "" {
+				check(n, href, LintRuleMissingLaunchFile, "o arquivo de lançamento")
+			}
+		case "imscp:file":
+			if href, ok := n.attr("href"); ok && href != "" {
+				check(n, href, LintRuleMissingFile, "o arquivo")
+			}
+		case "adlcp:location":
+			if p, ok := resolve(n, strings.TrimSpace(n.text.String())); ok {
+				referenced[p] = true
+			}
+		}
+		for _, child := range n.children {
+			if child.key != "" {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+
+	// os esquemas citados em xsi:schemaLocation costumam vir no pacote
+	for _, a := range root.rawAttrs {
+		if a.Name.Local == "schemaLocation" {
+			for _, location := range strings.Fields(a.Value) {
+				referenced[path.Clean(location)] = true
+			}
+		}
+	}
+
+	var orphans []string
+	for _, f := range files {
+		if !referenced[f] {
+			orphans = append(orphans, f)
+		}
+	}
+	sort.Strings(orphans)
+	for i, f := range orphans {
+		if i == maxOrphanIssues {
+			l.add(LintWarning, LintRuleOrphanFile, nil, "mais %d arquivo(s) sem referência no manifesto", len(orphans)-i)
+			break
+		}
+		l.addFile(LintWarning, LintRuleOrphanFile, f, "arquivo sem referência no manifesto")
+	}
+}
+
+// isExternalURL informa se a referência aponta para fora do pacote
+// (http://..., //host/...)
+func isExternalURL(ref string) bool {
+	u, err := url.Parse(ref)
+	return err == nil && (u.Scheme != "" || u.Host != "")
+}
@@ -0,0 +1,91 @@
+package scorm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLintPackageMissingFiles(t *testing.T) {
+	resources := `    <resource identifier="r1" type="webcontent" adlcp:scormType="sco" href="Index.html?page=1">
+      <file href="Index.html"/>
+      <file href="css/app.css"/>
+      <file href="img/a%20b.png"/>
+      <file href="https://cdn.example.com/lib.js"/>
+    </resource>
+    <resource identifier="r2" type="webcontent" adlcp:scormType="asset" xml:base="shared/" href="missing.html"/>`
+	files := []string{"index.html", "img/a b.png", "shared/other.html", "imscp_v1p1.xsd", "imsmanifest.xml"}
+	r := LintPackage([]byte(manifest2004(validItems, resources)), files)
+
+	launch := issues(r, LintRuleMissingLaunchFile)
+	if len(launch) != 2 {
+		t.Fatalf("missing launch files = %+v, want Index.html and shared/missing.html", launch)
+	}
+	if !strings.Contains(launch[0].Message, `existe "index.html"`) {
+		t.Errorf("launch issue %q lacks the capitalization hint", launch[0].Message)
+	}
+	if !strings.Contains(launch[1].Message, "missing.html") {
+		t.Errorf("launch issue %q is not about the xml:base resource", launch[1].Message)
+	}
+
+	// a%20b.png existe decodificado e a URL externa não é conferida
+	missing := issues(r, LintRuleMissingFile)
+	if len(missing) != 2 || !strings.Contains(messages(missing), "css/app.css") {
+		t.Errorf("missing files:\n%swant Index.html and css/app.css only", messages(missing))
+	}
+
+	orphans := issues(r, LintRuleOrphanFile)
+	if len(orphans) != 1 || orphans[0].File != "shared/other.html" {
+		t.Errorf("orphans = %+v, want only shared/other.html", orphans)
+	}
+	if r.Valid {
+		t.Error("package with missing files reported valid")
+	}
+}
+
+func TestLintPackageCapsOrphans(t *testing.T) {
+	files := []string{"index.html"}
+	for i := range maxOrphanIssues + 5 {
+		files = append(files, fmt.Sprintf("extra/%03d.txt", i))
+	}
+	r := LintPackage([]byte(manifest2004(validItems, validResources)), files)
+
+	orphans := issues(r, LintRuleOrphanFile)
+	if len(orphans) != maxOrphanIssues+1 {
+		t.Fatalf("%d orphan issues, want %d plus a summary", len(orphans), maxOrphanIssues)
+	}
+	if last := orphans[len(orphans)-1]; !strings.Contains(last.Message, "mais 5") {
+		t.Errorf("summary = %q, want the 5 files left out", last.Message)
+	}
+	if !r.Valid {
+		t.Error("orphan files made the package invalid")
+	}
+}
+
+func TestPackageFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"imsmanifest.xml", "a/b/c.html"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := packageFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(files)
+	if want := []string{"a/b/c.html", "imsmanifest.xml"}; !slices.Equal(files, want) {
+		t.Errorf("packageFiles = %q, want %q", files, want)
+	}
+}
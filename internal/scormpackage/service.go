@@ -1,18 +1,18 @@
 package scorm
 
 import (
-	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
-	"github.com/guilherme-gatti/poc_scorm/internal/storage"
 )
 
 var validate *validator.Validate
@@ -21,85 +21,168 @@ func init() {
 	validate = validator.New()
 }
 
-func ProcessScormPackage(zipPath string) error {
-	dest := strings.TrimSuffix(zipPath, ".zip")
+// ErrNoRootManifest indica um pacote sem imsmanifest.xml na raiz. Pelo IMS
+// Content Packaging o manifesto precisa estar na raiz do pacote.
+var ErrNoRootManifest = errors.New("imsmanifest.xml não encontrado na raiz do pacote")
+
+// PackageResult é o resultado da importação de um pacote: o curso, a versão
+// publicada, a chave de armazenamento do conteúdo, os manifestos
+// encontrados em subpastas, que não são importados, e o relatório de
+// validação do manifesto.
+type PackageResult struct {
+	CourseID     int64       `json:"courseId"`
+	Version      int         `json:"version"`
+	StorageKey   string      `json:"storageKey"`
+	SubManifests []string    `json:"subManifests"`
+	Lint         *LintReport `json:"lint"`
+}
 
-	err := unzip(zipPath, dest)
-	if err != nil {
-		return fmt.Errorf("erro ao descompactar: %w", err)
+// ProcessScormPackage descompacta o pacote, lê e valida o manifesto, grava
+// os arquivos no armazenamento endereçado por conteúdo e publica o curso; um
+// manifesto com o identifier de um curso existente vira uma nova versão
+// dele. O manifesto e os arquivos extraídos passam por LintPackage; com
+// MANIFEST_LINT=strict um pacote com erros é recusado com ManifestLintError,
+// e com MISSING_LAUNCH_FILES=reject também um pacote em que falta o arquivo
+// de lançamento de algum resource. progress, quando não é nil, é chamado ao
+// fim de cada etapa (StageExtracted, StageManifestParsed, StageValidated e
+// StagePublished). A extração é temporária e é sempre removida no fim.
+func ProcessScormPackage(zipPath string, progress func(stage string)) (*PackageResult, error) {
+	if progress == nil {
+		progress = func(string) {}
 	}
 
-	var manifestPath string
-	err = filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	key, _, err := hashFile(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao calcular hash do pacote: %w", err)
+	}
 
-		if !info.IsDir() && info.Name() == "imsmanifest.xml" {
-			manifestPath = path
-		}
-		return nil
-	})
+	dest, err := newWorkDir()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao preparar extração: %w", err)
+	}
+	defer os.RemoveAll(dest)
 
+	err = unzip(zipPath, dest)
 	if err != nil {
-		return fmt.Errorf("erro ao caminhar: %w", err)
+		return nil, fmt.Errorf("erro ao descompactar: %w", err)
 	}
+	progress(StageExtracted)
 
-	if manifestPath == "" {
-		return fmt.Errorf("imsmanifest.xml não encontrado em %s", dest)
+	manifestPath, subManifests, err := locateManifests(dest)
+	if err != nil {
+		return nil, err
 	}
 
-	manifest, err := os.Open(manifestPath)
+	manifestXML, err := os.ReadFile(manifestPath)
 	if err != nil {
-		return fmt.Errorf("erro ao abrir imsmanifest.xml: %w", err)
+		return nil, fmt.Errorf("erro ao abrir imsmanifest.xml: %w", err)
 	}
-	defer manifest.Close()
 
 	var data Manifest
-	decoder := xml.NewDecoder(manifest)
+	decoder := xml.NewDecoder(bytes.NewReader(manifestXML))
 	err = decoder.Decode(&data)
 	if err != nil {
-		return fmt.Errorf("erro ao parsear XML: %w", err)
+		return nil, fmt.Errorf("erro ao parsear XML: %w", err)
 	}
 
 	fmt.Printf("Manifest: %+v\n", data)
+	progress(StageManifestParsed)
+
+	files, err := packageFiles(dest)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar arquivos do pacote: %w", err)
+	}
+	lint := LintPackage(manifestXML, files)
+	if strictManifestLint && !lint.Valid {
+		return nil, &ManifestLintError{Rule: RuleManifestLint, Report: lint}
+	}
+	if rejectMissingLaunchFiles && lint.hasIssue(LintRuleMissingLaunchFile) {
+		return nil, &ManifestLintError{Rule: LintRuleMissingLaunchFile, Report: lint}
+	}
 
 	digitalCourse, err := mapManifestToDigitalCourse(data)
 	if err != nil {
-		return fmt.Errorf("erro ao mapear manifest: %w", err)
+		return nil, fmt.Errorf("erro ao mapear manifest: %w", err)
 	}
 
 	err = validate.Struct(digitalCourse)
 	if err != nil {
-		return fmt.Errorf("erro na validação: %w", err)
+		return nil, fmt.Errorf("erro na validação: %w", err)
 	}
 
 	fmt.Println("✅ Dados validados com sucesso!")
+	progress(StageValidated)
 
 	manifestJSON, err := json.Marshal(data)
 	if err != nil {
-		return fmt.Errorf("erro ao gerar JSON do manifest: %w", err)
+		return nil, fmt.Errorf("erro ao gerar JSON do manifest: %w", err)
+	}
+	lintJSON, err := json.Marshal(lint)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao gerar JSON da validação: %w", err)
 	}
 
 	// Transforma DigitalCourse ➜ JSON (por enquanto não usa)
 	// digitalCourseJSON, err := json.Marshal(digitalCourse)
 	// if err != nil {
-	// 	return fmt.Errorf("erro ao gerar JSON do curso digital: %w", err)
+	// 	return nil, fmt.Errorf("erro ao gerar JSON do curso digital: %w", err)
 	// }
 
-	// Insere no banco SQLite (sem digital_course_json por enquanto)
-	_, err = storage.DB.Exec(`
-		INSERT INTO courses (identifier, version, manifest_json, path)
-		VALUES (?, ?, ?, ?)
-	`, data.Identifier, data.Version, manifestJSON, dest)
+	// os blobs são gravados sem o lock; só o registro do pacote e a
+	// publicação o seguram
+	staged, err := stagePackage(key, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	packagesMu.Lock()
+	defer packagesMu.Unlock()
+	defer staged.unstage()
 
+	err = storePackage(key, dest, staged)
 	if err != nil {
-		return fmt.Errorf("erro ao salvar no banco: %w", err)
+		return nil, err
 	}
 
-	fmt.Println("✅ Manifest e curso digital salvos no banco com sucesso!")
+	// Insere no banco SQLite (sem digital_course_json por enquanto)
+	courseID, version, err := publishVersion(data, manifestJSON, lintJSON, key)
+	if err != nil {
+		releasePackage(key)
+		return nil, fmt.Errorf("erro ao salvar no banco: %w", err)
+	}
+
+	fmt.Printf("✅ Manifest e curso digital salvos no banco com sucesso! (versão %d)\n", version)
+	progress(StagePublished)
+
+	return &PackageResult{CourseID: courseID, Version: version, StorageKey: key, SubManifests: subManifests, Lint: lint}, nil
+}
 
-	return nil
+// locateManifests retorna o imsmanifest.xml da raiz do pacote e os caminhos,
+// relativos a dest, dos manifestos encontrados em subpastas
+func locateManifests(dest string) (string, []string, error) {
+	rootManifest := filepath.Join(dest, "imsmanifest.xml")
+	if info, err := os.Stat(rootManifest); err != nil || !info.Mode().IsRegular() {
+		return "", nil, ErrNoRootManifest
+	}
+
+	subManifests := []string{}
+	err := filepath.WalkDir(dest, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == "imsmanifest.xml" && path != rootManifest {
+			rel, err := filepath.Rel(dest, path)
+			if err != nil {
+				return err
+			}
+			subManifests = append(subManifests, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("erro ao caminhar: %w", err)
+	}
+	return rootManifest, subManifests, nil
 }
 
 func mapManifestToDigitalCourse(manifest Manifest) (*DigitalCourse, error) {
@@ -188,53 +271,6 @@ func inferTopicType(item Item, resources Resources) string {
 	return "LECTURE"
 }
 
-func unzip(src, dest string) error {
-	r, err := zip.OpenReader(src)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	// Detecta prefixo comum
-	prefix := ""
-	if len(r.File) > 0 {
-		prefix = strings.SplitN(r.File[0].Name, "/", 2)[0] + "/"
-	}
-
-	for _, f := range r.File {
-		path := filepath.Join(dest, strings.TrimPrefix(f.Name, prefix))
-
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(path, os.ModePerm)
-			continue
-		}
-
-		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
-			return err
-		}
-
-		dstFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return err
-		}
-
-		fileInArchive, err := f.Open()
-		if err != nil {
-			return err
-		}
-
-		_, err = io.Copy(dstFile, fileInArchive)
-
-		dstFile.Close()
-		fileInArchive.Close()
-
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func ValidateDigitalCourse(digitalCourse *DigitalCourse) error {
 	return validate.Struct(digitalCourse)
 }
@@ -0,0 +1,173 @@
+package scorm
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// ItemSettings são os dados do manifesto que o LMS repassa a um SCO no
+// runtime. PassingScore e CompletionThreshold ficam na escala 0..1 e são nil
+// quando o manifesto não os define; MaxTimeAllowed é mantido como veio no
+// manifesto (CMITimespan no 1.2, duração ISO 8601 no 2004). AttemptLimit é
+// zero quando o item não limita as tentativas.
+type ItemSettings struct {
+	PassingScore        *float64 `json:"passingScore"`
+	MaxTimeAllowed      string   `json:"maxTimeAllowed"`
+	TimeLimitAction     string   `json:"timeLimitAction"`
+	DataFromLMS         string   `json:"dataFromLMS"`
+	CompletionThreshold *float64 `json:"completionThreshold"`
+	AttemptLimit        int      `json:"attemptLimit"`
+}
+
+var timeLimitActions = map[string]bool{
+	"exit,message":        true,
+	"exit,no message":     true,
+	"continue,message":    true,
+	"continue,no message": true,
+}
+
+// SettingsFor extrai as configurações de um item do manifesto. No SCORM 2004
+// a nota mínima vem do objetivo primário (satisfiedByMeasure), o tempo
+// máximo do attemptAbsoluteDurationLimit e o limite de tentativas do
+// attemptLimit; o adlcp:masteryscore (0..100) e o adlcp:maxtimeallowed do
+// 1.2 são usados quando eles não existem. O sequenciamento do item é
+// resolvido contra a sequencingCollection do manifesto, como no motor de
+// sequenciamento.
+func SettingsFor(manifest Manifest, item Item) ItemSettings {
+	var settings ItemSettings
+
+	if item.Sequencing != nil {
+		seq := manifest.ResolveSequencing(item.Sequencing)
+		if seq.Objectives != nil && seq.Objectives.PrimaryObjective != nil {
+			primary := seq.Objectives.PrimaryObjective
+			if primary.SatisfiedByMeasure {
+				measure := strings.TrimSpace(primary.MinNormalizedMeasure)
+				if measure == "" {
+					measure = "1.0"
+				}
+				settings.PassingScore = parseRange(measure, 1)
+			}
+		}
+		if seq.LimitConditions != nil {
+			settings.MaxTimeAllowed = strings.TrimSpace(seq.LimitConditions.AttemptAbsoluteDurationLimit)
+			if limit, err := strconv.Atoi(strings.TrimSpace(seq.LimitConditions.AttemptLimit)); err == nil && limit > 0 {
+				settings.AttemptLimit = limit
+			}
+		}
+	}
+	if settings.PassingScore == nil {
+		settings.PassingScore = parseRange(item.MasteryScore, 100)
+	}
+	if settings.MaxTimeAllowed == "" {
+		settings.MaxTimeAllowed = strings.TrimSpace(item.MaxTimeAllowed)
+	}
+
+	action := strings.ToLower(strings.TrimSpace(firstNonEmpty(item.TimeLimitAction2004, item.TimeLimitAction)))
+	if timeLimitActions[action] {
+		settings.TimeLimitAction = action
+	}
+
+	settings.DataFromLMS = firstNonEmpty(item.DataFromLMS2004, item.DataFromLMS)
+
+	if ct := item.CompletionThreshold; ct != nil {
+		switch {
+		case strings.TrimSpace(ct.Value) != "":
+			settings.CompletionThreshold = parseRange(ct.Value, 1)
+		case ct.CompletedByMeasure:
+			measure := strings.TrimSpace(ct.MinProgressMeasure)
+			if measure == "" {
+				measure = "1.0"
+			}
+			settings.CompletionThreshold = parseRange(measure, 1)
+		}
+	}
+
+	return settings
+}
+
+// parseRange converte um número entre 0 e max para a escala 0..1
+func parseRange(value string, max float64) *float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || f < 0 || f > max {
+		return nil
+	}
+	f /= max
+	return &f
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// saveItemSettings grava as configurações de todos os itens do manifesto de
+// uma versão do curso
+func saveItemSettings(tx *sql.Tx, courseID, versionID int64, manifest Manifest) error {
+	var insert func(org string, items []Item) error
+	insert = func(org string, items []Item) error {
+		for _, item := range items {
+			settings := SettingsFor(manifest, item)
+			_, err := tx.Exec(`
+				INSERT INTO course_items (course_id, version_id, organization, identifier, identifierref, title,
+				                          passing_score, max_time_allowed, time_limit_action, data_from_lms, completion_threshold, attempt_limit)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, courseID, versionID, org, item.Identifier, item.IdentifierRef, item.Title,
+				settings.PassingScore, settings.MaxTimeAllowed, settings.TimeLimitAction, settings.DataFromLMS, settings.CompletionThreshold, settings.AttemptLimit)
+			if err != nil {
+				return err
+			}
+			if err := insert(org, item.Items); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, org := range manifest.Organizations.Organization {
+		if err := insert(org.Identifier, org.Items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadItemSettings lê as configurações gravadas de um item de uma versão do
+// curso. Retorna sql.ErrNoRows para cursos importados antes da tabela
+// course_items existir.
+func LoadItemSettings(versionID int64, identifier string) (ItemSettings, error) {
+	var settings ItemSettings
+	var passing, threshold sql.NullFloat64
+	err := storage.DB.QueryRow(`
+		SELECT passing_score, max_time_allowed, time_limit_action, data_from_lms, completion_threshold, attempt_limit
+		FROM course_items
+		WHERE version_id = ? AND identifier = ?
+		LIMIT 1
+	`, versionID, identifier).Scan(&passing, &settings.MaxTimeAllowed, &settings.TimeLimitAction, &settings.DataFromLMS, &threshold, &settings.AttemptLimit)
+	if err != nil {
+		return ItemSettings{}, err
+	}
+
+	if passing.Valid {
+		settings.PassingScore = &passing.Float64
+	}
+	if threshold.Valid {
+		settings.CompletionThreshold = &threshold.Float64
+	}
+	return settings, nil
+}
+
+// CourseAttemptLimit lê o limite de tentativas por SCO configurado no curso,
+// usado nos itens em que o manifesto não define attemptLimit. Zero indica
+// tentativas ilimitadas.
+func CourseAttemptLimit(courseID int) (int, error) {
+	var limit int
+	err := storage.DB.QueryRow(`SELECT attempt_limit FROM courses WHERE id = ?`, courseID).Scan(&limit)
+	return limit, err
+}
@@ -0,0 +1,56 @@
+package scorm
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+const collectionManifest = `<manifest identifier="m">
+  <organizations default="org">
+    <organization identifier="org">
+      <item identifier="compartilhado" identifierref="r1">
+        <imsss:sequencing IDRef="prova"/>
+      </item>
+      <item identifier="sobrescrito" identifierref="r1">
+        <imsss:sequencing IDRef="prova">
+          <imsss:limitConditions attemptLimit="5"/>
+        </imsss:sequencing>
+      </item>
+    </organization>
+  </organizations>
+  <imsss:sequencingCollection>
+    <imsss:sequencing ID="prova">
+      <imsss:limitConditions attemptLimit="2" attemptAbsoluteDurationLimit="PT30M"/>
+      <imsss:objectives>
+        <imsss:primaryObjective objectiveID="obj" satisfiedByMeasure="true">
+          <imsss:minNormalizedMeasure>0.8</imsss:minNormalizedMeasure>
+        </imsss:primaryObjective>
+      </imsss:objectives>
+    </imsss:sequencing>
+  </imsss:sequencingCollection>
+</manifest>`
+
+func TestSettingsForResolvesSequencingCollection(t *testing.T) {
+	var m Manifest
+	if err := xml.Unmarshal([]byte(collectionManifest), &m); err != nil {
+		t.Fatal(err)
+	}
+	items := m.Organizations.Organization[0].Items
+
+	settings := SettingsFor(m, items[0])
+	if settings.PassingScore == nil || *settings.PassingScore != 0.8 {
+		t.Errorf("PassingScore = %v, esperado 0.8 da sequencingCollection", settings.PassingScore)
+	}
+	if settings.AttemptLimit != 2 || settings.MaxTimeAllowed != "PT30M" {
+		t.Errorf("limites = %d, %q; esperado 2, PT30M", settings.AttemptLimit, settings.MaxTimeAllowed)
+	}
+
+	// os elementos locais substituem os referenciados
+	settings = SettingsFor(m, items[1])
+	if settings.AttemptLimit != 5 || settings.MaxTimeAllowed != "" {
+		t.Errorf("limites = %d, %q; esperado 5 e sem duração", settings.AttemptLimit, settings.MaxTimeAllowed)
+	}
+	if settings.PassingScore == nil || *settings.PassingScore != 0.8 {
+		t.Errorf("PassingScore = %v, esperado 0.8 da sequencingCollection", settings.PassingScore)
+	}
+}
@@ -0,0 +1,212 @@
+package scorm
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UnzipLimits são os limites aplicados ao descompactar um pacote enviado
+type UnzipLimits struct {
+	MaxEntries   int    // quantidade máxima de entradas no zip
+	MaxTotalSize uint64 // tamanho total descompactado, em bytes
+	MaxRatio     uint64 // razão máxima entre tamanho descompactado e compactado de uma entrada
+	// entradas menores que RatioMinSize não passam pela checagem de razão,
+	// já que arquivos pequenos de texto comprimem muito
+	RatioMinSize uint64
+}
+
+// DefaultUnzipLimits são os limites usados por ProcessScormPackage
+var DefaultUnzipLimits = UnzipLimits{
+	MaxEntries:   10000,
+	MaxTotalSize: 1 << 30, // 1 GiB
+	MaxRatio:     100,
+	RatioMinSize: 1 << 20, // 1 MiB
+}
+
+// Regras de segurança verificadas ao descompactar um pacote
+const (
+	RulePathTraversal    = "path_traversal"
+	RuleSymlink          = "symlink"
+	RuleFileType         = "file_type"
+	RuleEntryCount       = "entry_count"
+	RuleTotalSize        = "total_size"
+	RuleCompressionRatio = "compression_ratio"
+)
+
+// UnzipError indica que o pacote foi rejeitado por violar uma regra de
+// segurança. Entry é a entrada do zip que violou a regra, quando há uma.
+type UnzipError struct {
+	Rule   string
+	Entry  string
+	Detail string
+}
+
+func (e *UnzipError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("pacote rejeitado (%s): %s", e.Rule, e.Detail)
+	}
+	return fmt.Sprintf("pacote rejeitado (%s): %s: %s", e.Rule, e.Entry, e.Detail)
+}
+
+func unzip(src, dest string) error {
+	return unzipWithLimits(src, dest, DefaultUnzipLimits)
+}
+
+// unzipWithLimits extrai o zip em dest recusando caminhos que saiam de dest,
+// links simbólicos e arquivos especiais, e limitando a quantidade de
+// entradas, o tamanho total e a razão de compressão. Os tamanhos declarados
+// no zip são checados antes de extrair e os bytes realmente lidos durante a
+// extração, já que o cabeçalho pode mentir. Os arquivos são gravados com
+// permissões fixas, ignorando as do zip.
+func unzipWithLimits(src, dest string, limits UnzipLimits) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if len(r.File) > limits.MaxEntries {
+		return &UnzipError{Rule: RuleEntryCount, Detail: fmt.Sprintf("%d entradas, o máximo é %d", len(r.File), limits.MaxEntries)}
+	}
+
+	prefix := commonPrefix(r.File)
+
+	root, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	var declared uint64
+	targets := make([]string, len(r.File))
+	for i, f := range r.File {
+		if err := checkEntry(f, limits); err != nil {
+			return err
+		}
+		declared += f.UncompressedSize64
+		if declared > limits.MaxTotalSize {
+			return &UnzipError{Rule: RuleTotalSize, Detail: fmt.Sprintf("o conteúdo descompactado passa de %d bytes", limits.MaxTotalSize)}
+		}
+
+		target, err := entryPath(root, f.Name, prefix)
+		if err != nil {
+			return err
+		}
+		targets[i] = target
+	}
+
+	var written uint64
+	for i, f := range r.File {
+		path := targets[i]
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+
+		n, err := extractFile(f, path, limits.MaxTotalSize-written)
+		if err != nil {
+			return err
+		}
+		written += n
+	}
+	return nil
+}
+
+// commonPrefix retorna a pasta que envolve todo o pacote ("curso/"), comum
+// em zips gerados compactando a pasta em vez do seu conteúdo. Só há prefixo
+// quando todas as entradas estão dentro da mesma pasta; se algum arquivo
+// está na raiz do zip nada é removido. Só essa pasta sai: um pacote em
+// "storage/curso/" fica em "curso/", sem manifesto na raiz.
+func commonPrefix(files []*zip.File) string {
+	prefix := ""
+	for _, f := range files {
+		dir, _, found := strings.Cut(f.Name, "/")
+		if !found || dir == "" {
+			return ""
+		}
+		if prefix == "" {
+			prefix = dir + "/"
+		} else if prefix != dir+"/" {
+			return ""
+		}
+	}
+	return prefix
+}
+
+// checkEntry valida o tipo e a razão de compressão declarada de uma entrada
+func checkEntry(f *zip.File, limits UnzipLimits) error {
+	mode := f.Mode()
+	if mode&os.ModeSymlink != 0 {
+		return &UnzipError{Rule: RuleSymlink, Entry: f.Name, Detail: "links simbólicos não são permitidos"}
+	}
+	if !mode.IsRegular() && !mode.IsDir() {
+		return &UnzipError{Rule: RuleFileType, Entry: f.Name, Detail: "apenas arquivos e diretórios são permitidos"}
+	}
+
+	if f.UncompressedSize64 >= limits.RatioMinSize {
+		if f.CompressedSize64 == 0 || f.UncompressedSize64/f.CompressedSize64 > limits.MaxRatio {
+			return &UnzipError{Rule: RuleCompressionRatio, Entry: f.Name, Detail: fmt.Sprintf("razão de compressão acima de %d:1", limits.MaxRatio)}
+		}
+	}
+	return nil
+}
+
+// entryPath resolve o destino de uma entrada dentro de root, recusando nomes
+// absolutos ou com ".." que escapariam do diretório do pacote
+func entryPath(root, name, prefix string) (string, error) {
+	if prefix != "" && name == prefix {
+		// a própria pasta do prefixo
+		return root, nil
+	}
+	rel := filepath.FromSlash(strings.TrimPrefix(name, prefix))
+	if strings.Contains(name, "\\") || !filepath.IsLocal(filepath.FromSlash(name)) || (rel != "" && !filepath.IsLocal(rel)) {
+		return "", &UnzipError{Rule: RulePathTraversal, Entry: name, Detail: "o caminho sai do diretório do pacote"}
+	}
+
+	path := filepath.Join(root, rel)
+	if path != root && !strings.HasPrefix(path, root+string(os.PathSeparator)) {
+		return "", &UnzipError{Rule: RulePathTraversal, Entry: name, Detail: "o caminho sai do diretório do pacote"}
+	}
+	return path, nil
+}
+
+// extractFile grava uma entrada em path lendo no máximo budget bytes e
+// retorna quantos bytes foram escritos
+func extractFile(f *zip.File, path string, budget uint64) (uint64, error) {
+	in, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	// lê um byte além do permitido para detectar entradas que descompactam
+	// mais do que declaram
+	limit := min(budget, f.UncompressedSize64)
+	n, err := io.Copy(out, io.LimitReader(in, int64(limit)+1))
+	if err != nil {
+		return uint64(n), err
+	}
+	if uint64(n) > limit {
+		if limit == budget {
+			return uint64(n), &UnzipError{Rule: RuleTotalSize, Entry: f.Name, Detail: "o conteúdo descompactado passa do limite"}
+		}
+		return uint64(n), &UnzipError{Rule: RuleCompressionRatio, Entry: f.Name, Detail: "a entrada descompacta mais do que declara"}
+	}
+	return uint64(n), out.Close()
+}
@@ -0,0 +1,250 @@
+package scorm
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zipEntry é uma entrada de um zip de teste; nomes terminados em "/" são
+// pastas
+type zipEntry struct {
+	name string
+	body string
+	mode os.FileMode
+}
+
+// writeZip grava um zip com as entradas em um arquivo temporário
+func writeZip(t *testing.T, entries ...zipEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pacote.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			h.SetMode(e.mode)
+		}
+		out, err := w.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := out.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func unzipRule(err error) string {
+	var ue *UnzipError
+	if errors.As(err, &ue) {
+		return ue.Rule
+	}
+	return ""
+}
+
+func TestUnzipStripsOneWrappingFolder(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		want    []string
+	}{
+		{
+			name:    "sem pasta",
+			entries: []zipEntry{{name: "imsmanifest.xml"}, {name: "a/index.html"}},
+			want:    []string{"a/index.html", "imsmanifest.xml"},
+		},
+		{
+			name:    "uma pasta",
+			entries: []zipEntry{{name: "curso/"}, {name: "curso/imsmanifest.xml"}, {name: "curso/a/index.html"}},
+			want:    []string{"a/index.html", "imsmanifest.xml"},
+		},
+		{
+			// só a pasta de fora é removida
+			name: "pastas aninhadas",
+			entries: []zipEntry{
+				{name: "storage/"},
+				{name: "storage/curso/"},
+				{name: "storage/curso/imsmanifest.xml"},
+				{name: "storage/curso/index.html"},
+			},
+			want: []string{"curso/imsmanifest.xml", "curso/index.html"},
+		},
+		{
+			name:    "pastas aninhadas sem entradas de pasta",
+			entries: []zipEntry{{name: "x/y/imsmanifest.xml"}, {name: "x/y/z/index.html"}},
+			want:    []string{"y/imsmanifest.xml", "y/z/index.html"},
+		},
+		{
+			name:    "arquivo na raiz da pasta",
+			entries: []zipEntry{{name: "x/leiame.txt"}, {name: "x/y/imsmanifest.xml"}},
+			want:    []string{"leiame.txt", "y/imsmanifest.xml"},
+		},
+		{
+			name:    "duas pastas",
+			entries: []zipEntry{{name: "a/imsmanifest.xml"}, {name: "b/index.html"}},
+			want:    []string{"a/imsmanifest.xml", "b/index.html"},
+		},
+	}
+	for _, tt := range tests {
+		dest := t.TempDir()
+		if err := unzip(writeZip(t, tt.entries...), dest); err != nil {
+			t.Errorf("%s: unzip: %v", tt.name, err)
+			continue
+		}
+		files, err := packageFiles(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(files, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: arquivos = %v, esperado %v", tt.name, files, tt.want)
+		}
+		entries, _ := os.ReadDir(dest)
+		for _, e := range entries {
+			if e.IsDir() && (e.Name() == "storage" || e.Name() == "x") {
+				t.Errorf("%s: pasta do prefixo %q criada no destino", tt.name, e.Name())
+			}
+		}
+	}
+}
+
+func TestUnzipRepositoryTestZip(t *testing.T) {
+	dest := t.TempDir()
+	if err := unzip(filepath.Join(repoRoot, "test.zip"), dest); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := locateManifests(dest); err != nil {
+		t.Errorf("locateManifests: %v", err)
+	}
+}
+
+func TestNestedPackageHasNoRootManifest(t *testing.T) {
+	dest := t.TempDir()
+	zipPath := writeZip(t, zipEntry{name: "storage/curso/imsmanifest.xml"}, zipEntry{name: "storage/curso/index.html"})
+	if err := unzip(zipPath, dest); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := locateManifests(dest); !errors.Is(err, ErrNoRootManifest) {
+		t.Errorf("locateManifests = %v, want ErrNoRootManifest", err)
+	}
+}
+
+func TestUnzipRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		rule    string
+	}{
+		{"caminho com ..", []zipEntry{{name: "../fora.txt"}}, RulePathTraversal},
+		{"caminho com .. no meio", []zipEntry{{name: "a/../../fora.txt"}}, RulePathTraversal},
+		{"caminho absoluto", []zipEntry{{name: "/etc/passwd"}}, RulePathTraversal},
+		{"barra invertida", []zipEntry{{name: "a\\..\\..\\fora.txt"}}, RulePathTraversal},
+		{"link simbólico", []zipEntry{{name: "link", body: "/etc/passwd", mode: os.ModeSymlink | 0o777}}, RuleSymlink},
+		{"dispositivo", []zipEntry{{name: "dev", mode: os.ModeDevice | 0o644}}, RuleFileType},
+	}
+	for _, tt := range tests {
+		dest := t.TempDir()
+		err := unzip(writeZip(t, tt.entries...), dest)
+		if got := unzipRule(err); got != tt.rule {
+			t.Errorf("%s: regra = %q (%v), esperado %q", tt.name, got, err, tt.rule)
+		}
+		if files, _ := packageFiles(dest); len(files) != 0 {
+			t.Errorf("%s: arquivos extraídos de um pacote recusado: %v", tt.name, files)
+		}
+	}
+}
+
+func TestUnzipLimits(t *testing.T) {
+	big := strings.Repeat("a", 4096)
+	tests := []struct {
+		name    string
+		limits  UnzipLimits
+		entries []zipEntry
+		rule    string
+	}{
+		{
+			name:    "entradas demais",
+			limits:  UnzipLimits{MaxEntries: 2, MaxTotalSize: 1 << 20, MaxRatio: 100, RatioMinSize: 1 << 20},
+			entries: []zipEntry{{name: "a"}, {name: "b"}, {name: "c"}},
+			rule:    RuleEntryCount,
+		},
+		{
+			name:    "tamanho total",
+			limits:  UnzipLimits{MaxEntries: 10, MaxTotalSize: 6000, MaxRatio: 1000, RatioMinSize: 1 << 20},
+			entries: []zipEntry{{name: "a", body: big}, {name: "b", body: big}},
+			rule:    RuleTotalSize,
+		},
+		{
+			name:    "razão de compressão",
+			limits:  UnzipLimits{MaxEntries: 10, MaxTotalSize: 1 << 20, MaxRatio: 10, RatioMinSize: 1024},
+			entries: []zipEntry{{name: "a", body: big}},
+			rule:    RuleCompressionRatio,
+		},
+		{
+			name:    "arquivo pequeno não passa pela razão",
+			limits:  UnzipLimits{MaxEntries: 10, MaxTotalSize: 1 << 20, MaxRatio: 10, RatioMinSize: 1 << 20},
+			entries: []zipEntry{{name: "a", body: big}},
+		},
+	}
+	for _, tt := range tests {
+		err := unzipWithLimits(writeZip(t, tt.entries...), t.TempDir(), tt.limits)
+		if got := unzipRule(err); got != tt.rule || tt.rule == "" && err != nil {
+			t.Errorf("%s: regra = %q (%v), esperado %q", tt.name, got, err, tt.rule)
+		}
+	}
+}
+
+// Uma entrada que descompacta mais do que o cabeçalho declara é recusada
+// durante a extração, sem gravar além do declarado
+func TestUnzipRejectsEntryLargerThanDeclared(t *testing.T) {
+	body := []byte(strings.Repeat("a", 4096))
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	fw.Write(body)
+	fw.Close()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	h := &zip.FileHeader{
+		Name:               "a",
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(body),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: 10,
+	}
+	out, err := w.CreateRaw(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Write(compressed.Bytes())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "mentiroso.zip")
+	if err := os.WriteFile(src, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	if err := unzip(src, dest); err == nil {
+		t.Fatal("pacote com tamanho declarado menor que o conteúdo foi aceito")
+	}
+	if info, err := os.Stat(filepath.Join(dest, "a")); err == nil && info.Size() > 10 {
+		t.Errorf("gravados %d bytes, mais do que os 10 declarados", info.Size())
+	}
+}
@@ -0,0 +1,570 @@
+package scorm
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// Upload em partes compatível com o protocolo tus 1.0.0 (https://tus.io),
+// com as extensões creation, checksum, termination e expiration. O cliente
+// cria o upload informando o tamanho total, envia os bytes em PATCHes a
+// partir do offset atual e, se a conexão cair, pergunta o offset com HEAD e
+// continua de onde parou. Quando o último byte chega o arquivo montado entra
+// na fila de importação como um envio feito por POST /upload. Um upload que
+// fica parado por uploadTTL sem chegar à fila expira.
+
+const (
+	tusVersion = "1.0.0"
+
+	// MaxUploadSize é o maior pacote aceito por upload em partes
+	MaxUploadSize int64 = 2 << 30 // 2 GiB
+
+	// uploadsDir guarda os arquivos parciais enquanto o upload não termina
+	uploadsDir = "./storage/uploads"
+
+	// uploadTTL é quanto tempo um upload sem job de importação pode ficar
+	// sem receber bytes antes de expirar
+	uploadTTL = 24 * time.Hour
+)
+
+// statusChecksumMismatch é o status do tus para uma parte cujo checksum não
+// confere
+const statusChecksumMismatch = 460
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+// Upload é um upload em partes. JobID é o job de importação criado quando o
+// upload termina.
+type Upload struct {
+	ID        string `json:"id"`
+	Filename  string `json:"filename"`
+	Length    int64  `json:"length"`
+	Offset    int64  `json:"offset"`
+	JobID     *int64 `json:"jobId"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// uploadLocks serializa os PATCHes de um mesmo upload. A entrada é
+// descartada quando o upload chega à fila, é removido ou expira.
+var uploadLocks sync.Map
+
+func lockUpload(id string) func() {
+	mu, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// tusHeaders adiciona o cabeçalho Tus-Resumable às respostas e recusa
+// clientes de outra versão do protocolo
+func tusHeaders(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Versão do protocolo tus não suportada"})
+		return false
+	}
+	return true
+}
+
+// UploadOptionsHandler descreve o servidor tus (OPTIONS /uploads)
+func UploadOptionsHandler(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", "creation,checksum,termination,expiration")
+	c.Header("Tus-Max-Size", strconv.FormatInt(MaxUploadSize, 10))
+	c.Header("Tus-Checksum-Algorithm", "sha1,sha256,md5")
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUploadHandler cria um upload (POST /uploads). O tamanho total vem em
+// Upload-Length e o nome do arquivo no campo filename de Upload-Metadata.
+func CreateUploadHandler(c *gin.Context) {
+	if !tusHeaders(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length inválido"})
+		return
+	}
+	if length > MaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Pacote maior que o tamanho máximo"})
+		return
+	}
+
+	id := uuid.New().String()
+	filename := uploadFilename(c.GetHeader("Upload-Metadata"), id)
+
+	if err := os.MkdirAll(uploadsDir, 0o755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao preparar upload"})
+		return
+	}
+	part, err := os.Create(partPath(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao preparar upload"})
+		return
+	}
+	part.Close()
+
+	createdAt := now()
+	_, err = storage.DB.Exec(`
+		INSERT INTO uploads (id, filename, upload_length, upload_offset, created_at, updated_at)
+		VALUES (?, ?, ?, 0, ?, ?)
+	`, id, filename, length, createdAt, createdAt)
+	if err != nil {
+		os.Remove(partPath(id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar upload"})
+		return
+	}
+
+	c.Header("Location", "/uploads/"+id)
+	expiresHeader(c, &Upload{UpdatedAt: createdAt})
+	c.Status(http.StatusCreated)
+}
+
+// UploadOffsetHandler informa quantos bytes já chegaram (HEAD /uploads/:id).
+// Um upload com todos os bytes mas sem job, porque a criação do job falhou
+// ou o servidor parou no meio, é enviado de novo para a fila: o cliente vê
+// o offset final e não manda mais nada.
+func UploadOffsetHandler(c *gin.Context) {
+	if !tusHeaders(c) {
+		return
+	}
+
+	id := c.Param("id")
+	u, err := loadUpload(id)
+	if err != nil {
+		c.Status(uploadErrorStatus(err))
+		return
+	}
+	if u.expired(time.Now()) {
+		c.Status(http.StatusGone)
+		return
+	}
+	if u.Offset == u.Length && u.JobID == nil {
+		unlock := lockUpload(id)
+		u, err = loadUpload(id)
+		if err == nil && u.JobID == nil {
+			err = completeUpload(u)
+		}
+		unlock()
+		if err != nil {
+			log.Printf("scorm: erro ao concluir upload %s: %v", id, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(u.Length, 10))
+	c.Header("Cache-Control", "no-store")
+	expiresHeader(c, u)
+	c.Status(http.StatusOK)
+}
+
+// UploadStatusHandler retorna o upload em JSON (GET /uploads/:id), incluindo
+// o job de importação criado quando ele termina
+func UploadStatusHandler(c *gin.Context) {
+	u, err := loadUpload(c.Param("id"))
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": "Upload não encontrado"})
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// UploadChunkHandler grava uma parte do upload (PATCH /uploads/:id). A parte
+// precisa começar no offset atual; com Upload-Checksum ela só é aceita se o
+// checksum conferir. Sem checksum os bytes recebidos antes de uma queda de
+// conexão são mantidos e o cliente continua do novo offset. Um PATCH no
+// offset final de um upload que ficou sem job tenta criar o job de novo.
+func UploadChunkHandler(c *gin.Context) {
+	if !tusHeaders(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type deve ser application/offset+octet-stream"})
+		return
+	}
+
+	id := c.Param("id")
+	unlock := lockUpload(id)
+	defer unlock()
+
+	u, err := loadUpload(id)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": "Upload não encontrado"})
+		return
+	}
+	if u.JobID != nil {
+		uploadLocks.Delete(id)
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload já concluído"})
+		return
+	}
+	if u.expired(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": "Upload expirado"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset != u.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset não confere com o offset atual"})
+		return
+	}
+	if u.Offset == u.Length {
+		finishUpload(c, u)
+		return
+	}
+
+	var sum hash.Hash
+	var expected []byte
+	if header := c.GetHeader("Upload-Checksum"); header != "" {
+		algorithm, encoded, _ := strings.Cut(header, " ")
+		newHash, ok := checksumAlgorithms[algorithm]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Algoritmo de checksum não suportado"})
+			return
+		}
+		expected, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Checksum inválido"})
+			return
+		}
+		sum = newHash()
+	}
+
+	written, err := appendChunk(u, c.Request.Body, sum)
+	if errors.Is(err, errChunkTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "A parte passa do Upload-Length"})
+		return
+	}
+	if err != nil && sum != nil {
+		// sem o corpo inteiro não há como conferir o checksum
+		truncatePart(u)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao receber a parte"})
+		return
+	}
+	if sum != nil && string(sum.Sum(nil)) != string(expected) {
+		truncatePart(u)
+		c.JSON(statusChecksumMismatch, gin.H{"error": "Checksum da parte não confere"})
+		return
+	}
+
+	u.Offset += written
+	if saveErr := saveUploadOffset(u); saveErr != nil {
+		log.Printf("scorm: erro ao salvar offset do upload %s: %v", u.ID, saveErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar upload"})
+		return
+	}
+	if err != nil {
+		// conexão caiu no meio: os bytes recebidos ficam e o cliente retoma
+		log.Printf("scorm: upload %s interrompido em %d bytes: %v", u.ID, u.Offset, err)
+		c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		expiresHeader(c, u)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if u.Offset == u.Length {
+		finishUpload(c, u)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	expiresHeader(c, u)
+	c.Status(http.StatusNoContent)
+}
+
+// finishUpload cria o job de importação de um upload que recebeu todos os
+// bytes e responde ao PATCH. Se falhar, o upload fica completo sem job e o
+// próximo PATCH ou HEAD tenta de novo.
+func finishUpload(c *gin.Context, u *Upload) {
+	if err := completeUpload(u); err != nil {
+		log.Printf("scorm: erro ao concluir upload %s: %v", u.ID, err)
+		c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao iniciar importação"})
+		return
+	}
+	c.Header("Upload-Import-Job", strconv.FormatInt(*u.JobID, 10))
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// expired informa se o upload ficou parado por mais de uploadTTL sem chegar
+// à fila. Ele é tratado como removido mesmo antes de ExpireUploads apagá-lo.
+func (u *Upload) expired(at time.Time) bool {
+	updatedAt, err := time.Parse(time.RFC3339, u.UpdatedAt)
+	return err == nil && u.JobID == nil && !at.Before(updatedAt.Add(uploadTTL))
+}
+
+// expiresHeader informa em Upload-Expires até quando um upload sem job pode
+// ficar parado
+func expiresHeader(c *gin.Context, u *Upload) {
+	updatedAt, err := time.Parse(time.RFC3339, u.UpdatedAt)
+	if err != nil || u.JobID != nil {
+		return
+	}
+	c.Header("Upload-Expires", updatedAt.Add(uploadTTL).Format(http.TimeFormat))
+}
+
+// DeleteUploadHandler cancela um upload e remove o arquivo parcial
+// (DELETE /uploads/:id)
+func DeleteUploadHandler(c *gin.Context) {
+	if !tusHeaders(c) {
+		return
+	}
+
+	id := c.Param("id")
+	unlock := lockUpload(id)
+	defer unlock()
+
+	u, err := loadUpload(id)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": "Upload não encontrado"})
+		return
+	}
+	if u.JobID != nil {
+		uploadLocks.Delete(id)
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload já concluído"})
+		return
+	}
+
+	if err := removeUpload(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover upload"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// removeUpload apaga um upload sem job e seus arquivos: o parcial e, se o
+// upload estava completo, o zip que não chegou à fila. Deve ser chamada com
+// o lock do upload.
+func removeUpload(id string) error {
+	if _, err := storage.DB.Exec(`DELETE FROM uploads WHERE id = ? AND job_id IS NULL`, id); err != nil {
+		return err
+	}
+	os.Remove(partPath(id))
+	os.Remove(uploadZipPath(id))
+	uploadLocks.Delete(id)
+	return nil
+}
+
+// ExpireUploads remove os uploads sem job de importação parados há mais de
+// uploadTTL e retorna quantos foram removidos
+func ExpireUploads() (int, error) {
+	return expireUploads(time.Now())
+}
+
+func expireUploads(at time.Time) (int, error) {
+	cutoff := at.Add(-uploadTTL).UTC().Format(time.RFC3339)
+	rows, err := storage.DB.Query(`SELECT id FROM uploads WHERE job_id IS NULL AND updated_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, id := range ids {
+		unlock := lockUpload(id)
+		// um PATCH pode ter chegado entre a consulta e o lock
+		u, err := loadUpload(id)
+		if err == nil && u.expired(at) {
+			if err = removeUpload(id); err == nil {
+				removed++
+			}
+		}
+		unlock()
+		if err != nil && err != sql.ErrNoRows {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// StartUploadExpiry remove periodicamente os uploads expirados
+func StartUploadExpiry(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if n, err := ExpireUploads(); err != nil {
+				log.Printf("scorm: erro ao remover uploads expirados: %v", err)
+			} else if n > 0 {
+				log.Printf("scorm: %d uploads expirados removidos", n)
+			}
+		}
+	}()
+}
+
+var errChunkTooLarge = errors.New("parte maior que o restante do upload")
+
+// appendChunk grava body no arquivo parcial a partir do offset do upload,
+// passando os bytes também por sum quando há checksum. Retorna quantos bytes
+// foram gravados mesmo em caso de erro.
+func appendChunk(u *Upload, body io.Reader, sum hash.Hash) (int64, error) {
+	part, err := os.OpenFile(partPath(u.ID), os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer part.Close()
+
+	if _, err := part.Seek(u.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var w io.Writer = part
+	if sum != nil {
+		w = io.MultiWriter(part, sum)
+	}
+
+	remaining := u.Length - u.Offset
+	n, err := io.Copy(w, io.LimitReader(body, remaining+1))
+	if n > remaining {
+		part.Truncate(u.Offset)
+		return 0, errChunkTooLarge
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, part.Close()
+}
+
+// truncatePart descarta o que foi gravado depois do offset confirmado
+func truncatePart(u *Upload) {
+	if err := os.Truncate(partPath(u.ID), u.Offset); err != nil {
+		log.Printf("scorm: erro ao descartar parte do upload %s: %v", u.ID, err)
+	}
+}
+
+// completeUpload move o arquivo montado para a pasta de envios e cria o job
+// de importação, como em POST /upload. O job e o job_id do upload são
+// gravados na mesma transação; se algo falhar o zip fica em incomingDir para
+// a próxima tentativa. Deve ser chamada com o lock do upload.
+func completeUpload(u *Upload) error {
+	if err := os.MkdirAll(incomingDir, 0o755); err != nil {
+		return err
+	}
+	filePath := uploadZipPath(u.ID)
+	if err := os.Rename(partPath(u.ID), filePath); err != nil {
+		// numa nova tentativa o arquivo já foi movido
+		if _, statErr := os.Stat(filePath); statErr != nil {
+			return err
+		}
+	}
+
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	job, err := insertImportJob(tx, u.Filename, filePath)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE uploads SET job_id = ?, updated_at = ? WHERE id = ?`, job.ID, now(), u.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	u.JobID = &job.ID
+	defaultImporter.notify()
+	// o upload não muda mais
+	uploadLocks.Delete(u.ID)
+	return nil
+}
+
+func saveUploadOffset(u *Upload) error {
+	u.UpdatedAt = now()
+	_, err := storage.DB.Exec(`UPDATE uploads SET upload_offset = ?, updated_at = ? WHERE id = ?`, u.Offset, u.UpdatedAt, u.ID)
+	return err
+}
+
+func loadUpload(id string) (*Upload, error) {
+	u := &Upload{ID: id}
+	var jobID sql.NullInt64
+	err := storage.DB.QueryRow(`
+		SELECT filename, upload_length, upload_offset, job_id, created_at, updated_at FROM uploads WHERE id = ?
+	`, id).Scan(&u.Filename, &u.Length, &u.Offset, &jobID, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if jobID.Valid {
+		u.JobID = &jobID.Int64
+	}
+	return u, nil
+}
+
+func uploadErrorStatus(err error) int {
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// uploadFilename lê o nome do arquivo do Upload-Metadata ("filename
+// <base64>, ..."), usando o id do upload quando ele não vem. O nome só é
+// usado para exibição no job de importação.
+func uploadFilename(metadata, id string) string {
+	name := ""
+	for _, pair := range strings.Split(metadata, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key != "filename" {
+			continue
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+			name = filepath.Base(string(decoded))
+		}
+	}
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		name = id + ".zip"
+	}
+	return name
+}
+
+func partPath(id string) string {
+	return filepath.Join(uploadsDir, fmt.Sprintf("%s.part", id))
+}
+
+// uploadZipPath é onde o arquivo montado espera pela importação
+func uploadZipPath(id string) string {
+	return filepath.Join(incomingDir, id+".zip")
+}
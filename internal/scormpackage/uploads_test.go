@@ -0,0 +1,287 @@
+package scorm
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+func tusRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.OPTIONS("/uploads", UploadOptionsHandler)
+	r.POST("/uploads", CreateUploadHandler)
+	r.HEAD("/uploads/:id", UploadOffsetHandler)
+	r.GET("/uploads/:id", UploadStatusHandler)
+	r.PATCH("/uploads/:id", UploadChunkHandler)
+	r.DELETE("/uploads/:id", DeleteUploadHandler)
+	return r
+}
+
+// tus faz uma requisição do protocolo com Tus-Resumable e os cabeçalhos
+// dados (nome, valor, ...)
+func tus(r *gin.Engine, method, target string, body io.Reader, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func createUpload(t *testing.T, r *gin.Engine, length int) string {
+	t.Helper()
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("course.zip"))
+	w := tus(r, http.MethodPost, "/uploads", nil, "Upload-Length", strconv.Itoa(length), "Upload-Metadata", metadata)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d (%s)", w.Code, w.Body)
+	}
+	return w.Header().Get("Location")
+}
+
+func patch(r *gin.Engine, location string, offset int, body io.Reader, headers ...string) *httptest.ResponseRecorder {
+	headers = append(headers, "Upload-Offset", strconv.Itoa(offset), "Content-Type", "application/offset+octet-stream")
+	return tus(r, http.MethodPatch, location, body, headers...)
+}
+
+func checksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func uploadOffset(t *testing.T, r *gin.Engine, location string) string {
+	t.Helper()
+	w := tus(r, http.MethodHead, location, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("HEAD status = %d", w.Code)
+	}
+	return w.Header().Get("Upload-Offset")
+}
+
+func TestUploadOffsetsAndChecksums(t *testing.T) {
+	r := tusRouter()
+	location := createUpload(t, r, 10)
+	if got := uploadOffset(t, r, location); got != "0" {
+		t.Fatalf("initial offset = %s", got)
+	}
+
+	tests := []struct {
+		name       string
+		offset     int
+		body       string
+		headers    []string
+		wantStatus int
+		wantOffset string
+	}{
+		{"offset ahead of the upload", 4, "4567", nil, http.StatusConflict, "0"},
+		{"first chunk", 0, "0123", []string{"Upload-Checksum", checksum("0123")}, http.StatusNoContent, "4"},
+		{"checksum mismatch", 4, "4567", []string{"Upload-Checksum", checksum("xxxx")}, statusChecksumMismatch, "4"},
+		{"unknown algorithm", 4, "4567", []string{"Upload-Checksum", "crc32 AAAA"}, http.StatusBadRequest, "4"},
+		{"past the length", 4, "4567890123", nil, http.StatusRequestEntityTooLarge, "4"},
+		{"stale offset", 0, "0123", nil, http.StatusConflict, "4"},
+		{"last chunk", 4, "456789", []string{"Upload-Checksum", checksum("456789")}, http.StatusNoContent, "10"},
+		{"after completion", 10, "x", nil, http.StatusConflict, "10"},
+	}
+	for _, tt := range tests {
+		w := patch(r, location, tt.offset, strings.NewReader(tt.body), tt.headers...)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.wantStatus, w.Body)
+		}
+		if got := uploadOffset(t, r, location); got != tt.wantOffset {
+			t.Errorf("%s: offset = %s, want %s", tt.name, got, tt.wantOffset)
+		}
+	}
+
+	// o arquivo montado vai para a fila de importação
+	id := strings.TrimPrefix(location, "/uploads/")
+	u, err := loadUpload(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.JobID == nil || u.Filename != "course.zip" {
+		t.Fatalf("completed upload = %+v, want an import job for course.zip", u)
+	}
+	data, err := os.ReadFile(filepath.Join(incomingDir, id+".zip"))
+	if err != nil || string(data) != "0123456789" {
+		t.Errorf("assembled file = %q, %v", data, err)
+	}
+	if _, err := os.Stat(partPath(id)); !os.IsNotExist(err) {
+		t.Errorf("part file still there: %v", err)
+	}
+	if _, ok := uploadLocks.Load(id); ok {
+		t.Error("lock of the completed upload kept")
+	}
+}
+
+// brokenBody entrega data e depois falha, como uma conexão que caiu
+type brokenBody struct{ data io.Reader }
+
+func (b brokenBody) Read(p []byte) (int, error) {
+	n, err := b.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestUploadResumesAfterDroppedConnection(t *testing.T) {
+	r := tusRouter()
+	location := createUpload(t, r, 8)
+
+	// sem checksum os bytes que chegaram ficam
+	w := patch(r, location, 0, brokenBody{strings.NewReader("abc")})
+	if w.Code != http.StatusBadRequest || w.Header().Get("Upload-Offset") != "3" {
+		t.Fatalf("interrupted PATCH = %d, offset %q; want 400 at 3", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// com checksum uma parte incompleta é descartada
+	w = patch(r, location, 3, brokenBody{strings.NewReader("de")}, "Upload-Checksum", checksum("defgh"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("interrupted PATCH with checksum = %d, want 400", w.Code)
+	}
+	if got := uploadOffset(t, r, location); got != "3" {
+		t.Fatalf("offset after the discarded part = %s, want 3", got)
+	}
+
+	if w := patch(r, location, 3, strings.NewReader("defgh"), "Upload-Checksum", checksum("defgh")); w.Code != http.StatusNoContent {
+		t.Fatalf("resumed PATCH = %d (%s)", w.Code, w.Body)
+	}
+	id := strings.TrimPrefix(location, "/uploads/")
+	if data, err := os.ReadFile(filepath.Join(incomingDir, id+".zip")); err != nil || string(data) != "abcdefgh" {
+		t.Errorf("assembled file = %q, %v", data, err)
+	}
+}
+
+func TestUploadProtocolChecks(t *testing.T) {
+	r := tusRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/uploads", nil)
+	req.Header.Set("Upload-Length", "10")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("create without Tus-Resumable = %d, want 412", w.Code)
+	}
+
+	for _, length := range []string{"", "0", "-1", "abc", strconv.FormatInt(MaxUploadSize+1, 10)} {
+		if w := tus(r, http.MethodPost, "/uploads", nil, "Upload-Length", length); w.Code == http.StatusCreated {
+			t.Errorf("create with Upload-Length %q accepted", length)
+		}
+	}
+
+	location := createUpload(t, r, 4)
+	if w := tus(r, http.MethodPatch, location, strings.NewReader("ab"), "Upload-Offset", "0"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("PATCH without the tus content type = %d, want 415", w.Code)
+	}
+
+	if w := tus(r, http.MethodDelete, location, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", w.Code)
+	}
+	if w := tus(r, http.MethodHead, location, nil); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD after DELETE = %d, want 404", w.Code)
+	}
+	if _, err := os.Stat(partPath(strings.TrimPrefix(location, "/uploads/"))); !os.IsNotExist(err) {
+		t.Errorf("part file kept after DELETE: %v", err)
+	}
+}
+
+func TestUploadCompletionIsRetried(t *testing.T) {
+	r := tusRouter()
+	viaHead := createUpload(t, r, 4)
+	viaPatch := createUpload(t, r, 4)
+
+	t.Run("enqueue fails", func(t *testing.T) {
+		withoutImportJobs(t)
+		for _, location := range []string{viaHead, viaPatch} {
+			if w := patch(r, location, 0, strings.NewReader("abcd")); w.Code != http.StatusInternalServerError {
+				t.Fatalf("last PATCH without the import_jobs table = %d, want 500", w.Code)
+			}
+		}
+	})
+
+	for _, location := range []string{viaHead, viaPatch} {
+		id := strings.TrimPrefix(location, "/uploads/")
+		if u, err := loadUpload(id); err != nil || u.Offset != 4 || u.JobID != nil {
+			t.Fatalf("upload after the failed enqueue = %+v, %v; want complete without a job", u, err)
+		}
+		if _, err := os.Stat(uploadZipPath(id)); err != nil {
+			t.Fatalf("assembled zip dropped after the failed enqueue: %v", err)
+		}
+	}
+
+	// the client sees the final offset, and the job is created on the way
+	if got := uploadOffset(t, r, viaHead); got != "4" {
+		t.Errorf("HEAD offset = %s, want 4", got)
+	}
+	w := patch(r, viaPatch, 4, strings.NewReader(""))
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Import-Job") == "" {
+		t.Errorf("PATCH at the final offset = %d, job %q; want 204 with the job", w.Code, w.Header().Get("Upload-Import-Job"))
+	}
+
+	for _, location := range []string{viaHead, viaPatch} {
+		id := strings.TrimPrefix(location, "/uploads/")
+		u, err := loadUpload(id)
+		if err != nil || u.JobID == nil {
+			t.Fatalf("upload after the retry = %+v, %v; want an import job", u, err)
+		}
+		if job, err := loadImportJob(*u.JobID); err != nil || job.zipPath != uploadZipPath(id) {
+			t.Errorf("import job = %+v, %v; want the assembled zip", job, err)
+		}
+		if w := patch(r, location, 4, strings.NewReader("")); w.Code != http.StatusConflict {
+			t.Errorf("PATCH after the retry = %d, want 409", w.Code)
+		}
+	}
+}
+
+func TestUploadsExpire(t *testing.T) {
+	r := tusRouter()
+	w := tus(r, http.MethodPost, "/uploads", nil, "Upload-Length", "8")
+	if _, err := http.ParseTime(w.Header().Get("Upload-Expires")); w.Code != http.StatusCreated || err != nil {
+		t.Fatalf("create = %d, Upload-Expires %q", w.Code, w.Header().Get("Upload-Expires"))
+	}
+	stale := w.Header().Get("Location")
+	fresh := createUpload(t, r, 8)
+	if w := patch(r, stale, 0, strings.NewReader("abc")); w.Code != http.StatusNoContent || w.Header().Get("Upload-Expires") == "" {
+		t.Fatalf("PATCH = %d, Upload-Expires %q", w.Code, w.Header().Get("Upload-Expires"))
+	}
+
+	id := strings.TrimPrefix(stale, "/uploads/")
+	old := time.Now().Add(-uploadTTL - time.Minute).UTC().Format(time.RFC3339)
+	if _, err := storage.DB.Exec(`UPDATE uploads SET updated_at = ? WHERE id = ?`, old, id); err != nil {
+		t.Fatal(err)
+	}
+	if w := tus(r, http.MethodHead, stale, nil); w.Code != http.StatusGone {
+		t.Errorf("HEAD on an expired upload = %d, want 410", w.Code)
+	}
+	if w := patch(r, stale, 3, strings.NewReader("defgh")); w.Code != http.StatusGone {
+		t.Errorf("PATCH on an expired upload = %d, want 410", w.Code)
+	}
+
+	if n, err := expireUploads(time.Now()); err != nil || n != 1 {
+		t.Fatalf("expireUploads = %d, %v; want 1", n, err)
+	}
+	if _, err := loadUpload(id); err != sql.ErrNoRows {
+		t.Errorf("expired upload still stored: %v", err)
+	}
+	if _, err := os.Stat(partPath(id)); !os.IsNotExist(err) {
+		t.Errorf("part file of the expired upload kept: %v", err)
+	}
+	if got := uploadOffset(t, r, fresh); got != "0" {
+		t.Errorf("fresh upload offset = %s, want 0", got)
+	}
+}
@@ -0,0 +1,701 @@
+package scorm
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// Versionamento de cursos. Um curso é identificado pelo identifier do
+// manifesto: enviar de novo um pacote com o mesmo identifier publica uma
+// nova versão do mesmo curso em vez de criar outro. Cada versão guarda o
+// próprio manifesto e conteúdo em course_versions, e as colunas
+// manifest_json, storage_key e version de courses são uma cópia da versão
+// atual (courses.version_id). Cada matrícula roda numa versão
+// (registrations.version_id), e a política de migração do curso decide
+// quando ela passa para a versão atual.
+const (
+	// MigrateStay mantém as matrículas na versão em que começaram; só
+	// matrículas novas usam a versão atual
+	MigrateStay = "stay"
+	// MigrateNextAttempt passa a matrícula para a versão atual no próximo
+	// launch que abre uma tentativa nova, ou seja, quando ela não tem
+	// tentativa suspensa para retomar
+	MigrateNextAttempt = "next-attempt"
+	// MigrateForce passa todas as matrículas para a versão atual assim que
+	// ela é publicada; tentativas em andamento são encerradas
+	MigrateForce = "force"
+)
+
+var migrationPolicies = map[string]bool{
+	MigrateStay:        true,
+	MigrateNextAttempt: true,
+	MigrateForce:       true,
+}
+
+// CourseVersion é uma versão publicada de um curso
+type CourseVersion struct {
+	ID         int64    `json:"id"`
+	CourseID   int64    `json:"course_id"`
+	Number     int      `json:"number"`
+	Version    string   `json:"version"`
+	StorageKey string   `json:"storage_key"`
+	CreatedAt  string   `json:"created_at"`
+	Manifest   Manifest `json:"-"`
+}
+
+// publishVersion publica o manifesto como nova versão do curso com o mesmo
+// identifier, criando o curso se ele ainda não existe, e a torna a versão
+// atual. Reenviar o pacote da versão atual não cria versão nova. Deve ser
+// chamado com packagesMu.
+func publishVersion(data Manifest, manifestJSON, lintJSON []byte, key string) (courseID int64, number int, err error) {
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// bancos anteriores ao versionamento podem ter mais de um curso com o
+	// mesmo identifier; a nova versão vai para o mais recente
+	var currentKey string
+	err = tx.QueryRow(`
+		SELECT c.id, COALESCE(v.number, 0), COALESCE(v.storage_key, '')
+		FROM courses c
+		LEFT JOIN course_versions v ON v.id = c.version_id
+		WHERE c.identifier = ?
+		ORDER BY c.id DESC
+		LIMIT 1
+	`, data.Identifier).Scan(&courseID, &number, &currentKey)
+	switch {
+	case err == sql.ErrNoRows:
+		res, err := tx.Exec(`
+			INSERT INTO courses (identifier, version, manifest_json, storage_key)
+			VALUES (?, ?, ?, ?)
+		`, data.Identifier, data.Version, manifestJSON, key)
+		if err != nil {
+			return 0, 0, err
+		}
+		if courseID, err = res.LastInsertId(); err != nil {
+			return 0, 0, err
+		}
+	case err != nil:
+		return 0, 0, err
+	case currentKey == key:
+		return courseID, number, nil
+	}
+
+	err = tx.QueryRow(`SELECT COALESCE(MAX(number), 0) + 1 FROM course_versions WHERE course_id = ?`, courseID).Scan(&number)
+	if err != nil {
+		return 0, 0, err
+	}
+	res, err := tx.Exec(`
+		INSERT INTO course_versions (course_id, number, version, manifest_json, lint_json, storage_key)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, courseID, number, data.Version, manifestJSON, lintJSON, key)
+	if err != nil {
+		return 0, 0, err
+	}
+	versionID, err := res.LastInsertId()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// configurações por SCO (nota mínima, tempo máximo, dados de lançamento...)
+	if err := saveItemSettings(tx, courseID, versionID, data); err != nil {
+		return 0, 0, fmt.Errorf("erro ao salvar itens do curso: %w", err)
+	}
+	if err := setCurrentVersion(tx, courseID, versionID); err != nil {
+		return 0, 0, err
+	}
+	return courseID, number, tx.Commit()
+}
+
+// setCurrentVersion torna a versão a atual do curso e, com a política
+// force, migra todas as matrículas para ela. Deve ser chamado com
+// packagesMu, porque troca o storage_key do curso, que releasePackage
+// consulta.
+func setCurrentVersion(tx *sql.Tx, courseID, versionID int64) error {
+	_, err := tx.Exec(`
+		UPDATE courses
+		SET version_id = ?,
+		    version = (SELECT version FROM course_versions WHERE id = ?),
+		    manifest_json = (SELECT manifest_json FROM course_versions WHERE id = ?),
+		    storage_key = (SELECT storage_key FROM course_versions WHERE id = ?)
+		WHERE id = ?
+	`, versionID, versionID, versionID, versionID, courseID)
+	if err != nil {
+		return err
+	}
+
+	var policy string
+	if err := tx.QueryRow(`SELECT migration_policy FROM courses WHERE id = ?`, courseID).Scan(&policy); err != nil {
+		return err
+	}
+	if policy != MigrateForce {
+		return nil
+	}
+	return migrateRegistrations(tx, versionID, `course_id = ? AND version_id != ?`, courseID, versionID)
+}
+
+// migrateRegistrations passa as matrículas selecionadas por filter para a
+// versão. As tentativas suspensas ou com dados ainda abertas são
+// encerradas, porque os dados delas são do conteúdo antigo, e o
+// sequenciamento esquece a atividade atual e a suspensa, que podem não
+// existir na versão nova; o status das atividades é mantido. As sessões de
+// runtime dessas tentativas são encerradas junto, e o runtime recusa gravar
+// em tentativas encerradas, então um SCO ainda aberto não grava dados do
+// conteúdo antigo por cima da migração.
+func migrateRegistrations(tx *sql.Tx, versionID int64, filter string, args ...any) error {
+	registrations := `SELECT id FROM registrations WHERE ` + filter
+	open := `(status = 'suspended' OR (status = 'active' AND cmi_json IS NOT NULL)) AND registration_id IN (` + registrations + `)`
+
+	_, err := tx.Exec(`
+		UPDATE runtime_sessions SET state = 'terminated'
+		WHERE state != 'terminated' AND attempt_id IN (SELECT id FROM attempts WHERE `+open+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE attempts SET status = 'ended', updated_at = CURRENT_TIMESTAMP WHERE `+open, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE sequencing_state SET state_json = json_set(state_json, '$.current', '', '$.suspended', '')
+		WHERE registration_id IN (`+registrations+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE registrations SET version_id = ? WHERE `+filter, append([]any{versionID}, args...)...)
+	return err
+}
+
+// courseStorageKeys lista as chaves de armazenamento de todas as versões do
+// curso
+func courseStorageKeys(courseID string) ([]string, error) {
+	rows, err := storage.DB.Query(`
+		SELECT storage_key FROM courses WHERE id = ?
+		UNION
+		SELECT storage_key FROM course_versions WHERE course_id = ?
+	`, courseID, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// LoadVersion lê uma versão com o manifesto. Retorna sql.ErrNoRows para
+// versões inexistentes.
+func LoadVersion(versionID int64) (CourseVersion, error) {
+	var v CourseVersion
+	var manifestJSON string
+	err := storage.DB.QueryRow(`
+		SELECT id, course_id, number, version, storage_key, created_at, manifest_json
+		FROM course_versions WHERE id = ?
+	`, versionID).Scan(&v.ID, &v.CourseID, &v.Number, &v.Version, &v.StorageKey, &v.CreatedAt, &manifestJSON)
+	if err != nil {
+		return CourseVersion{}, err
+	}
+	if err := json.Unmarshal([]byte(manifestJSON), &v.Manifest); err != nil {
+		return CourseVersion{}, err
+	}
+	return v, nil
+}
+
+// CurrentVersion lê a versão atual do curso. Retorna sql.ErrNoRows para
+// cursos inexistentes.
+func CurrentVersion(courseID int) (CourseVersion, error) {
+	var versionID int64
+	err := storage.DB.QueryRow(`SELECT version_id FROM courses WHERE id = ?`, courseID).Scan(&versionID)
+	if err != nil {
+		return CourseVersion{}, err
+	}
+	return LoadVersion(versionID)
+}
+
+// RegistrationVersion lê a versão em que a matrícula roda. Com migrate, que
+// o launch usa antes de abrir uma tentativa, a política next-attempt é
+// aplicada: uma matrícula numa versão antiga sem tentativa a retomar
+// (suspensa, ou ativa com dados) passa para a versão atual. A verificação
+// das tentativas e a migração rodam na mesma transação, para que uma
+// tentativa gravada por outra sessão no meio não seja encerrada.
+func RegistrationVersion(registrationID int64, migrate bool) (CourseVersion, error) {
+	versionID, currentID, policy, err := registrationVersions(storage.DB, registrationID)
+	if err != nil {
+		return CourseVersion{}, err
+	}
+	if !migrate || versionID == currentID || policy != MigrateNextAttempt {
+		return LoadVersion(versionID)
+	}
+
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		return CourseVersion{}, err
+	}
+	defer tx.Rollback()
+
+	// relê dentro da transação: outra requisição pode ter migrado a
+	// matrícula ou aberto uma tentativa desde a leitura acima
+	versionID, currentID, policy, err = registrationVersions(tx, registrationID)
+	if err != nil {
+		return CourseVersion{}, err
+	}
+	if versionID == currentID || policy != MigrateNextAttempt {
+		return LoadVersion(versionID)
+	}
+	var resumable int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM attempts
+		WHERE registration_id = ? AND (status = 'suspended' OR (status = 'active' AND cmi_json IS NOT NULL))
+	`, registrationID).Scan(&resumable)
+	if err != nil {
+		return CourseVersion{}, err
+	}
+	if resumable > 0 {
+		return LoadVersion(versionID)
+	}
+
+	if err := migrateRegistrations(tx, currentID, `id = ?`, registrationID); err != nil {
+		return CourseVersion{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return CourseVersion{}, err
+	}
+	return LoadVersion(currentID)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// registrationVersions lê a versão da matrícula, a versão atual do curso e
+// a política de migração
+func registrationVersions(q queryRower, registrationID int64) (versionID, currentID int64, policy string, err error) {
+	err = q.QueryRow(`
+		SELECT r.version_id, c.version_id, c.migration_policy
+		FROM registrations r
+		JOIN courses c ON c.id = r.course_id
+		WHERE r.id = ?
+	`, registrationID).Scan(&versionID, &currentID, &policy)
+	return versionID, currentID, policy, err
+}
+
+// MigrateCourseVersions cria a versão 1 dos cursos importados antes do
+// versionamento e liga a ela os itens, matrículas e sessões do curso
+func MigrateCourseVersions() error {
+	rows, err := storage.DB.Query(`SELECT id FROM courses WHERE version_id = 0`)
+	if err != nil {
+		return err
+	}
+	var courseIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		courseIDs = append(courseIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, courseID := range courseIDs {
+		if err := migrateCourseVersion(courseID); err != nil {
+			return fmt.Errorf("erro ao criar versão do curso %d: %w", courseID, err)
+		}
+		log.Printf("scorm: curso %d migrado para o versionamento", courseID)
+	}
+	return nil
+}
+
+func migrateCourseVersion(courseID int64) error {
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO course_versions (course_id, number, version, manifest_json, storage_key)
+		SELECT id, 1, version, manifest_json, storage_key FROM courses WHERE id = ?
+	`, courseID)
+	if err != nil {
+		return err
+	}
+	versionID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"courses", "course_items", "registrations", "runtime_sessions"} {
+		column := "course_id"
+		if table == "courses" {
+			column = "id"
+		}
+		_, err := tx.Exec(`UPDATE `+table+` SET version_id = ? WHERE version_id = 0 AND `+column+` = ?`, versionID, courseID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListVersionsHandler lista as versões do curso, da mais nova para a mais
+// antiga, com quantas matrículas rodam em cada uma
+func ListVersionsHandler(c *gin.Context) {
+	courseID := c.Param("id")
+
+	var currentID int64
+	var policy string
+	err := storage.DB.QueryRow(`SELECT version_id, migration_policy FROM courses WHERE id = ?`, courseID).Scan(&currentID, &policy)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Curso não encontrado"})
+		return
+	}
+
+	rows, err := storage.DB.Query(`
+		SELECT v.id, v.number, v.version, v.storage_key, v.created_at,
+		       (SELECT COUNT(*) FROM registrations r WHERE r.version_id = v.id)
+		FROM course_versions v
+		WHERE v.course_id = ?
+		ORDER BY v.number DESC
+	`, courseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao listar versões"})
+		return
+	}
+	defer rows.Close()
+
+	versions := []gin.H{}
+	for rows.Next() {
+		var id int64
+		var number, registrations int
+		var version, storageKey, createdAt string
+		if err := rows.Scan(&id, &number, &version, &storageKey, &createdAt, &registrations); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar dados"})
+			return
+		}
+		versions = append(versions, gin.H{
+			"number":        number,
+			"version":       version,
+			"storage_key":   storageKey,
+			"created_at":    createdAt,
+			"current":       id == currentID,
+			"registrations": registrations,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id":        courseID,
+		"migration_policy": policy,
+		"versions":         versions,
+	})
+}
+
+// versionByNumber lê a versão do curso pelo número. Retorna sql.ErrNoRows
+// quando ela não existe.
+func versionByNumber(courseID, number int) (CourseVersion, error) {
+	var versionID int64
+	err := storage.DB.QueryRow(`
+		SELECT id FROM course_versions WHERE course_id = ? AND number = ?
+	`, courseID, number).Scan(&versionID)
+	if err != nil {
+		return CourseVersion{}, err
+	}
+	return LoadVersion(versionID)
+}
+
+// DiffVersionsHandler compara as árvores de organização de duas versões do
+// curso (GET /courses/:id/versions/diff?from=1&to=2). Sem to compara com a
+// versão atual; sem from, com a anterior a to.
+func DiffVersionsHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	current, err := CurrentVersion(courseID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Curso não encontrado"})
+		return
+	}
+
+	to, err := queryInt(c, "to", current.Number)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to deve ser o número de uma versão"})
+		return
+	}
+	from, err := queryInt(c, "from", to-1)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from deve ser o número de uma versão"})
+		return
+	}
+
+	fromVersion, err := versionByNumber(courseID, from)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Versão %d não encontrada", from)})
+		return
+	}
+	toVersion, err := versionByNumber(courseID, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Versão %d não encontrada", to)})
+		return
+	}
+
+	diff := diffOrganizations(fromVersion.Manifest, toVersion.Manifest)
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"added":   diff.Added,
+		"removed": diff.Removed,
+		"changed": diff.Changed,
+	})
+}
+
+func queryInt(c *gin.Context, name string, fallback int) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// VersionLintHandler retorna o relatório de validação do manifesto de uma
+// versão do curso (GET /courses/:id/versions/:number/lint). Versões
+// importadas antes da validação não têm relatório.
+func VersionLintHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Número de versão inválido"})
+		return
+	}
+
+	var lintJSON string
+	err = storage.DB.QueryRow(`
+		SELECT lint_json FROM course_versions WHERE course_id = ? AND number = ?
+	`, courseID, number).Scan(&lintJSON)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Versão não encontrada"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar versão"})
+		return
+	}
+	if lintJSON == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Versão importada sem relatório de validação"})
+		return
+	}
+
+	var report LintReport
+	if err := json.Unmarshal([]byte(lintJSON), &report); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar dados"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// RollbackVersionHandler volta o curso para uma versão anterior
+// (POST /courses/:id/versions/:number/rollback). A versão escolhida volta a
+// ser a atual e a política de migração do curso vale para ela como para uma
+// versão recém-publicada.
+func RollbackVersionHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Número de versão inválido"})
+		return
+	}
+	version, err := versionByNumber(courseID, number)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Versão não encontrada"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar versão"})
+		return
+	}
+
+	packagesMu.Lock()
+	defer packagesMu.Unlock()
+
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao voltar versão"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := setCurrentVersion(tx, version.CourseID, version.ID); err != nil {
+		log.Printf("scorm: erro ao voltar o curso %d para a versão %d: %v", courseID, number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao voltar versão"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao voltar versão"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"course_id": version.CourseID, "current_version": number})
+}
+
+// MigrationPolicyRequest é o corpo de PUT /courses/:id/migration-policy
+type MigrationPolicyRequest struct {
+	Policy string `json:"policy"`
+}
+
+// UpdateMigrationPolicyHandler define o que acontece com as matrículas em
+// andamento quando uma nova versão do curso é publicada: stay,
+// next-attempt (padrão) ou force
+func UpdateMigrationPolicyHandler(c *gin.Context) {
+	courseID := c.Param("id")
+
+	var req MigrationPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !migrationPolicies[req.Policy] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "policy deve ser stay, next-attempt ou force"})
+		return
+	}
+
+	res, err := storage.DB.Exec(`UPDATE courses SET migration_policy = ? WHERE id = ?`, req.Policy, courseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar política de migração"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Curso não encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"course_id": courseID, "migration_policy": req.Policy})
+}
+
+// versionDiff é a diferença entre as árvores de organização de duas
+// versões. Os itens são comparados pelo identifier dentro de cada
+// organização.
+type versionDiff struct {
+	Added   []diffItem   `json:"added"`
+	Removed []diffItem   `json:"removed"`
+	Changed []itemChange `json:"changed"`
+}
+
+type diffItem struct {
+	Organization string `json:"organization"`
+	Identifier   string `json:"identifier"`
+	Title        string `json:"title"`
+	Parent       string `json:"parent,omitempty"`
+	Href         string `json:"href,omitempty"`
+	Parameters   string `json:"parameters,omitempty"`
+}
+
+type itemChange struct {
+	Organization string                 `json:"organization"`
+	Identifier   string                 `json:"identifier"`
+	Changes      map[string]fieldChange `json:"changes"`
+}
+
+type fieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// flattenOrganizations lista os itens de todas as organizações na ordem da
+// árvore, com o pai e o href do recurso de cada um
+func flattenOrganizations(manifest Manifest) []diffItem {
+	hrefs := map[string]string{}
+	for _, res := range manifest.Resources.Resource {
+		hrefs[res.Identifier] = res.Href
+	}
+
+	var items []diffItem
+	var walk func(org, parent string, children []Item)
+	walk = func(org, parent string, children []Item) {
+		for _, item := range children {
+			items = append(items, diffItem{
+				Organization: org,
+				Identifier:   item.Identifier,
+				Title:        item.Title,
+				Parent:       parent,
+				Href:         hrefs[item.IdentifierRef],
+				Parameters:   item.Parameters,
+			})
+			walk(org, item.Identifier, item.Items)
+		}
+	}
+	for _, org := range manifest.Organizations.Organization {
+		walk(org.Identifier, "", org.Items)
+	}
+	return items
+}
+
+func diffOrganizations(from, to Manifest) versionDiff {
+	diff := versionDiff{Added: []diffItem{}, Removed: []diffItem{}, Changed: []itemChange{}}
+
+	key := func(item diffItem) string { return item.Organization + "\x00" + item.Identifier }
+	before := map[string]diffItem{}
+	for _, item := range flattenOrganizations(from) {
+		before[key(item)] = item
+	}
+
+	seen := map[string]bool{}
+	for _, item := range flattenOrganizations(to) {
+		seen[key(item)] = true
+		old, ok := before[key(item)]
+		if !ok {
+			diff.Added = append(diff.Added, item)
+			continue
+		}
+
+		changes := map[string]fieldChange{}
+		compare := func(field, a, b string) {
+			if a != b {
+				changes[field] = fieldChange{From: a, To: b}
+			}
+		}
+		compare("title", old.Title, item.Title)
+		compare("parent", old.Parent, item.Parent)
+		compare("href", old.Href, item.Href)
+		compare("parameters", old.Parameters, item.Parameters)
+		if len(changes) > 0 {
+			diff.Changed = append(diff.Changed, itemChange{Organization: item.Organization, Identifier: item.Identifier, Changes: changes})
+		}
+	}
+
+	for _, item := range flattenOrganizations(from) {
+		if !seen[key(item)] {
+			diff.Removed = append(diff.Removed, item)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,131 @@
+package scorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+func TestMigrateRegistrationsEndsOpenAttempts(t *testing.T) {
+	exec := func(query string, args ...any) int64 {
+		t.Helper()
+		res, err := storage.DB.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		return id
+	}
+
+	regID := exec(`INSERT INTO registrations (user_id, course_id, version_id) VALUES (1, 6101, 1)`)
+	attempts := map[string]int64{}
+	for _, a := range []struct{ name, status, cmiJSON string }{
+		{"suspended", "suspended", `{"cmi.location":"p1"}`},
+		{"committed", "active", `{"cmi.location":"p2"}`},
+		{"fresh", "active", ""},
+	} {
+		var cmiJSON any
+		if a.cmiJSON != "" {
+			cmiJSON = a.cmiJSON
+		}
+		id := exec(`INSERT INTO attempts (registration_id, user_id, course_id, sco_id, status, cmi_json) VALUES (?, 1, 6101, 'sco', ?, ?)`, regID, a.status, cmiJSON)
+		attempts[a.name] = id
+		exec(`INSERT INTO runtime_sessions (token, attempt_id, course_id, version, state) VALUES (?, ?, 6101, '2004', 'running')`, "migrate-"+a.name, id)
+	}
+
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateRegistrations(tx, 2, `id = ?`, regID); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct{ attempt, session string }{
+		"suspended": {"ended", "terminated"},
+		"committed": {"ended", "terminated"},
+		"fresh":     {"active", "running"},
+	}
+	for name, w := range want {
+		var status, state string
+		if err := storage.DB.QueryRow(`SELECT status FROM attempts WHERE id = ?`, attempts[name]).Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.DB.QueryRow(`SELECT state FROM runtime_sessions WHERE token = ?`, "migrate-"+name).Scan(&state); err != nil {
+			t.Fatal(err)
+		}
+		if status != w.attempt || state != w.session {
+			t.Errorf("%s attempt: status %q, session %q; want %q, %q", name, status, state, w.attempt, w.session)
+		}
+	}
+
+	var versionID int64
+	if err := storage.DB.QueryRow(`SELECT version_id FROM registrations WHERE id = ?`, regID).Scan(&versionID); err != nil {
+		t.Fatal(err)
+	}
+	if versionID != 2 {
+		t.Errorf("registration version = %d, want 2", versionID)
+	}
+}
+
+func TestRegistrationVersionChecksAttemptsInTheMigration(t *testing.T) {
+	exec := func(query string, args ...any) int64 {
+		t.Helper()
+		res, err := storage.DB.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		return id
+	}
+
+	oldID := exec(`INSERT INTO course_versions (course_id, number, manifest_json, storage_key) VALUES (6201, 1, '{}', 'v1')`)
+	currentID := exec(`INSERT INTO course_versions (course_id, number, manifest_json, storage_key) VALUES (6201, 2, '{}', 'v2')`)
+	exec(`INSERT INTO courses (id, identifier, version, manifest_json, version_id) VALUES (6201, 'c', '2004', '{}', ?)`, currentID)
+	regID := exec(`INSERT INTO registrations (user_id, course_id, version_id) VALUES (1, 6201, ?)`, oldID)
+
+	// outra sessão grava uma tentativa a retomar enquanto o launch decide
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec(`INSERT INTO attempts (registration_id, user_id, course_id, sco_id, status, cmi_json) VALUES (?, 1, 6201, 'sco', 'suspended', '{}')`, regID)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	type result struct {
+		version CourseVersion
+		err     error
+	}
+	done := make(chan result)
+	go func() {
+		v, err := RegistrationVersion(regID, true)
+		done <- result{v, err}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.version.ID != oldID {
+		t.Errorf("versão = %d, esperado %d: a tentativa suspensa deve manter a versão antiga", res.version.ID, oldID)
+	}
+	var status string
+	if err := storage.DB.QueryRow(`SELECT status FROM attempts WHERE registration_id = ?`, regID).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != "suspended" {
+		t.Errorf("tentativa %q, esperado suspended", status)
+	}
+}
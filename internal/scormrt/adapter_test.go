@@ -0,0 +1,138 @@
+package scormrt
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adapterHarness runs api.js under node against the runtime endpoints. A
+// fake XMLHttpRequest makes the adapter's synchronous requests through a
+// child node process and counts them. It prints, for each call, the result,
+// the last error and how many requests the adapter made so far.
+const adapterHarness = `
+const { execFileSync } = require("child_process");
+const fs = require("fs");
+const [apiPath, endpoint, session, callsJSON] = process.argv.slice(2);
+
+const fetchScript = 'fetch(process.argv[1], { method: "POST", headers: { "Content-Type": "application/json" }, body: process.argv[2] })' +
+  '.then(r => r.text().then(t => process.stdout.write(r.status + "\\n" + t)))';
+let requests = 0;
+
+class XMLHttpRequest {
+  open(method, url) { this.url = url; }
+  setRequestHeader() {}
+  send(body) {
+    requests++;
+    const out = execFileSync(process.execPath, ["-e", fetchScript, this.url, body]).toString();
+    const i = out.indexOf("\n");
+    this.status = Number(out.slice(0, i));
+    this.responseText = out.slice(i + 1);
+  }
+}
+
+globalThis.window = globalThis;
+globalThis.XMLHttpRequest = XMLHttpRequest;
+window.SCORM_PLAYER = { session, endpoint };
+window.addEventListener = () => {};
+new Function(fs.readFileSync(apiPath, "utf8"))();
+
+const out = JSON.parse(callsJSON).map(([api, method, ...args]) => {
+  const result = window[api][method](...args);
+  return [result, window[api][api === "API" ? "LMSGetLastError" : "GetLastError"](), String(requests)];
+});
+process.stdout.write(JSON.stringify(out));
+`
+
+// adapterCall is one call the content makes on the adapter, and the result,
+// last error and total request count it must leave.
+type adapterCall struct {
+	method string
+	args   []string
+	want   [3]string
+}
+
+func runAdapter(t *testing.T, version Version, calls []adapterCall) {
+	t.Helper()
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not installed")
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/scormrt", RuntimeHandler)
+	r.POST("/scormrt/batch", BatchHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	apiPath := filepath.Join(dir, "api.js")
+	harnessPath := filepath.Join(dir, "harness.js")
+	if err := os.WriteFile(apiPath, apiJS, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(harnessPath, []byte(adapterHarness), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	api := "API_1484_11"
+	if version == SCORM12 {
+		api = "API"
+	}
+	var script [][]string
+	for _, c := range calls {
+		script = append(script, append([]string{api, c.method}, c.args...))
+	}
+	callsJSON, _ := json.Marshal(script)
+
+	cmd := exec.Command(node, harnessPath, apiPath, srv.URL+"/scormrt", browseSession(t, version), string(callsJSON))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("node: %v\n%s", err, stderr.String())
+	}
+	var got [][3]string
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("harness output %q: %v", out, err)
+	}
+	for i, c := range calls {
+		if got[i] != c.want {
+			t.Errorf("%s(%s) = %q, want %q (result, error, requests)", c.method, strings.Join(c.args, ", "), got[i], c.want)
+		}
+	}
+}
+
+func TestAdapterValidatesBeforeQueueing(t *testing.T) {
+	runAdapter(t, SCORM2004, []adapterCall{
+		{"Initialize", nil, [3]string{"true", "0", "1"}},
+		// cached but typed elements are checked by the server right away
+		{"SetValue", []string{"cmi.score.scaled", "2"}, [3]string{"false", "407", "2"}},
+		{"SetValue", []string{"cmi.completion_status", "done"}, [3]string{"false", "406", "3"}},
+		{"SetValue", []string{"cmi.session_time", "1:30:00"}, [3]string{"false", "406", "4"}},
+		{"SetValue", []string{"cmi.score.scaled", "0.5"}, [3]string{"true", "0", "5"}},
+		{"GetValue", []string{"cmi.score.scaled"}, [3]string{"0.5", "0", "6"}},
+		// free text is queued
+		{"SetValue", []string{"cmi.location", "page-2"}, [3]string{"true", "0", "6"}},
+		{"SetValue", []string{"cmi.suspend_data", "state"}, [3]string{"true", "0", "6"}},
+		{"Commit", nil, [3]string{"true", "0", "7"}},
+		{"GetValue", []string{"cmi.location"}, [3]string{"page-2", "0", "7"}},
+	})
+}
+
+func TestAdapterChecksTextLength12(t *testing.T) {
+	runAdapter(t, SCORM12, []adapterCall{
+		{"LMSInitialize", []string{""}, [3]string{"true", "0", "1"}},
+		{"LMSSetValue", []string{"cmi.core.lesson_location", strings.Repeat("é", 128)}, [3]string{"false", "405", "2"}},
+		{"LMSSetValue", []string{"cmi.core.lesson_location", strings.Repeat("é", 127)}, [3]string{"true", "0", "2"}},
+		{"LMSSetValue", []string{"cmi.core.score.raw", "150"}, [3]string{"false", "405", "3"}},
+		{"LMSCommit", []string{""}, [3]string{"true", "0", "4"}},
+	})
+}
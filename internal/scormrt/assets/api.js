@@ -0,0 +1,235 @@
+// SCORM API adapter served by the LMS player page. It exposes window.API
+// (SCORM 1.2) and window.API_1484_11 (SCORM 2004) to the content frame and
+// forwards calls synchronously to /scormrt with the launch session token.
+//
+// To keep chatty content cheap, Initialize returns a snapshot of the CMI
+// values and the free text elements (cmi.location, cmi.suspend_data, ...)
+// with their maximum length: GetValue is answered from that cache and
+// SetValue calls on those elements with a value within the length are queued
+// and flushed in one /scormrt/batch request on Commit or Terminate (or
+// before any call the cache cannot answer). Such a call cannot fail on the
+// server. Any other SetValue goes to the server right away, so typed,
+// read-only, unknown and collection elements, and values over the length,
+// report their error codes to the content. The cache only takes a value once
+// the server accepted it, and Commit replaces it with the values the LMS
+// holds after evaluating the attempt.
+//
+// When a SCORM 2004 SCO terminates after setting adl.nav.request, the
+// navigation the LMS processed is dispatched to the player page as a
+// "scorm:navigate" event once the content's Terminate call has returned.
+(function () {
+  "use strict";
+
+  var config = window.SCORM_PLAYER || {};
+  var endpoint = config.endpoint || "/scormrt";
+  var useCache = config.cache !== false;
+  var initialized = false;
+  var finished = false;
+  var lastError = "0";
+  var cache = {};
+  // queueable maps the elements SetValue may queue to their maximum length
+  // in bytes, 0 meaning no limit
+  var queueable = {};
+  var queue = [];
+  // pending holds the elements of the queued SetValue calls
+  var pending = {};
+
+  function has(obj, key) {
+    return Object.prototype.hasOwnProperty.call(obj, key);
+  }
+
+  function post(url, body) {
+    var xhr = new XMLHttpRequest();
+    xhr.open("POST", url, false);
+    xhr.setRequestHeader("Content-Type", "application/json");
+    try {
+      xhr.send(JSON.stringify(body));
+    } catch (e) {
+      return null;
+    }
+    if (xhr.status !== 200) {
+      return null;
+    }
+    try {
+      return JSON.parse(xhr.responseText);
+    } catch (e) {
+      return null;
+    }
+  }
+
+  function request(method, element, value) {
+    return {
+      session: config.session,
+      method: method,
+      element: element === undefined ? "" : String(element),
+      value: value === undefined ? "" : String(value)
+    };
+  }
+
+  // accepted caches the value of a SetValue the server accepted, for
+  // elements the cache answers.
+  function accepted(req) {
+    if (has(cache, req.element)) {
+      cache[req.element] = req.value;
+    }
+  }
+
+  // batch sends the queued calls followed by req and returns the result of
+  // req. Queued calls are checked before they are queued, but should the
+  // server still reject one the Commit or Terminate that flushed it fails,
+  // since the content was already told it succeeded.
+  function batch(req) {
+    var calls = queue.concat([req]);
+    queue = [];
+    pending = {};
+
+    var res = post(endpoint + "/batch", calls);
+    if (res === null || !res.results) {
+      lastError = "101";
+      return { result: "false", errorCode: "101" };
+    }
+
+    var failed = null;
+    for (var i = 0; i < res.results.length - 1; i++) {
+      var r = res.results[i];
+      if (r.result === "true") {
+        accepted(calls[i]);
+      } else if (failed === null) {
+        failed = r;
+      }
+    }
+
+    var last = res.results[res.results.length - 1];
+    if (failed !== null && last.result === "true" && /Commit|Terminate|Finish/.test(req.method)) {
+      last = { result: "false", errorCode: failed.errorCode, snapshot: last.snapshot };
+    }
+    return last;
+  }
+
+  function send(req) {
+    return queue.length > 0 ? batch(req) : post(endpoint, req);
+  }
+
+  function call(method, element, value) {
+    var req = request(method, element, value);
+    var res = send(req);
+    if (res === null) {
+      lastError = "101";
+      return method.indexOf("GetValue") >= 0 ? "" : "false";
+    }
+    lastError = res.errorCode;
+    if (res.snapshot) {
+      cache = res.snapshot;
+    } else if (method.indexOf("SetValue") >= 0 && res.result === "true") {
+      accepted(req);
+    }
+    return String(res.result);
+  }
+
+  function initialize(method) {
+    var res = post(endpoint, request(method));
+    if (res === null) {
+      lastError = "101";
+      return "false";
+    }
+    lastError = res.errorCode;
+    if (res.result === "true") {
+      initialized = true;
+      cache = res.snapshot || {};
+      queueable = res.queueable || {};
+    }
+    return String(res.result);
+  }
+
+  function getValue(method, element) {
+    if (useCache && initialized && !finished && has(cache, element) && !has(pending, element)) {
+      lastError = "0";
+      return cache[element];
+    }
+    return call(method, element);
+  }
+
+  // byteLength returns the length of value in UTF-8, as the server counts it.
+  function byteLength(value) {
+    return new TextEncoder().encode(value).length;
+  }
+
+  // canQueue reports whether a SetValue of req can be queued: the server
+  // would accept it, so the content may be told it succeeded right away.
+  function canQueue(req) {
+    if (!useCache || !initialized || finished || !has(queueable, req.element)) {
+      return false;
+    }
+    var max = queueable[req.element];
+    return max === 0 || byteLength(req.value) <= max;
+  }
+
+  function setValue(method, element, value) {
+    var req = request(method, element, value);
+    if (!canQueue(req)) {
+      return call(method, element, value);
+    }
+    queue.push(req);
+    pending[req.element] = true;
+    lastError = "0";
+    return "true";
+  }
+
+  function terminate(method) {
+    var res = send(request(method));
+    if (res === null) {
+      lastError = "101";
+      return "false";
+    }
+    lastError = res.errorCode;
+    if (res.result === "true") {
+      finished = true;
+      if (res.navigation) {
+        navigate(res.navigation);
+      }
+    }
+    return String(res.result);
+  }
+
+  // navigate hands the navigation to the player page after the current call
+  // stack unwinds, so the content finishes its own Terminate handling first.
+  function navigate(navigation) {
+    window.setTimeout(function () {
+      window.dispatchEvent(new CustomEvent("scorm:navigate", { detail: navigation }));
+    }, 0);
+  }
+
+  window.API_1484_11 = {
+    Initialize: function () { return initialize("Initialize"); },
+    Terminate: function () { return terminate("Terminate"); },
+    GetValue: function (element) { return getValue("GetValue", element); },
+    SetValue: function (element, value) { return setValue("SetValue", element, value); },
+    Commit: function () { return call("Commit"); },
+    GetLastError: function () { return lastError; },
+    GetErrorString: function (code) { return call("GetErrorString", "", code); },
+    GetDiagnostic: function (code) { return call("GetDiagnostic", "", code); }
+  };
+
+  window.API = {
+    LMSInitialize: function () { return initialize("LMSInitialize"); },
+    LMSFinish: function () { return terminate("LMSFinish"); },
+    LMSGetValue: function (element) { return getValue("LMSGetValue", element); },
+    LMSSetValue: function (element, value) { return setValue("LMSSetValue", element, value); },
+    LMSCommit: function () { return call("LMSCommit"); },
+    LMSGetLastError: function () { return lastError; },
+    LMSGetErrorString: function (code) { return call("LMSGetErrorString", "", code); },
+    LMSGetDiagnostic: function (code) { return call("LMSGetDiagnostic", "", code); }
+  };
+
+  // Content that never calls Terminate still gets its queued values and data
+  // persisted when the learner closes or leaves the player.
+  window.addEventListener("pagehide", function () {
+    if (!initialized || finished || !navigator.sendBeacon) {
+      return;
+    }
+    var calls = queue.concat([request("Terminate")]);
+    queue = [];
+    navigator.sendBeacon(endpoint + "/batch", new Blob([JSON.stringify(calls)], { type: "application/json" }));
+    finished = true;
+  });
+})();
@@ -0,0 +1,74 @@
+package scormrt
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AttemptsHandler lists every attempt of a learner, oldest first, with its
+// number on the SCO, status, score and duration. The courseId and scoId
+// query parameters narrow the list.
+func AttemptsHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	courseID := 0
+	if v := c.Query("courseId"); v != "" {
+		if courseID, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid course id"})
+			return
+		}
+	}
+
+	attempts, err := loadAttempts(userID, courseID, c.Query("scoId"))
+	if err != nil {
+		log.Printf("scormrt: erro ao buscar tentativas do usuário %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load attempts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"userId": userID, "attempts": attempts})
+}
+
+// InteractionsHandler lists the interactions recorded in an attempt, in
+// cmi.interactions order.
+func InteractionsHandler(c *gin.Context) {
+	attemptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attempt id"})
+		return
+	}
+
+	interactions, err := loadInteractions(attemptID)
+	if err != nil {
+		log.Printf("scormrt: erro ao buscar interações da tentativa %d: %v", attemptID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load interactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attemptId": attemptID, "interactions": interactions})
+}
+
+// ObjectivesHandler lists the objectives recorded in an attempt, in
+// cmi.objectives order.
+func ObjectivesHandler(c *gin.Context) {
+	attemptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attempt id"})
+		return
+	}
+
+	objectives, err := loadObjectives(attemptID)
+	if err != nil {
+		log.Printf("scormrt: erro ao buscar objetivos da tentativa %d: %v", attemptID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load objectives"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attemptId": attemptID, "objectives": objectives})
+}
@@ -0,0 +1,60 @@
+package scormrt
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+var errSessionExpired = errors.New("session expired")
+
+// ContentHandler serves the files of the package a launch session belongs to
+// (GET /content/:session/*path). The session token in the path scopes the
+// request to the course of that launch, and relative URLs inside the SCO
+// keep it, so every asset the content loads is authorized the same way.
+func ContentHandler(c *gin.Context) {
+	storageKey, err := sessionContent(c.Param("session"))
+	if err == errSessionExpired {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown session"})
+		return
+	}
+	if err != nil {
+		log.Printf("scormrt: erro ao buscar conteúdo da sessão: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load session"})
+		return
+	}
+
+	scorm.ServePackageFile(c, storageKey, strings.TrimPrefix(c.Param("path"), "/"))
+}
+
+// sessionContent returns the storage key of the package a session may read,
+// errSessionExpired once the session is older than scorm.ContentSessionAge,
+// and sql.ErrNoRows for unknown tokens or deleted courses. Sessions read the
+// package of the course version they were launched in.
+func sessionContent(token string) (string, error) {
+	var storageKey string
+	var fresh bool
+	err := storage.DB.QueryRow(`
+		SELECT v.storage_key, s.created_at >= datetime('now', ?)
+		FROM runtime_sessions s
+		JOIN course_versions v ON v.id = s.version_id
+		WHERE s.token = ?
+	`, scorm.ContentSessionAge, token).Scan(&storageKey, &fresh)
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", errSessionExpired
+	}
+	return storageKey, nil
+}
@@ -0,0 +1,38 @@
+package scormrt
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+func TestSessionContentExpires(t *testing.T) {
+	res, err := storage.DB.Exec(`
+		INSERT INTO course_versions (course_id, number, manifest_json, storage_key)
+		VALUES (8101, 1, '{}', 'session-content-key')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versionID, _ := res.LastInsertId()
+	for token, age := range map[string]string{"content-fresh": "-11 hours", "content-stale": "-13 hours"} {
+		_, err := storage.DB.Exec(`
+			INSERT INTO runtime_sessions (token, attempt_id, course_id, version, version_id, state, created_at)
+			VALUES (?, 1, 8101, '2004', ?, 'running', datetime('now', ?))
+		`, token, versionID, age)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if key, err := sessionContent("content-fresh"); err != nil || key != "session-content-key" {
+		t.Errorf("sessionContent(fresh) = %q, %v", key, err)
+	}
+	if _, err := sessionContent("content-stale"); err != errSessionExpired {
+		t.Errorf("sessionContent(stale) error = %v, want errSessionExpired", err)
+	}
+	if _, err := sessionContent("content-unknown"); err != sql.ErrNoRows {
+		t.Errorf("sessionContent(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+}
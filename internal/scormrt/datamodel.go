@@ -0,0 +1,412 @@
+package scormrt
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version identifies the SCORM edition a session runs under.
+type Version string
+
+const (
+	SCORM12   Version = "1.2"
+	SCORM2004 Version = "2004"
+)
+
+// VersionFromSchema maps a manifest <schemaversion> to a run-time Version.
+// SCORM 1.2 packages frequently omit the metadata, so anything that does not
+// name 2004 (or its CAM 1.3 alias) runs as 1.2.
+func VersionFromSchema(schemaVersion string) Version {
+	v := strings.ToLower(schemaVersion)
+	if strings.Contains(v, "2004") || strings.Contains(v, "1.3") {
+		return SCORM2004
+	}
+	return SCORM12
+}
+
+func modelFor(version Version) *dataModel {
+	if version == SCORM12 {
+		return scorm12
+	}
+	return scorm2004
+}
+
+type access int
+
+const (
+	readWrite access = iota
+	readOnly
+	writeOnly
+)
+
+// elementDef describes a single data model element. Text elements accept
+// any string up to maxLength bytes (0 for no limit).
+type elementDef struct {
+	access    access
+	validate  validator
+	text      bool
+	maxLength int
+}
+
+// errorCodes holds the code a data model reports for each kind of failure.
+type errorCodes struct {
+	initFailure         string
+	terminateFailure    string
+	commitFailure       string
+	alreadyInitialized  string
+	instanceTerminated  string
+	terminateBeforeInit string
+	terminateAfterTerm  string
+	getBeforeInit       string
+	getAfterTerm        string
+	setBeforeInit       string
+	setAfterTerm        string
+	commitBeforeInit    string
+	commitAfterTerm     string
+
+	generalGet     string
+	generalSet     string
+	undefined      string
+	notInitialized string
+	readOnly       string
+	writeOnly      string
+	typeMismatch   string
+	outOfRange     string
+	noChildren     string
+	noCount        string
+	keyword        string
+	dependency     string
+}
+
+// elementNames holds the names a data model uses for the elements the LMS
+// itself reads or writes.
+type elementNames struct {
+	entry       string
+	exit        string
+	sessionTime string
+	learnerID   string
+	learnerName string
+	launchData  string
+	mode        string
+	credit      string
+	totalTime   string
+	completion  string
+	success     string
+	scoreRaw    string
+	scoreScaled string
+	scoreMin    string
+	scoreMax    string
+	progress    string
+
+	passingScore        string
+	maxTimeAllowed      string
+	timeLimitAction     string
+	completionThreshold string
+
+	interactionTime     string
+	interactionResponse string
+}
+
+// Interaction elements both data models share.
+const (
+	interactionType = "cmi.interactions.n.type"
+	correctPattern  = "cmi.interactions.n.correct_responses.n.pattern"
+)
+
+// dataModel describes the elements, keywords, initial values and error codes
+// of a SCORM run-time data model. Element names are stored with collection
+// indexes replaced by "n", e.g. cmi.interactions.n.id.
+type dataModel struct {
+	version     Version
+	names       elementNames
+	elements    map[string]elementDef
+	children    map[string]string
+	collections map[string]bool
+	defaults    map[string]string
+	errs        errorCodes
+	messages    map[string]string
+	// requires maps elements of a collection entry to the element of the
+	// same entry that must be set before them.
+	requires map[string]string
+	// responses holds the learner response and correct response pattern
+	// formats of each interaction type.
+	responses map[string]responseFormat
+	// parseTime and formatTime convert the session_time/total_time format
+	// of the version.
+	parseTime  func(string) (time.Duration, bool)
+	formatTime func(time.Duration) string
+	// passingScale is the scale of the passing score element: 1 for
+	// cmi.scaled_passing_score, 100 for cmi.student_data.mastery_score.
+	passingScale float64
+}
+
+var (
+	rw = func(v validator) elementDef { return elementDef{access: readWrite, validate: v} }
+	ro = elementDef{access: readOnly}
+	wo = func(v validator) elementDef { return elementDef{access: writeOnly, validate: v} }
+	// rwText is a read-write text element limited to maxLength bytes.
+	rwText = func(maxLength int) elementDef {
+		v := characterString
+		if maxLength > 0 {
+			v = cmiString(maxLength)
+		}
+		return elementDef{access: readWrite, validate: v, text: true, maxLength: maxLength}
+	}
+)
+
+// normalize replaces collection indexes with "n" and navigation targets with
+// {target}. It returns false for names with empty or malformed segments.
+func normalize(element string) (string, bool) {
+	for _, prefix := range []string{"adl.nav.request_valid.choice.", "adl.nav.request_valid.jump."} {
+		if strings.HasPrefix(element, prefix) {
+			target := strings.TrimPrefix(element, prefix)
+			if !strings.HasPrefix(target, "{target=") || !strings.HasSuffix(target, "}") {
+				return "", false
+			}
+			return prefix + "{target}", true
+		}
+	}
+
+	parts := strings.Split(element, ".")
+	for i, p := range parts {
+		if p == "" || p == "n" {
+			return "", false
+		}
+		if isIndex(p) {
+			parts[i] = "n"
+		}
+	}
+	return strings.Join(parts, "."), true
+}
+
+func isIndex(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	for _, r := range segment {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// known reports whether name (normalized) is an element or a container of
+// elements in the model, e.g. cmi.score or cmi.interactions.
+func (m *dataModel) known(name string) bool {
+	if _, ok := m.elements[name]; ok {
+		return true
+	}
+	if _, ok := m.children[name]; ok {
+		return true
+	}
+	return m.collections[name]
+}
+
+// readable reports whether GetValue may return element.
+func (m *dataModel) readable(element string) bool {
+	name, valid := normalize(element)
+	if !valid {
+		return false
+	}
+	def, ok := m.elements[name]
+	return ok && def.access != writeOnly
+}
+
+// queueable returns the text elements outside collections with their
+// maximum length in bytes (0 for no limit). Setting one of them can only fail
+// on a value over that length, which an adapter can check itself before
+// queueing the call.
+func (m *dataModel) queueable() map[string]int {
+	names := map[string]int{}
+	for name, def := range m.elements {
+		if def.text && !strings.Contains(name, ".n.") {
+			names[name] = def.maxLength
+		}
+	}
+	return names
+}
+
+// get resolves element against the session values and returns the value with
+// the resulting error code.
+func (m *dataModel) get(values map[string]string, element string) (string, string) {
+	if element == "" {
+		return "", m.errs.generalGet
+	}
+
+	if parent, ok := strings.CutSuffix(element, "._children"); ok {
+		name, valid := normalize(parent)
+		if !valid {
+			return "", m.errs.undefined
+		}
+		if children, ok := m.children[name]; ok {
+			return children, errNone
+		}
+		if m.known(name) {
+			return "", m.errs.noChildren
+		}
+		return "", m.errs.undefined
+	}
+
+	if parent, ok := strings.CutSuffix(element, "._count"); ok {
+		name, valid := normalize(parent)
+		if !valid {
+			return "", m.errs.undefined
+		}
+		if m.collections[name] {
+			return strconv.Itoa(count(values, parent)), errNone
+		}
+		if m.known(name) {
+			return "", m.errs.noCount
+		}
+		return "", m.errs.undefined
+	}
+
+	name, valid := normalize(element)
+	if !valid {
+		return "", m.errs.undefined
+	}
+	def, ok := m.elements[name]
+	if !ok {
+		return "", m.errs.undefined
+	}
+	if def.access == writeOnly {
+		return "", m.errs.writeOnly
+	}
+	if !inRange(values, element, false) {
+		return "", m.errs.generalGet
+	}
+	v, ok := values[element]
+	if !ok {
+		return "", m.errs.notInitialized
+	}
+	return v, errNone
+}
+
+// set validates value for element and stores it in the session values,
+// returning the resulting error code.
+func (m *dataModel) set(values map[string]string, element, value string) string {
+	if element == "" {
+		return m.errs.generalSet
+	}
+
+	for _, keyword := range []string{"._children", "._count", "._version"} {
+		if parent, ok := strings.CutSuffix(element, keyword); ok {
+			name, valid := normalize(parent)
+			if valid && (m.known(name) || parent == "cmi") {
+				return m.errs.keyword
+			}
+			return m.errs.undefined
+		}
+	}
+
+	name, valid := normalize(element)
+	if !valid {
+		return m.errs.undefined
+	}
+	def, ok := m.elements[name]
+	if !ok {
+		return m.errs.undefined
+	}
+	if def.access == readOnly {
+		return m.errs.readOnly
+	}
+	if !inRange(values, element, true) {
+		return m.errs.generalSet
+	}
+	if required, ok := m.requires[name]; ok {
+		if _, set := values[resolve(required, element)]; !set {
+			return m.errs.dependency
+		}
+	}
+	if code := m.translate(def.validate(value)); code != errNone {
+		return code
+	}
+	if code := m.checkResponse(values, name, element, value); code != errNone {
+		return code
+	}
+
+	values[element] = value
+	return errNone
+}
+
+// translate maps a validator result to the model's error code.
+func (m *dataModel) translate(code string) string {
+	switch code {
+	case errTypeMismatch:
+		return m.errs.typeMismatch
+	case errValueOutOfRange:
+		return m.errs.outOfRange
+	}
+	return errNone
+}
+
+// checkResponse validates a learner response or correct response pattern
+// against the format of the interaction's type. Values of interactions whose
+// type is not set, or has no known format, are accepted as is.
+func (m *dataModel) checkResponse(values map[string]string, name, element, value string) string {
+	if name != m.names.interactionResponse && name != correctPattern {
+		return errNone
+	}
+	format, ok := m.responses[values[resolve(interactionType, element)]]
+	if !ok {
+		return errNone
+	}
+	if name == correctPattern {
+		return m.translate(format.pattern(value))
+	}
+	return m.translate(format.response(value))
+}
+
+// inRange reports whether every collection index in element refers to an
+// existing entry. When appending, an index equal to the collection's _count
+// is also accepted, so entries can only be added in order.
+func inRange(values map[string]string, element string, appending bool) bool {
+	parts := strings.Split(element, ".")
+	for i, p := range parts {
+		if !isIndex(p) {
+			continue
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || strconv.Itoa(n) != p {
+			return false
+		}
+		c := count(values, strings.Join(parts[:i], "."))
+		if n > c || n == c && !appending {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve fills the "n" segments of a normalized name with the indexes of
+// element, e.g. cmi.interactions.n.id and cmi.interactions.3.type give
+// cmi.interactions.3.id.
+func resolve(name, element string) string {
+	parts := strings.Split(name, ".")
+	indexes := strings.Split(element, ".")
+	for i, p := range parts {
+		if p == "n" && i < len(indexes) {
+			parts[i] = indexes[i]
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// count returns how many entries exist in the collection at prefix, e.g.
+// cmi.interactions or cmi.interactions.0.objectives.
+func count(values map[string]string, prefix string) int {
+	seen := make(map[string]bool)
+	for key := range values {
+		rest, ok := strings.CutPrefix(key, prefix+".")
+		if !ok {
+			continue
+		}
+		index, _, _ := strings.Cut(rest, ".")
+		if isIndex(index) {
+			seen[index] = true
+		}
+	}
+	return len(seen)
+}
@@ -0,0 +1,137 @@
+package scormrt
+
+import (
+	"strings"
+	"testing"
+)
+
+// call is one API call and the result and error code it must produce
+type call struct {
+	method, element, value string
+	result, code           string
+}
+
+func runCalls(t *testing.T, s *RuntimeService, token string, calls []call) {
+	t.Helper()
+	for _, c := range calls {
+		var got string
+		switch c.method {
+		case "GetValue":
+			got = s.GetValue(token, c.element)
+		case "SetValue":
+			got = s.SetValue(token, c.element, c.value)
+		}
+		if code := s.GetLastError(token); got != c.result || code != c.code {
+			t.Errorf("%s(%q, %q) = %q, error %s; want %q, error %s", c.method, c.element, c.value, got, code, c.result, c.code)
+		}
+	}
+}
+
+func TestDataModel2004(t *testing.T) {
+	s := NewService()
+	token := browseSession(t, SCORM2004)
+	if got := s.GetValue(token, "cmi.location"); got != "" || s.GetLastError(token) != "122" {
+		t.Errorf("GetValue before Initialize = %q, error %s, want 122", got, s.GetLastError(token))
+	}
+	if s.Initialize(token) != "true" {
+		t.Fatal("Initialize failed")
+	}
+
+	runCalls(t, s, token, []call{
+		{"GetValue", "cmi.bogus", "", "", "401"},
+		{"GetValue", "", "", "", "301"},
+		{"SetValue", "cmi.learner_id", "x", "false", "404"},
+		{"GetValue", "cmi.exit", "", "", "405"},
+		{"SetValue", "cmi.completion_status", "done", "false", "406"},
+		{"SetValue", "cmi.score.scaled", "1.5", "false", "407"},
+		{"SetValue", "cmi.score.scaled", "0.75", "true", "0"},
+		{"GetValue", "cmi.score.scaled", "", "0.75", "0"},
+		{"SetValue", "cmi.session_time", "PT1H30M", "true", "0"},
+		{"SetValue", "cmi.session_time", "1:30:00", "false", "406"},
+		{"GetValue", "cmi.score._children", "", "scaled,raw,min,max", "0"},
+		{"GetValue", "cmi.location._children", "", "", "301"},
+		{"SetValue", "cmi.interactions._count", "1", "false", "404"},
+		{"GetValue", "cmi.interactions._count", "", "0", "0"},
+	})
+}
+
+func TestCollections2004(t *testing.T) {
+	s := NewService()
+	token := browseSession(t, SCORM2004)
+	s.Initialize(token)
+
+	runCalls(t, s, token, []call{
+		// n must be _count or an existing entry
+		{"SetValue", "cmi.interactions.1.id", "q1", "false", "351"},
+		// the id comes first
+		{"SetValue", "cmi.interactions.0.type", "choice", "false", "408"},
+		{"SetValue", "cmi.interactions.0.id", "q1", "true", "0"},
+		{"GetValue", "cmi.interactions._count", "", "1", "0"},
+		{"SetValue", "cmi.interactions.0.type", "choice", "true", "0"},
+		{"SetValue", "cmi.interactions.0.learner_response", "a[,]b", "true", "0"},
+		{"SetValue", "cmi.interactions.0.learner_response", "a[,]a", "false", "406"},
+		{"SetValue", "cmi.interactions.0.correct_responses.0.pattern", "b[,]a", "true", "0"},
+		{"GetValue", "cmi.interactions.0.correct_responses._count", "", "1", "0"},
+		{"SetValue", "cmi.interactions.1.id", "q2", "true", "0"},
+		{"SetValue", "cmi.interactions.1.type", "numeric", "true", "0"},
+		{"SetValue", "cmi.interactions.1.learner_response", "abc", "false", "406"},
+		{"SetValue", "cmi.interactions.1.learner_response", "3.5", "true", "0"},
+		{"GetValue", "cmi.interactions.5.id", "", "", "301"},
+		{"SetValue", "cmi.objectives.0.success_status", "passed", "false", "408"},
+		{"SetValue", "cmi.objectives.0.id", "obj1", "true", "0"},
+		{"SetValue", "cmi.objectives.0.success_status", "passed", "true", "0"},
+		{"SetValue", "cmi.objectives.0.success_status", "done", "false", "406"},
+	})
+
+	values := s.Snapshot(token)
+	interactions := scorm2004.interactions(values)
+	if len(interactions) != 2 || interactions[0].ID != "q1" || interactions[1].Type != "numeric" {
+		t.Errorf("interactions = %+v", interactions)
+	}
+	if objectives := scorm2004.objectives(values); len(objectives) != 1 || objectives[0].ID != "obj1" {
+		t.Errorf("objectives = %+v", objectives)
+	}
+}
+
+func TestDataModel12(t *testing.T) {
+	s := NewService()
+	token := browseSession(t, SCORM12)
+	if got := s.GetValue(token, "cmi.core.lesson_location"); got != "" || s.GetLastError(token) != "301" {
+		t.Errorf("LMSGetValue before LMSInitialize = %q, error %s, want 301", got, s.GetLastError(token))
+	}
+	if s.Initialize(token) != "true" {
+		t.Fatal("LMSInitialize failed")
+	}
+
+	runCalls(t, s, token, []call{
+		{"GetValue", "cmi.core.bogus", "", "", "201"},
+		{"GetValue", "", "", "", "201"},
+		{"SetValue", "cmi.core.student_id", "x", "false", "403"},
+		{"GetValue", "cmi.core.exit", "", "", "404"},
+		{"SetValue", "cmi.core._children", "x", "false", "402"},
+		{"SetValue", "cmi.core.lesson_status", "suspended", "false", "405"},
+		{"SetValue", "cmi.core.lesson_status", "passed", "true", "0"},
+		{"SetValue", "cmi.core.score.raw", "150", "false", "405"},
+		{"SetValue", "cmi.core.score.raw", "abc", "false", "405"},
+		{"SetValue", "cmi.core.score.raw", "85", "true", "0"},
+		// CMIBlank clears a score
+		{"SetValue", "cmi.core.score.raw", "", "true", "0"},
+		{"GetValue", "cmi.core.score.raw", "", "", "0"},
+		{"SetValue", "cmi.core.score.max", "", "true", "0"},
+		{"SetValue", "cmi.objectives.0.id", "obj1", "true", "0"},
+		{"SetValue", "cmi.objectives.0.score.raw", "", "true", "0"},
+		{"SetValue", "cmi.objectives.0.score.min", "-1", "false", "405"},
+		{"SetValue", "cmi.core.session_time", "0001:30:05.50", "true", "0"},
+		{"SetValue", "cmi.core.session_time", "PT1H", "false", "405"},
+	})
+
+	children := s.GetValue(token, "cmi.core._children")
+	for _, element := range []string{"student_id", "lesson_status", "score", "session_time"} {
+		if !strings.Contains(children, element) {
+			t.Errorf("cmi.core._children = %q lacks %s", children, element)
+		}
+	}
+	if got := s.GetErrorString(token, "405"); got == "Unknown error" {
+		t.Errorf("GetErrorString(405) = %q, want the SCORM 1.2 message", got)
+	}
+}
@@ -0,0 +1,212 @@
+package scormrt
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// validator checks a value against a data model type and returns errNone,
+// errTypeMismatch or errValueOutOfRange.
+type validator func(value string) string
+
+var (
+	realPattern         = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)$`)
+	timeIntervalPattern = regexp.MustCompile(`^P(\d+Y)?(\d+M)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d{1,2})?S)?)?$`)
+	dateTimePattern     = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2}(T\d{2}(:\d{2}(:\d{2}(\.\d{1,2})?(Z|[+-]\d{2}(:\d{2})?)?)?)?)?)?)?$`)
+	languagePattern     = regexp.MustCompile(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`)
+	langDelimiter       = regexp.MustCompile(`^\{lang=([^}]*)\}`)
+	navTargetPattern    = regexp.MustCompile(`^\{target=[^\s{}]+\}(choice|jump)$`)
+)
+
+// characterString accepts any string. The SPM (smallest permitted maximum) of
+// each element is only a floor for the LMS, so longer values are kept as is.
+func characterString(value string) string {
+	return errNone
+}
+
+// localizedString accepts a string optionally prefixed by a {lang=xx} delimiter.
+func localizedString(value string) string {
+	if m := langDelimiter.FindStringSubmatch(value); m != nil {
+		if m[1] != "" && !languagePattern.MatchString(m[1]) {
+			return errTypeMismatch
+		}
+	}
+	return errNone
+}
+
+// longIdentifier accepts a non-empty identifier without whitespace.
+func longIdentifier(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\r\n") {
+		return errTypeMismatch
+	}
+	return errNone
+}
+
+// realRange validates a real(10,7) number bounded by min and max.
+func realRange(min, max float64) validator {
+	return func(value string) string {
+		f, ok := parseReal(value)
+		if !ok {
+			return errTypeMismatch
+		}
+		if f < min || f > max {
+			return errValueOutOfRange
+		}
+		return errNone
+	}
+}
+
+func parseReal(value string) (float64, bool) {
+	if !realPattern.MatchString(value) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// timeInterval validates an ISO 8601 duration such as PT1H30M5.5S.
+func timeInterval(value string) string {
+	if value == "P" || strings.HasSuffix(value, "T") || !timeIntervalPattern.MatchString(value) {
+		return errTypeMismatch
+	}
+	return errNone
+}
+
+// dateTime validates an ISO 8601 timestamp such as 2024-05-01T10:00:00Z.
+func dateTime(value string) string {
+	if !dateTimePattern.MatchString(value) {
+		return errTypeMismatch
+	}
+	return errNone
+}
+
+// language validates a language code, empty meaning "no preference".
+func language(value string) string {
+	if value != "" && !languagePattern.MatchString(value) {
+		return errTypeMismatch
+	}
+	return errNone
+}
+
+// vocabulary accepts only one of the given tokens.
+func vocabulary(tokens ...string) validator {
+	allowed := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		allowed[t] = true
+	}
+	return func(value string) string {
+		if !allowed[value] {
+			return errTypeMismatch
+		}
+		return errNone
+	}
+}
+
+// navRequest validates adl.nav.request, which also accepts {target=ID}choice.
+func navRequest(value string) string {
+	switch value {
+	case "continue", "previous", "exit", "exitAll", "abandon", "abandonAll", "suspendAll", "_none_":
+		return errNone
+	}
+	if navTargetPattern.MatchString(value) {
+		return errNone
+	}
+	return errTypeMismatch
+}
+
+// interactionResult accepts a result token or a real number.
+func interactionResult(value string) string {
+	switch value {
+	case "correct", "incorrect", "unanticipated", "neutral":
+		return errNone
+	}
+	if _, ok := parseReal(value); ok {
+		return errNone
+	}
+	return errTypeMismatch
+}
+
+var (
+	cmiTimespanPattern = regexp.MustCompile(`^\d{2,4}:\d{2}:\d{2}(\.\d{1,2})?$`)
+	cmiTimePattern     = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d{1,2})?$`)
+	cmiIntegerPattern  = regexp.MustCompile(`^[-+]?\d+$`)
+)
+
+// cmiString validates a SCORM 1.2 CMIString255/CMIString4096 value.
+func cmiString(max int) validator {
+	return func(value string) string {
+		if len(value) > max {
+			return errTypeMismatch
+		}
+		return errNone
+	}
+}
+
+// cmiBlank accepts a SCORM 1.2 CMIBlank (the empty string) or any value v
+// accepts.
+func cmiBlank(v validator) validator {
+	return func(value string) string {
+		if value == "" {
+			return errNone
+		}
+		return v(value)
+	}
+}
+
+// cmiIdentifier validates a SCORM 1.2 CMIIdentifier.
+func cmiIdentifier(value string) string {
+	if len(value) > 255 {
+		return errTypeMismatch
+	}
+	return longIdentifier(value)
+}
+
+// cmiInteger validates a SCORM 1.2 CMISInteger bounded by min and max.
+func cmiInteger(min, max int) validator {
+	return func(value string) string {
+		if !cmiIntegerPattern.MatchString(value) {
+			return errTypeMismatch
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errTypeMismatch
+		}
+		if n < min || n > max {
+			return errValueOutOfRange
+		}
+		return errNone
+	}
+}
+
+// cmiTimespan validates a SCORM 1.2 CMITimespan such as 0001:30:05.50.
+func cmiTimespan(value string) string {
+	if !cmiTimespanPattern.MatchString(value) {
+		return errTypeMismatch
+	}
+	return errNone
+}
+
+// cmiTime validates a SCORM 1.2 CMITime such as 14:05:00.
+func cmiTime(value string) string {
+	if !cmiTimePattern.MatchString(value) {
+		return errTypeMismatch
+	}
+	return errNone
+}
+
+// interactionResult12 accepts a SCORM 1.2 result token or a decimal.
+func interactionResult12(value string) string {
+	switch value {
+	case "correct", "wrong", "unanticipated", "neutral":
+		return errNone
+	}
+	if _, ok := parseReal(value); ok {
+		return errNone
+	}
+	return errTypeMismatch
+}
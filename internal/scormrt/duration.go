@@ -0,0 +1,75 @@
+package scormrt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+)
+
+// parseISODuration parses a SCORM 2004 timeinterval such as P1DT2H3M4.5S.
+func parseISODuration(value string) (time.Duration, bool) {
+	if timeInterval(value) != errNone {
+		return 0, false
+	}
+	return scorm.ParseDuration(value)
+}
+
+// formatISODuration formats d as a SCORM 2004 timeinterval with hours,
+// minutes and seconds to hundredths, e.g. PT26H3M4.5S.
+func formatISODuration(d time.Duration) string {
+	h, m, s := splitDuration(d)
+	return "PT" + strconv.Itoa(h) + "H" + strconv.Itoa(m) + "M" + strconv.FormatFloat(s, 'f', -1, 64) + "S"
+}
+
+// parseManifestDuration parses a time limit from the manifest, which SCORM
+// 2004 packages give as an ISO 8601 duration and SCORM 1.2 packages as a
+// CMITimespan.
+func parseManifestDuration(value string) (time.Duration, bool) {
+	if d, ok := parseISODuration(value); ok {
+		return d, true
+	}
+	return parseCMITimespan(value)
+}
+
+// parseCMITimespan parses a SCORM 1.2 CMITimespan such as 0001:30:05.50.
+func parseCMITimespan(value string) (time.Duration, bool) {
+	if cmiTimespan(value) != errNone {
+		return 0, false
+	}
+
+	parts := strings.Split(value, ":")
+	h, _ := strconv.Atoi(parts[0])
+	m, _ := strconv.Atoi(parts[1])
+	s, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s*float64(time.Second)), true
+}
+
+// formatCMITimespan formats d as a SCORM 1.2 CMITimespan. Hours are capped at
+// 9999, the largest value the format can hold.
+func formatCMITimespan(d time.Duration) string {
+	h, m, s := splitDuration(d)
+	if h > 9999 {
+		h, m, s = 9999, 59, 59.99
+	}
+	return fmt.Sprintf("%04d:%02d:%05.2f", h, m, s)
+}
+
+// splitDuration breaks d into whole hours, whole minutes and seconds rounded
+// to hundredths.
+func splitDuration(d time.Duration) (int, int, float64) {
+	if d < 0 {
+		d = 0
+	}
+	cs := int64(math.Round(float64(d) / float64(10*time.Millisecond)))
+	h := cs / 360000
+	m := cs % 360000 / 6000
+	s := float64(cs%6000) / 100
+	return int(h), int(m), s
+}
@@ -0,0 +1,107 @@
+package scormrt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"PT1H30M", 90 * time.Minute, true},
+		{"PT4.5S", 4500 * time.Millisecond, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"P1M", 30 * 24 * time.Hour, true},
+		{"PT0S", 0, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"P1DT", 0, false},
+		{"PT1.234S", 0, false},
+		{"1:30:00", 0, false},
+		{"-PT1H", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseISODuration(tt.value)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseISODuration(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCMITimespan(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"0001:30:05.50", time.Hour + 30*time.Minute + 5500*time.Millisecond, true},
+		{"00:00:10", 10 * time.Second, true},
+		{"9999:59:59.99", 9999*time.Hour + 59*time.Minute + 59990*time.Millisecond, true},
+		{"1:30:00", 0, false},
+		{"00:00:10.123", 0, false},
+		{"PT1H", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseCMITimespan(tt.value)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseCMITimespan(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFormatDurations(t *testing.T) {
+	d := 26*time.Hour + 3*time.Minute + 4500*time.Millisecond
+	if got := formatISODuration(d); got != "PT26H3M4.5S" {
+		t.Errorf("formatISODuration = %q, want PT26H3M4.5S", got)
+	}
+	if got := formatCMITimespan(d); got != "0026:03:04.50" {
+		t.Errorf("formatCMITimespan = %q, want 0026:03:04.50", got)
+	}
+
+	// hundredths are rounded, carrying into minutes
+	if got := formatISODuration(59*time.Second + 996*time.Millisecond); got != "PT0H1M0S" {
+		t.Errorf("formatISODuration(59.996s) = %q, want PT0H1M0S", got)
+	}
+	if got := formatCMITimespan(-time.Second); got != "0000:00:00.00" {
+		t.Errorf("formatCMITimespan(-1s) = %q, want 0000:00:00.00", got)
+	}
+	if got := formatCMITimespan(10000 * time.Hour); got != "9999:59:59.99" {
+		t.Errorf("formatCMITimespan(10000h) = %q, want the cap", got)
+	}
+
+	// what is formatted parses back
+	if back, ok := parseISODuration(formatISODuration(d)); !ok || back != d {
+		t.Errorf("ISO round trip = %v, %v; want %v", back, ok, d)
+	}
+	if back, ok := parseCMITimespan(formatCMITimespan(d)); !ok || back != d {
+		t.Errorf("CMITimespan round trip = %v, %v; want %v", back, ok, d)
+	}
+}
+
+func TestAccumulateTime(t *testing.T) {
+	tests := []struct {
+		model                    *dataModel
+		total, session           string
+		wantTotal, wantFormatted string
+	}{
+		{scorm2004, "PT1H", "PT30M15S", "1h30m15s", "PT1H30M15S"},
+		{scorm2004, "PT0H0M0S", "", "0s", "PT0H0M0S"},
+		{scorm12, "0001:00:00", "0000:30:15.25", "1h30m15.25s", "0001:30:15.25"},
+		{scorm12, "0000:00:00", "bogus", "0s", "0000:00:00"},
+	}
+	for _, tt := range tests {
+		names := tt.model.names
+		sess := &session{model: tt.model, values: map[string]string{
+			names.totalTime:   tt.total,
+			names.sessionTime: tt.session,
+		}}
+		got := sess.accumulateTime()
+		if got.String() != tt.wantTotal || sess.values[names.totalTime] != tt.wantFormatted {
+			t.Errorf("%s: total %s + session %q = %v, %q; want %s, %q", tt.model.version, tt.total, tt.session,
+				got, sess.values[names.totalTime], tt.wantTotal, tt.wantFormatted)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package scormrt
+
+// SCORM 2004 4th Edition run-time error codes.
+const (
+	errNone                 = "0"
+	errGeneral              = "101"
+	errInitFailure          = "102"
+	errAlreadyInitialized   = "103"
+	errInstanceTerminated   = "104"
+	errTerminateFailure     = "111"
+	errTerminateBeforeInit  = "112"
+	errTerminateAfterTerm   = "113"
+	errGetBeforeInit        = "122"
+	errGetAfterTerm         = "123"
+	errSetBeforeInit        = "132"
+	errSetAfterTerm         = "133"
+	errCommitBeforeInit     = "142"
+	errCommitAfterTerm      = "143"
+	errGeneralGet           = "301"
+	errGeneralSet           = "351"
+	errCommitFailure        = "391"
+	errUndefinedElement     = "401"
+	errUnimplementedElement = "402"
+	errValueNotInitialized  = "403"
+	errReadOnly             = "404"
+	errWriteOnly            = "405"
+	errTypeMismatch         = "406"
+	errValueOutOfRange      = "407"
+	errDependency           = "408"
+)
+
+var errorStrings = map[string]string{
+	"0":   "No error",
+	"101": "General exception",
+	"102": "General initialization failure",
+	"103": "Already initialized",
+	"104": "Content instance terminated",
+	"111": "General termination failure",
+	"112": "Termination before initialization",
+	"113": "Termination after termination",
+	"122": "Retrieve data before initialization",
+	"123": "Retrieve data after termination",
+	"132": "Store data before initialization",
+	"133": "Store data after termination",
+	"142": "Commit before initialization",
+	"143": "Commit after termination",
+	"201": "General argument error",
+	"301": "General get failure",
+	"351": "General set failure",
+	"391": "General commit failure",
+	"401": "Undefined data model element",
+	"402": "Unimplemented data model element",
+	"403": "Data model element value not initialized",
+	"404": "Data model element is read only",
+	"405": "Data model element is write only",
+	"406": "Data model element type mismatch",
+	"407": "Data model element value out of range",
+	"408": "Data model dependency not established",
+}
+
+// SCORM 1.2 run-time error codes.
+const (
+	err12InvalidArgument = "201"
+	err12NoChildren      = "202"
+	err12NoCount         = "203"
+	err12NotInitialized  = "301"
+	err12NotImplemented  = "401"
+	err12Keyword         = "402"
+	err12ReadOnly        = "403"
+	err12WriteOnly       = "404"
+	err12IncorrectType   = "405"
+)
+
+var errorStrings12 = map[string]string{
+	"0":   "No error",
+	"101": "General exception",
+	"201": "Invalid argument error",
+	"202": "Element cannot have children",
+	"203": "Element not an array - cannot have count",
+	"301": "Not initialized",
+	"401": "Not implemented error",
+	"402": "Invalid set value, element is a keyword",
+	"403": "Element is read only",
+	"404": "Element is write only",
+	"405": "Incorrect data type",
+}
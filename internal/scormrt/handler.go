@@ -14,8 +14,36 @@ type RuntimeRequest struct {
 	Value   string `json:"value,omitempty"`
 }
 
+// scorm12Methods maps the SCORM 1.2 API names to their 2004 equivalents.
+var scorm12Methods = map[string]string{
+	"LMSInitialize":     "Initialize",
+	"LMSFinish":         "Terminate",
+	"LMSGetValue":       "GetValue",
+	"LMSSetValue":       "SetValue",
+	"LMSCommit":         "Commit",
+	"LMSGetLastError":   "GetLastError",
+	"LMSGetErrorString": "GetErrorString",
+	"LMSGetDiagnostic":  "GetDiagnostic",
+}
+
+// RuntimeResult is the outcome of a single runtime call: the value returned
+// by the API method and the session's error code after the call. Successful
+// Initialize and Commit calls also carry a snapshot of every readable CMI
+// value so an adapter can answer GetValue locally, and Initialize the
+// text elements it may queue SetValue calls for, with their maximum length. Terminate
+// calls of SCOs that set adl.nav.request carry what the player should load
+// next.
+type RuntimeResult struct {
+	Result     string            `json:"result"`
+	ErrorCode  string            `json:"errorCode"`
+	Snapshot   map[string]string `json:"snapshot,omitempty"`
+	Queueable  map[string]int    `json:"queueable,omitempty"`
+	Navigation *Navigation       `json:"navigation,omitempty"`
+}
+
 // RuntimeHandler dispatches runtime API calls. The external LMS can POST a JSON
-// payload describing the method to invoke.
+// payload describing the method to invoke, using either the SCORM 2004 or the
+// SCORM 1.2 method names. The session must be a token minted by LaunchHandler.
 func RuntimeHandler(c *gin.Context) {
 	var req RuntimeRequest
 	if err := c.BindJSON(&req); err != nil {
@@ -23,28 +51,100 @@ func RuntimeHandler(c *gin.Context) {
 		return
 	}
 
-	var result interface{}
-	switch req.Method {
+	if !Exists(req.Session) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown session"})
+		return
+	}
+
+	res, ok := dispatch(req)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown method"})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// BatchHandler runs an ordered list of runtime calls and returns one result
+// per call. Adapters use it to flush queued SetValue calls together with the
+// Commit or Terminate that follows them. The batch is rejected as a whole if
+// any call names an unknown session or method.
+func BatchHandler(c *gin.Context) {
+	var reqs []RuntimeRequest
+	if err := c.BindJSON(&reqs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	for _, req := range reqs {
+		if !Exists(req.Session) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown session"})
+			return
+		}
+		if _, ok := apiMethod(req.Method); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown method"})
+			return
+		}
+	}
+
+	results := make([]RuntimeResult, 0, len(reqs))
+	for _, req := range reqs {
+		res, _ := dispatch(req)
+		results = append(results, res)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// apiMethod returns the SCORM 2004 name of a runtime method.
+func apiMethod(name string) (string, bool) {
+	if m, ok := scorm12Methods[name]; ok {
+		return m, true
+	}
+	switch name {
+	case "Initialize", "Terminate", "GetValue", "SetValue", "Commit",
+		"GetLastError", "GetErrorString", "GetDiagnostic":
+		return name, true
+	}
+	return "", false
+}
+
+// dispatch invokes a runtime method on the default service.
+func dispatch(req RuntimeRequest) (RuntimeResult, bool) {
+	method, ok := apiMethod(req.Method)
+	if !ok {
+		return RuntimeResult{}, false
+	}
+
+	var res RuntimeResult
+	switch method {
 	case "Initialize":
-		result = Initialize(req.Session)
+		res.Result = Initialize(req.Session)
+		if res.Result == "true" {
+			res.Snapshot = Snapshot(req.Session)
+			res.Queueable = Queueable(req.Session)
+		}
 	case "Terminate":
-		result = Terminate(req.Session)
+		res.Result = Terminate(req.Session)
+		if res.Result == "true" {
+			res.Navigation = Navigated(req.Session)
+		}
 	case "GetValue":
-		result = GetValue(req.Session, req.Element)
+		res.Result = GetValue(req.Session, req.Element)
 	case "SetValue":
-		result = SetValue(req.Session, req.Element, req.Value)
+		res.Result = SetValue(req.Session, req.Element, req.Value)
 	case "Commit":
-		result = Commit(req.Session)
+		res.Result = Commit(req.Session)
+		if res.Result == "true" {
+			res.Snapshot = Snapshot(req.Session)
+		}
 	case "GetLastError":
-		result = GetLastError(req.Session)
+		res.Result = GetLastError(req.Session)
 	case "GetErrorString":
-		result = GetErrorString(req.Value)
+		res.Result = GetErrorString(req.Session, req.Value)
 	case "GetDiagnostic":
-		result = GetDiagnostic(req.Value)
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown method"})
-		return
+		res.Result = GetDiagnostic(req.Session, req.Value)
 	}
-
-	c.JSON(http.StatusOK, gin.H{"result": result})
+	res.ErrorCode = GetLastError(req.Session)
+	return res, true
 }
@@ -0,0 +1,70 @@
+package scormrt
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// browseSession mints a browse launch, which keeps no attempt, and returns
+// its token.
+func browseSession(t *testing.T, version Version) string {
+	t.Helper()
+	l := Launch{Token: uuid.New().String(), UserID: 1, CourseID: 1, ScoID: "sco", Version: version, Mode: modeBrowse, Credit: "no-credit"}
+	if err := insertLaunch(storage.DB, l); err != nil {
+		t.Fatal(err)
+	}
+	return l.Token
+}
+
+func TestInitializeListsQueueableElements(t *testing.T) {
+	token := browseSession(t, SCORM2004)
+	res, _ := dispatch(RuntimeRequest{Session: token, Method: "Initialize"})
+	if res.Result != "true" {
+		t.Fatalf("Initialize = %+v", res)
+	}
+
+	if _, ok := res.Snapshot["cmi.learner_id"]; !ok {
+		t.Error("Initialize snapshot lacks cmi.learner_id")
+	}
+	for _, element := range []string{"cmi.location", "cmi.suspend_data"} {
+		if max, ok := res.Queueable[element]; !ok || max != 0 {
+			t.Errorf("queueable elements: %s = %d, %v; want no length limit", element, max, ok)
+		}
+	}
+	// typed elements are validated by the server, so they are never queued
+	for _, element := range []string{"cmi.score.scaled", "cmi.completion_status", "cmi.exit", "cmi.session_time",
+		"adl.nav.request", "cmi.learner_id", "cmi.total_time", "cmi.interactions.n.id"} {
+		if _, ok := res.Queueable[element]; ok {
+			t.Errorf("queueable elements list %s", element)
+		}
+	}
+
+	token = browseSession(t, SCORM12)
+	res, _ = dispatch(RuntimeRequest{Session: token, Method: "LMSInitialize"})
+	if max := res.Queueable["cmi.core.lesson_location"]; max != 255 {
+		t.Errorf("cmi.core.lesson_location limit = %d, want 255", max)
+	}
+}
+
+func TestCommitReturnsSnapshot(t *testing.T) {
+	token := browseSession(t, SCORM12)
+	if res, _ := dispatch(RuntimeRequest{Session: token, Method: "LMSInitialize"}); res.Result != "true" {
+		t.Fatalf("LMSInitialize = %+v", res)
+	}
+	if res, _ := dispatch(RuntimeRequest{Session: token, Method: "LMSSetValue", Element: "cmi.core.lesson_location", Value: "page-3"}); res.Result != "true" {
+		t.Fatalf("LMSSetValue = %+v", res)
+	}
+
+	res, _ := dispatch(RuntimeRequest{Session: token, Method: "LMSCommit"})
+	if res.Result != "true" || res.Snapshot["cmi.core.lesson_location"] != "page-3" {
+		t.Errorf("LMSCommit = %+v, want the committed values in the snapshot", res)
+	}
+
+	// a read-only element is refused by the server, never queued
+	res, _ = dispatch(RuntimeRequest{Session: token, Method: "LMSSetValue", Element: "cmi.core.student_id", Value: "x"})
+	if res.Result != "false" || res.ErrorCode != "403" {
+		t.Errorf("LMSSetValue(cmi.core.student_id) = %+v, want 403", res)
+	}
+}
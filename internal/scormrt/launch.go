@@ -0,0 +1,286 @@
+package scormrt
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+	"github.com/guilherme-gatti/poc_scorm/internal/sequencing"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// LaunchRequest is the body of POST /courses/:id/launch. Item is the
+// identifier of the manifest item to launch; when empty the first SCO of the
+// default organization is used. Mode is normal (the default), browse or
+// review; browse and review launches run without credit and leave the
+// learner's attempts and progress untouched.
+type LaunchRequest struct {
+	UserID   int    `json:"userId"`
+	UserName string `json:"userName"`
+	Item     string `json:"item"`
+	Mode     string `json:"mode"`
+}
+
+var (
+	errItemNotFound = errors.New("item not found")
+	errAttemptLimit = errors.New("attempt limit reached")
+	errNoAttempt    = errors.New("no attempt to review")
+)
+
+// LaunchHandler registers the learner in the course, opens (or resumes) the
+// attempt for the requested SCO and mints the session token the runtime API
+// expects. The response carries both the raw content URL and the player page
+// that provides the SCORM API to it. Normal launches of the same learner in
+// a course run one at a time.
+func LaunchHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid course id"})
+		return
+	}
+
+	var req LaunchRequest
+	if err := c.BindJSON(&req); err != nil || req.UserID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	switch req.Mode {
+	case "", modeNormal, modeBrowse, modeReview:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be normal, browse or review"})
+		return
+	}
+	if req.Mode == "" || req.Mode == modeNormal {
+		// the registration may migrate and the sequencing state changes
+		defer lockRegistration(req.UserID, courseID)()
+	}
+
+	version, err := launchVersion(courseID, req)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "course not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("scormrt: erro ao carregar versão do curso %d: %v", courseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid stored manifest"})
+		return
+	}
+
+	item, href, err := resolveSco(version.Manifest, req.Item)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	l, err := launch(courseID, req, version, item)
+	if err == errAttemptLimit || err == errNoAttempt || isSequencingError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("scormrt: erro ao lançar item %s do curso %d: %v", item.Identifier, courseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not launch"})
+		return
+	}
+
+	c.JSON(http.StatusOK, launchResponse(l, version.Number, href, item))
+}
+
+// launchResponse describes a launch to the client.
+func launchResponse(l Launch, courseVersion int, href string, item scorm.Item) gin.H {
+	return gin.H{
+		"session":   l.Token,
+		"url":       contentURL(l.Token, href, item.Parameters),
+		"player":    "/player/" + l.Token,
+		"version":   l.Version,
+		"item":      item.Identifier,
+		"attemptId": l.AttemptID,
+		"resumed":   l.Resumed,
+		// number of the course version the learner runs in
+		"courseVersion": courseVersion,
+	}
+}
+
+// launchVersion picks the course version a launch runs in. Normal and
+// review launches use the version of the learner's registration; before a
+// normal launch the course's migration policy may move the registration to
+// the current version. Browse launches and learners not registered yet get
+// the current version. It returns sql.ErrNoRows for unknown courses.
+func launchVersion(courseID int, req LaunchRequest) (scorm.CourseVersion, error) {
+	if req.Mode == modeBrowse {
+		return scorm.CurrentVersion(courseID)
+	}
+
+	var registrationID int64
+	err := storage.DB.QueryRow(`
+		SELECT id FROM registrations WHERE user_id = ? AND course_id = ?
+	`, req.UserID, courseID).Scan(&registrationID)
+	if err == sql.ErrNoRows {
+		return scorm.CurrentVersion(courseID)
+	}
+	if err != nil {
+		return scorm.CourseVersion{}, err
+	}
+	return scorm.RegistrationVersion(registrationID, req.Mode != modeReview)
+}
+
+// versionManifest loads the manifest of the course version a session runs
+// in.
+func versionManifest(versionID int64) (scorm.Manifest, error) {
+	version, err := scorm.LoadVersion(versionID)
+	return version.Manifest, err
+}
+
+// launch creates the registration, attempt and session token for a SCO of a
+// course version, carrying the item's manifest settings into the session.
+// Courses imported before the settings were stored fall back to the item in
+// the manifest. Browse launches get no attempt and review launches show the
+// learner's latest attempt on the SCO without changing it. Callers of a
+// normal launch must hold the registration lock of the learner.
+func launch(courseID int, req LaunchRequest, version scorm.CourseVersion, item scorm.Item) (Launch, error) {
+	manifest := version.Manifest
+	settings, err := scorm.LoadItemSettings(version.ID, item.Identifier)
+	if err == sql.ErrNoRows {
+		settings = scorm.SettingsFor(manifest, item)
+	} else if err != nil {
+		return Launch{}, err
+	}
+	maxTime, _ := parseManifestDuration(settings.MaxTimeAllowed)
+
+	l := Launch{
+		Token:               uuid.New().String(),
+		UserID:              req.UserID,
+		CourseID:            courseID,
+		VersionID:           version.ID,
+		ScoID:               item.Identifier,
+		Version:             VersionFromSchema(manifest.Metadata.SchemaVersion),
+		LearnerName:         req.UserName,
+		LaunchData:          settings.DataFromLMS,
+		Mode:                modeNormal,
+		Credit:              "credit",
+		PassingScore:        settings.PassingScore,
+		MaxTimeAllowed:      maxTime,
+		TimeLimitAction:     settings.TimeLimitAction,
+		CompletionThreshold: settings.CompletionThreshold,
+	}
+
+	switch req.Mode {
+	case modeBrowse, modeReview:
+		l.Mode, l.Credit = req.Mode, "no-credit"
+		if req.Mode == modeReview {
+			l.AttemptID, err = lastAttempt(req.UserID, courseID, item.Identifier)
+			if err == sql.ErrNoRows {
+				return Launch{}, errNoAttempt
+			}
+			if err != nil {
+				return Launch{}, err
+			}
+		}
+		return l, insertLaunch(storage.DB, l)
+	}
+
+	l.RegistrationID, err = ensureRegistration(req.UserID, courseID, version.ID)
+	if err != nil {
+		return Launch{}, err
+	}
+	var engine *sequencing.Engine
+	if l.Version == SCORM2004 {
+		engine, err = deliverSequencing(manifest, l.RegistrationID, item.Identifier, req.Item != "")
+		if err != nil {
+			return Launch{}, err
+		}
+	}
+	limit := settings.AttemptLimit
+	if limit == 0 {
+		if limit, err = scorm.CourseAttemptLimit(courseID); err != nil {
+			return Launch{}, err
+		}
+	}
+	if err := startAttempt(&l, limit); err != nil {
+		return Launch{}, err
+	}
+
+	if engine != nil {
+		if err := sequencing.SaveState(l.RegistrationID, engine.State()); err != nil {
+			return Launch{}, err
+		}
+	}
+	return l, nil
+}
+
+// resolveSco finds the item to launch and the href of the resource it
+// references.
+func resolveSco(manifest scorm.Manifest, identifier string) (scorm.Item, string, error) {
+	org, ok := manifest.DefaultOrganization()
+	if !ok {
+		return scorm.Item{}, "", errItemNotFound
+	}
+
+	var item scorm.Item
+	if identifier == "" {
+		item, ok = firstSco(org.Items)
+	} else {
+		item, ok = findItem(org.Items, identifier)
+	}
+	if !ok || item.IdentifierRef == "" {
+		return scorm.Item{}, "", errItemNotFound
+	}
+
+	for _, res := range manifest.Resources.Resource {
+		if res.Identifier == item.IdentifierRef && res.Href != "" {
+			return item, res.Href, nil
+		}
+	}
+	return scorm.Item{}, "", errItemNotFound
+}
+
+func findItem(items []scorm.Item, identifier string) (scorm.Item, bool) {
+	for _, item := range items {
+		if item.Identifier == identifier {
+			return item, true
+		}
+		if found, ok := findItem(item.Items, identifier); ok {
+			return found, true
+		}
+	}
+	return scorm.Item{}, false
+}
+
+func firstSco(items []scorm.Item) (scorm.Item, bool) {
+	for _, item := range items {
+		if item.IdentifierRef != "" {
+			return item, true
+		}
+		if found, ok := firstSco(item.Items); ok {
+			return found, true
+		}
+	}
+	return scorm.Item{}, false
+}
+
+// contentURL builds the URL a launch session loads a resource of the course
+// package from, appending the item's parameters.
+func contentURL(token, href, parameters string) string {
+	url := "/content/" + token + "/" + strings.TrimPrefix(href, "/")
+
+	switch {
+	case parameters == "":
+	case strings.HasPrefix(parameters, "?") || strings.HasPrefix(parameters, "#"):
+		if strings.Contains(url, "?") && strings.HasPrefix(parameters, "?") {
+			url += "&" + parameters[1:]
+		} else {
+			url += parameters
+		}
+	case strings.Contains(url, "?"):
+		url += "&" + parameters
+	default:
+		url += "?" + parameters
+	}
+	return url
+}
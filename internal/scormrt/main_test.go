@@ -0,0 +1,26 @@
+package scormrt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// TestMain runs the tests against a fresh database. InitDB reads the schema
+// relative to the repository root.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "scormrt-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	storage.InitDB(filepath.Join(dir, "test.db"))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
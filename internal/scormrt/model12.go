@@ -0,0 +1,155 @@
+package scormrt
+
+var (
+	lessonStatus = vocabulary("passed", "completed", "failed", "incomplete", "browsed", "not attempted")
+	score12      = cmiBlank(realRange(0, 100))
+	decimal12    = realRange(-1e10, 1e10)
+)
+
+// scorm12 is the SCORM 1.2 cmi data model.
+var scorm12 = &dataModel{
+	version: SCORM12,
+	names: elementNames{
+		entry:       "cmi.core.entry",
+		exit:        "cmi.core.exit",
+		sessionTime: "cmi.core.session_time",
+		learnerID:   "cmi.core.student_id",
+		learnerName: "cmi.core.student_name",
+		launchData:  "cmi.launch_data",
+		mode:        "cmi.core.lesson_mode",
+		credit:      "cmi.core.credit",
+		totalTime:   "cmi.core.total_time",
+		completion:  "cmi.core.lesson_status",
+		scoreRaw:    "cmi.core.score.raw",
+		scoreMin:    "cmi.core.score.min",
+		scoreMax:    "cmi.core.score.max",
+
+		passingScore:    "cmi.student_data.mastery_score",
+		maxTimeAllowed:  "cmi.student_data.max_time_allowed",
+		timeLimitAction: "cmi.student_data.time_limit_action",
+
+		interactionTime:     "cmi.interactions.n.time",
+		interactionResponse: "cmi.interactions.n.student_response",
+	},
+	elements: map[string]elementDef{
+		"cmi._version": ro,
+
+		"cmi.core.student_id":      ro,
+		"cmi.core.student_name":    ro,
+		"cmi.core.lesson_location": rwText(255),
+		"cmi.core.credit":          ro,
+		"cmi.core.lesson_status":   rw(lessonStatus),
+		"cmi.core.entry":           ro,
+		"cmi.core.score.raw":       rw(score12),
+		"cmi.core.score.min":       rw(score12),
+		"cmi.core.score.max":       rw(score12),
+		"cmi.core.total_time":      ro,
+		"cmi.core.lesson_mode":     ro,
+		"cmi.core.exit":            wo(vocabulary("time-out", "suspend", "logout", "")),
+		"cmi.core.session_time":    wo(cmiTimespan),
+
+		"cmi.suspend_data":      rwText(4096),
+		"cmi.launch_data":       ro,
+		"cmi.comments":          rwText(4096),
+		"cmi.comments_from_lms": ro,
+
+		"cmi.objectives.n.id":        rw(cmiIdentifier),
+		"cmi.objectives.n.score.raw": rw(score12),
+		"cmi.objectives.n.score.min": rw(score12),
+		"cmi.objectives.n.score.max": rw(score12),
+		"cmi.objectives.n.status":    rw(lessonStatus),
+
+		"cmi.student_data.mastery_score":     ro,
+		"cmi.student_data.max_time_allowed":  ro,
+		"cmi.student_data.time_limit_action": ro,
+
+		"cmi.student_preference.audio":    rw(cmiInteger(-1, 100)),
+		"cmi.student_preference.language": rwText(255),
+		"cmi.student_preference.speed":    rw(cmiInteger(-100, 100)),
+		"cmi.student_preference.text":     rw(cmiInteger(-1, 1)),
+
+		"cmi.interactions.n.id":                          wo(cmiIdentifier),
+		"cmi.interactions.n.objectives.n.id":             wo(cmiIdentifier),
+		"cmi.interactions.n.time":                        wo(cmiTime),
+		"cmi.interactions.n.type":                        wo(vocabulary("true-false", "choice", "fill-in", "matching", "performance", "sequencing", "likert", "numeric")),
+		"cmi.interactions.n.correct_responses.n.pattern": wo(cmiString(255)),
+		"cmi.interactions.n.weighting":                   wo(decimal12),
+		"cmi.interactions.n.student_response":            wo(cmiString(255)),
+		"cmi.interactions.n.result":                      wo(interactionResult12),
+		"cmi.interactions.n.latency":                     wo(cmiTimespan),
+	},
+	children: map[string]string{
+		"cmi.core":               "student_id,student_name,lesson_location,credit,lesson_status,entry,score,total_time,lesson_mode,exit,session_time",
+		"cmi.core.score":         "raw,min,max",
+		"cmi.objectives":         "id,score,status",
+		"cmi.objectives.n.score": "raw,min,max",
+		"cmi.student_data":       "mastery_score,max_time_allowed,time_limit_action",
+		"cmi.student_preference": "audio,language,speed,text",
+		"cmi.interactions":       "id,objectives,time,type,correct_responses,weighting,student_response,result,latency",
+	},
+	collections: map[string]bool{
+		"cmi.objectives":                       true,
+		"cmi.interactions":                     true,
+		"cmi.interactions.n.objectives":        true,
+		"cmi.interactions.n.correct_responses": true,
+	},
+	defaults: map[string]string{
+		"cmi._version":                       "3.4",
+		"cmi.core.student_id":                "",
+		"cmi.core.student_name":              "",
+		"cmi.core.lesson_location":           "",
+		"cmi.core.credit":                    "credit",
+		"cmi.core.lesson_status":             "not attempted",
+		"cmi.core.entry":                     "ab-initio",
+		"cmi.core.score.raw":                 "",
+		"cmi.core.score.min":                 "",
+		"cmi.core.score.max":                 "",
+		"cmi.core.total_time":                "0000:00:00.00",
+		"cmi.core.lesson_mode":               "normal",
+		"cmi.suspend_data":                   "",
+		"cmi.launch_data":                    "",
+		"cmi.comments":                       "",
+		"cmi.comments_from_lms":              "",
+		"cmi.student_data.mastery_score":     "",
+		"cmi.student_data.max_time_allowed":  "",
+		"cmi.student_data.time_limit_action": "",
+		"cmi.student_preference.audio":       "0",
+		"cmi.student_preference.language":    "",
+		"cmi.student_preference.speed":       "0",
+		"cmi.student_preference.text":        "0",
+	},
+	errs: errorCodes{
+		initFailure:         errGeneral,
+		terminateFailure:    errGeneral,
+		commitFailure:       errGeneral,
+		alreadyInitialized:  errGeneral,
+		instanceTerminated:  errGeneral,
+		terminateBeforeInit: err12NotInitialized,
+		terminateAfterTerm:  errGeneral,
+		getBeforeInit:       err12NotInitialized,
+		getAfterTerm:        errGeneral,
+		setBeforeInit:       err12NotInitialized,
+		setAfterTerm:        errGeneral,
+		commitBeforeInit:    err12NotInitialized,
+		commitAfterTerm:     errGeneral,
+
+		generalGet:     err12InvalidArgument,
+		generalSet:     err12InvalidArgument,
+		undefined:      err12InvalidArgument,
+		notInitialized: errNone,
+		readOnly:       err12ReadOnly,
+		writeOnly:      err12WriteOnly,
+		typeMismatch:   err12IncorrectType,
+		outOfRange:     err12IncorrectType,
+		noChildren:     err12NoChildren,
+		noCount:        err12NoCount,
+		keyword:        err12Keyword,
+		dependency:     err12InvalidArgument,
+	},
+	messages:   errorStrings12,
+	responses:  responses12,
+	parseTime:  parseCMITimespan,
+	formatTime: formatCMITimespan,
+
+	passingScale: 100,
+}
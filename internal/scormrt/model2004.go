@@ -0,0 +1,191 @@
+package scormrt
+
+var (
+	completionStatus = vocabulary("completed", "incomplete", "not attempted", "unknown")
+	successStatus    = vocabulary("passed", "failed", "unknown")
+	scaledScore      = realRange(-1, 1)
+	anyReal          = realRange(-1e10, 1e10)
+	nonNegativeReal  = realRange(0, 1e10)
+	unitReal         = realRange(0, 1)
+)
+
+// scorm2004 is the SCORM 2004 4th Edition cmi data model.
+var scorm2004 = &dataModel{
+	version: SCORM2004,
+	names: elementNames{
+		entry:       "cmi.entry",
+		exit:        "cmi.exit",
+		sessionTime: "cmi.session_time",
+		learnerID:   "cmi.learner_id",
+		learnerName: "cmi.learner_name",
+		launchData:  "cmi.launch_data",
+		mode:        "cmi.mode",
+		credit:      "cmi.credit",
+		totalTime:   "cmi.total_time",
+		completion:  "cmi.completion_status",
+		success:     "cmi.success_status",
+		scoreRaw:    "cmi.score.raw",
+		scoreScaled: "cmi.score.scaled",
+		scoreMin:    "cmi.score.min",
+		scoreMax:    "cmi.score.max",
+		progress:    "cmi.progress_measure",
+
+		passingScore:        "cmi.scaled_passing_score",
+		maxTimeAllowed:      "cmi.max_time_allowed",
+		timeLimitAction:     "cmi.time_limit_action",
+		completionThreshold: "cmi.completion_threshold",
+
+		interactionTime:     "cmi.interactions.n.timestamp",
+		interactionResponse: "cmi.interactions.n.learner_response",
+	},
+	elements: map[string]elementDef{
+		"cmi._version": ro,
+
+		"cmi.comments_from_learner.n.comment":   rw(localizedString),
+		"cmi.comments_from_learner.n.location":  rw(characterString),
+		"cmi.comments_from_learner.n.timestamp": rw(dateTime),
+		"cmi.comments_from_lms.n.comment":       ro,
+		"cmi.comments_from_lms.n.location":      ro,
+		"cmi.comments_from_lms.n.timestamp":     ro,
+
+		"cmi.completion_status":    rw(completionStatus),
+		"cmi.completion_threshold": ro,
+		"cmi.credit":               ro,
+		"cmi.entry":                ro,
+		"cmi.exit":                 wo(vocabulary("time-out", "suspend", "logout", "normal", "")),
+
+		"cmi.interactions.n.id":                          rw(longIdentifier),
+		"cmi.interactions.n.type":                        rw(vocabulary("true-false", "choice", "fill-in", "long-fill-in", "likert", "matching", "performance", "sequencing", "numeric", "other")),
+		"cmi.interactions.n.objectives.n.id":             rw(longIdentifier),
+		"cmi.interactions.n.timestamp":                   rw(dateTime),
+		"cmi.interactions.n.correct_responses.n.pattern": rw(characterString),
+		"cmi.interactions.n.weighting":                   rw(anyReal),
+		"cmi.interactions.n.learner_response":            rw(characterString),
+		"cmi.interactions.n.result":                      rw(interactionResult),
+		"cmi.interactions.n.latency":                     rw(timeInterval),
+		"cmi.interactions.n.description":                 rw(localizedString),
+
+		"cmi.launch_data":  ro,
+		"cmi.learner_id":   ro,
+		"cmi.learner_name": ro,
+
+		"cmi.learner_preference.audio_level":      rw(nonNegativeReal),
+		"cmi.learner_preference.language":         rw(language),
+		"cmi.learner_preference.delivery_speed":   rw(nonNegativeReal),
+		"cmi.learner_preference.audio_captioning": rw(vocabulary("-1", "0", "1")),
+		"cmi.location":                          rwText(0),
+		"cmi.max_time_allowed":                  ro,
+		"cmi.mode":                              ro,
+		"cmi.objectives.n.id":                   rw(longIdentifier),
+		"cmi.objectives.n.score.scaled":         rw(scaledScore),
+		"cmi.objectives.n.score.raw":            rw(anyReal),
+		"cmi.objectives.n.score.min":            rw(anyReal),
+		"cmi.objectives.n.score.max":            rw(anyReal),
+		"cmi.objectives.n.success_status":       rw(successStatus),
+		"cmi.objectives.n.completion_status":    rw(completionStatus),
+		"cmi.objectives.n.progress_measure":     rw(unitReal),
+		"cmi.objectives.n.description":          rw(localizedString),
+		"cmi.progress_measure":                  rw(unitReal),
+		"cmi.scaled_passing_score":              ro,
+		"cmi.score.scaled":                      rw(scaledScore),
+		"cmi.score.raw":                         rw(anyReal),
+		"cmi.score.min":                         rw(anyReal),
+		"cmi.score.max":                         rw(anyReal),
+		"cmi.session_time":                      wo(timeInterval),
+		"cmi.success_status":                    rw(successStatus),
+		"cmi.suspend_data":                      rwText(0),
+		"cmi.time_limit_action":                 ro,
+		"cmi.total_time":                        ro,
+		"adl.nav.request":                       rw(navRequest),
+		"adl.nav.request_valid.continue":        ro,
+		"adl.nav.request_valid.previous":        ro,
+		"adl.nav.request_valid.choice.{target}": ro,
+		"adl.nav.request_valid.jump.{target}":   ro,
+	},
+	children: map[string]string{
+		"cmi.comments_from_learner": "comment,location,timestamp",
+		"cmi.comments_from_lms":     "comment,location,timestamp",
+		"cmi.interactions":          "id,type,objectives,timestamp,correct_responses,weighting,learner_response,result,latency,description",
+		"cmi.learner_preference":    "audio_level,language,delivery_speed,audio_captioning",
+		"cmi.objectives":            "id,score,success_status,completion_status,progress_measure,description",
+		"cmi.objectives.n.score":    "scaled,raw,min,max",
+		"cmi.score":                 "scaled,raw,min,max",
+	},
+	collections: map[string]bool{
+		"cmi.comments_from_learner":            true,
+		"cmi.comments_from_lms":                true,
+		"cmi.interactions":                     true,
+		"cmi.interactions.n.objectives":        true,
+		"cmi.interactions.n.correct_responses": true,
+		"cmi.objectives":                       true,
+	},
+	defaults: map[string]string{
+		"cmi._version":                            "1.0",
+		"cmi.completion_status":                   "unknown",
+		"cmi.success_status":                      "unknown",
+		"cmi.credit":                              "credit",
+		"cmi.entry":                               "ab-initio",
+		"cmi.mode":                                "normal",
+		"cmi.launch_data":                         "",
+		"cmi.total_time":                          "PT0H0M0S",
+		"cmi.time_limit_action":                   "continue,no message",
+		"cmi.learner_preference.audio_level":      "1",
+		"cmi.learner_preference.language":         "",
+		"cmi.learner_preference.delivery_speed":   "1",
+		"cmi.learner_preference.audio_captioning": "0",
+		"adl.nav.request":                         "_none_",
+	},
+	errs: errorCodes{
+		initFailure:         errInitFailure,
+		terminateFailure:    errTerminateFailure,
+		commitFailure:       errCommitFailure,
+		alreadyInitialized:  errAlreadyInitialized,
+		instanceTerminated:  errInstanceTerminated,
+		terminateBeforeInit: errTerminateBeforeInit,
+		terminateAfterTerm:  errTerminateAfterTerm,
+		getBeforeInit:       errGetBeforeInit,
+		getAfterTerm:        errGetAfterTerm,
+		setBeforeInit:       errSetBeforeInit,
+		setAfterTerm:        errSetAfterTerm,
+		commitBeforeInit:    errCommitBeforeInit,
+		commitAfterTerm:     errCommitAfterTerm,
+
+		generalGet:     errGeneralGet,
+		generalSet:     errGeneralSet,
+		undefined:      errUndefinedElement,
+		notInitialized: errValueNotInitialized,
+		readOnly:       errReadOnly,
+		writeOnly:      errWriteOnly,
+		typeMismatch:   errTypeMismatch,
+		outOfRange:     errValueOutOfRange,
+		noChildren:     errGeneralGet,
+		noCount:        errGeneralGet,
+		keyword:        errReadOnly,
+		dependency:     errDependency,
+	},
+	messages: errorStrings,
+	requires: map[string]string{
+		"cmi.interactions.n.type":                        "cmi.interactions.n.id",
+		"cmi.interactions.n.objectives.n.id":             "cmi.interactions.n.id",
+		"cmi.interactions.n.timestamp":                   "cmi.interactions.n.id",
+		"cmi.interactions.n.correct_responses.n.pattern": "cmi.interactions.n.type",
+		"cmi.interactions.n.weighting":                   "cmi.interactions.n.id",
+		"cmi.interactions.n.learner_response":            "cmi.interactions.n.type",
+		"cmi.interactions.n.result":                      "cmi.interactions.n.id",
+		"cmi.interactions.n.latency":                     "cmi.interactions.n.id",
+		"cmi.interactions.n.description":                 "cmi.interactions.n.id",
+		"cmi.objectives.n.score.scaled":                  "cmi.objectives.n.id",
+		"cmi.objectives.n.score.raw":                     "cmi.objectives.n.id",
+		"cmi.objectives.n.score.min":                     "cmi.objectives.n.id",
+		"cmi.objectives.n.score.max":                     "cmi.objectives.n.id",
+		"cmi.objectives.n.success_status":                "cmi.objectives.n.id",
+		"cmi.objectives.n.completion_status":             "cmi.objectives.n.id",
+		"cmi.objectives.n.progress_measure":              "cmi.objectives.n.id",
+		"cmi.objectives.n.description":                   "cmi.objectives.n.id",
+	},
+	responses:  responses2004,
+	parseTime:  parseISODuration,
+	formatTime: formatISODuration,
+
+	passingScale: 1,
+}
@@ -0,0 +1,383 @@
+package scormrt
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+	"github.com/guilherme-gatti/poc_scorm/internal/sequencing"
+)
+
+// NavigateRequest is the body of POST /courses/:id/navigate. Request is a
+// navigation request (start, resumeAll, continue, previous, choice, exit,
+// exitAll, suspendAll, abandon or abandonAll) and Target the activity of a
+// choice request.
+type NavigateRequest struct {
+	UserID   int    `json:"userId"`
+	UserName string `json:"userName"`
+	Request  string `json:"request"`
+	Target   string `json:"target"`
+}
+
+// registrationLocks serializes the changes to the sequencing state of a
+// learner in a course: launches, navigation requests and the results of a
+// terminated attempt each load the state, run the engine and save it back.
+// The lock is keyed by learner and course, which the registration is unique
+// on, because a first launch knows no registration yet. An entry is dropped
+// once nobody holds or waits for it.
+var registrationLocks = struct {
+	sync.Mutex
+	locks map[registrationKey]*registrationLock
+}{locks: map[registrationKey]*registrationLock{}}
+
+type registrationKey struct{ userID, courseID int }
+
+type registrationLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockRegistration locks the sequencing state of a learner in a course and
+// returns the function that unlocks it.
+func lockRegistration(userID, courseID int) func() {
+	key := registrationKey{userID, courseID}
+	registrationLocks.Lock()
+	l, ok := registrationLocks.locks[key]
+	if !ok {
+		l = &registrationLock{}
+		registrationLocks.locks[key] = l
+	}
+	l.users++
+	registrationLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		registrationLocks.Lock()
+		defer registrationLocks.Unlock()
+		if l.users--; l.users == 0 {
+			delete(registrationLocks.locks, key)
+		}
+	}
+}
+
+// NavigateHandler runs a navigation request through the sequencing engine
+// of a SCORM 2004 course and launches the activity it delivers. Requests of
+// the same learner in a course run one at a time.
+func NavigateHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid course id"})
+		return
+	}
+
+	var req NavigateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if req.UserID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+	if req.Request == sequencing.Jump {
+		// jump bypasses the control modes, so only the content may ask for it
+		c.JSON(http.StatusBadRequest, gin.H{"error": "jump requests can only be made by the content"})
+		return
+	}
+	defer lockRegistration(req.UserID, courseID)()
+
+	current, err := scorm.CurrentVersion(courseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "course not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid stored manifest"})
+		return
+	}
+
+	registrationID, err := ensureRegistration(req.UserID, courseID, current.ID)
+	if err != nil {
+		log.Printf("scormrt: erro ao registrar usuário %d no curso %d: %v", req.UserID, courseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not register learner"})
+		return
+	}
+	version, err := scorm.RegistrationVersion(registrationID, true)
+	if err != nil {
+		log.Printf("scormrt: erro ao carregar versão da matrícula %d: %v", registrationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid stored manifest"})
+		return
+	}
+	manifest := version.Manifest
+	_, engine, err := sequencingFor(manifest, registrationID)
+	if err != nil {
+		log.Printf("scormrt: erro ao carregar sequenciamento da matrícula %d: %v", registrationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load sequencing state"})
+		return
+	}
+
+	outcome, err := engine.Navigate(sequencing.Request{Kind: req.Request, Target: req.Target})
+	if err != nil {
+		status := http.StatusConflict
+		switch {
+		case errors.Is(err, sequencing.ErrInvalidRequest):
+			status = http.StatusBadRequest
+		case errors.Is(err, sequencing.ErrUnknownTarget):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if err := sequencing.SaveState(registrationID, engine.State()); err != nil {
+		log.Printf("scormrt: erro ao salvar sequenciamento da matrícula %d: %v", registrationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save sequencing state"})
+		return
+	}
+
+	if outcome.EndSession || outcome.Deliver == nil {
+		resp := gin.H{"ended": outcome.EndSession}
+		if current, ok := engine.Current(); ok {
+			resp["current"] = current.ID
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	item, href, err := resolveSco(manifest, outcome.Deliver.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity has no launchable resource"})
+		return
+	}
+
+	l, err := launch(courseID, LaunchRequest{UserID: req.UserID, UserName: req.UserName, Item: item.Identifier}, version, item)
+	if err == errAttemptLimit || isSequencingError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("scormrt: erro ao iniciar sessão do usuário %d no curso %d: %v", req.UserID, courseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start session"})
+		return
+	}
+
+	resp := launchResponse(l, version.Number, href, item)
+	resp["activity"] = outcome.Deliver.ID
+	resp["ended"] = false
+	c.JSON(http.StatusOK, resp)
+}
+
+// sequencingResults maps the session values to the tracking information the
+// sequencing engine keeps for the activity.
+func (sess *session) sequencingResults(total time.Duration) sequencing.Results {
+	names := sess.model.names
+	r := sequencing.Results{Duration: total}
+
+	switch status := sess.values[names.completion]; status {
+	case "completed", "passed", "failed":
+		r.Completion = "completed"
+	case "incomplete", "browsed":
+		r.Completion = "incomplete"
+	}
+
+	if names.success != "" {
+		r.Success = sess.values[names.success]
+	} else if status := sess.values[names.completion]; status == "passed" || status == "failed" {
+		r.Success = status
+	}
+
+	if scaled, ok := sess.scaledScore(); ok {
+		r.Measure = &scaled
+	}
+	return r
+}
+
+// reportSequencing hands the results of an ended attempt to the sequencing
+// state of the learner's registration, rolling them up the activity tree.
+// Callers must hold the registration lock of the learner.
+func reportSequencing(l Launch, r sequencing.Results) error {
+	manifest, err := versionManifest(l.VersionID)
+	if err != nil {
+		return err
+	}
+	_, engine, err := sequencingFor(manifest, l.RegistrationID)
+	if err != nil {
+		return err
+	}
+
+	if err := engine.Report(l.ScoID, r); err != nil {
+		return err
+	}
+	return sequencing.SaveState(l.RegistrationID, engine.State())
+}
+
+// sequencingFor builds the activity tree of a course and an engine over the
+// sequencing state of a registration.
+func sequencingFor(manifest scorm.Manifest, registrationID int64) (*sequencing.Tree, *sequencing.Engine, error) {
+	tree, err := sequencing.Build(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := sequencing.LoadState(registrationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tree, sequencing.New(tree, state), nil
+}
+
+// deliverSequencing runs a launch of a SCORM 2004 SCO through the sequencing
+// state of the registration before the attempt is opened. A launch of a
+// given item is checked as a choice request, one without item only against
+// the preconditions and attempt limits of the activity. The engine returned
+// holds the new state, saved once the attempt is open. When the manifest
+// declares no sequencing a refused delivery is only logged and no engine is
+// returned.
+func deliverSequencing(manifest scorm.Manifest, registrationID int64, scoID string, chosen bool) (*sequencing.Engine, error) {
+	_, engine, err := sequencingFor(manifest, registrationID)
+	if err != nil {
+		return nil, err
+	}
+	if chosen {
+		err = engine.Choose(scoID)
+	} else {
+		err = engine.Deliver(scoID)
+	}
+	if isSequencingError(err) && !hasSequencing(manifest) {
+		log.Printf("scormrt: erro ao atualizar sequenciamento da matrícula %d: %v", registrationID, err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// isSequencingError reports whether the sequencing engine refused a request,
+// as opposed to failing to load or save its state.
+func isSequencingError(err error) bool {
+	return errors.Is(err, sequencing.ErrNotAllowed) || errors.Is(err, sequencing.ErrNoActivity) ||
+		errors.Is(err, sequencing.ErrUnknownTarget) || errors.Is(err, sequencing.ErrInvalidRequest)
+}
+
+// hasSequencing reports whether the manifest declares sequencing rules
+// anywhere; without them the engine runs on the default control modes.
+func hasSequencing(manifest scorm.Manifest) bool {
+	if manifest.SequencingCollection != nil {
+		return true
+	}
+	var inItems func(items []scorm.Item) bool
+	inItems = func(items []scorm.Item) bool {
+		for _, item := range items {
+			if item.Sequencing != nil || inItems(item.Items) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, org := range manifest.Organizations.Organization {
+		if org.Sequencing != nil || inItems(org.Items) {
+			return true
+		}
+	}
+	return false
+}
+
+// Navigation tells the player what to load after a SCO terminated with an
+// adl.nav.request: the player page of the next SCO, or the end of the
+// sequencing session. Error is set when the request could not be honoured.
+type Navigation struct {
+	Request  string `json:"request"`
+	Activity string `json:"activity,omitempty"`
+	Player   string `json:"player,omitempty"`
+	Ended    bool   `json:"ended"`
+	Error    string `json:"error,omitempty"`
+}
+
+// parseNavRequest maps an adl.nav.request value to a navigation request.
+// It reports false for _none_.
+func parseNavRequest(value string) (sequencing.Request, bool) {
+	if value == "" || value == "_none_" {
+		return sequencing.Request{}, false
+	}
+	if navTargetPattern.MatchString(value) {
+		target, kind, _ := strings.Cut(strings.TrimPrefix(value, "{target="), "}")
+		return sequencing.Request{Kind: kind, Target: target}, true
+	}
+	return sequencing.Request{Kind: value}, true
+}
+
+// navigate runs the navigation request a SCO made before terminating and
+// launches the SCO it delivers for the same learner. Callers must hold the
+// registration lock of the learner.
+func navigate(l Launch, value string, req sequencing.Request) (Navigation, error) {
+	nav := Navigation{Request: value}
+	version, err := scorm.LoadVersion(l.VersionID)
+	if err != nil {
+		return nav, err
+	}
+	manifest := version.Manifest
+	_, engine, err := sequencingFor(manifest, l.RegistrationID)
+	if err != nil {
+		return nav, err
+	}
+
+	outcome, navErr := engine.Navigate(req)
+	if err := sequencing.SaveState(l.RegistrationID, engine.State()); err != nil {
+		return nav, err
+	}
+	if navErr != nil {
+		return nav, navErr
+	}
+	if outcome.EndSession || outcome.Deliver == nil {
+		nav.Ended = outcome.EndSession
+		return nav, nil
+	}
+
+	item, _, err := resolveSco(manifest, outcome.Deliver.ID)
+	if err != nil {
+		return nav, err
+	}
+	next, err := launch(l.CourseID, LaunchRequest{UserID: l.UserID, UserName: l.LearnerName, Item: item.Identifier}, version, item)
+	if err != nil {
+		return nav, err
+	}
+	nav.Activity = item.Identifier
+	nav.Player = "/player/" + next.Token
+	return nav, nil
+}
+
+// seedNavigation answers adl.nav.request_valid for the session from the
+// sequencing state: continue, previous and a choice and a jump entry per
+// activity.
+func (sess *session) seedNavigation() error {
+	l := sess.launch
+	manifest, err := versionManifest(l.VersionID)
+	if err != nil {
+		return err
+	}
+	tree, engine, err := sequencingFor(manifest, l.RegistrationID)
+	if err != nil {
+		return err
+	}
+	if err := engine.Deliver(l.ScoID); err != nil {
+		return err
+	}
+
+	valid := func(req sequencing.Request) string {
+		return strconv.FormatBool(engine.Valid(req))
+	}
+	sess.values["adl.nav.request_valid.continue"] = valid(sequencing.Request{Kind: sequencing.Continue})
+	sess.values["adl.nav.request_valid.previous"] = valid(sequencing.Request{Kind: sequencing.Previous})
+	for _, a := range tree.Activities {
+		sess.values["adl.nav.request_valid.choice.{target="+a.ID+"}"] = valid(sequencing.Request{Kind: sequencing.Choice, Target: a.ID})
+		sess.values["adl.nav.request_valid.jump.{target="+a.ID+"}"] = valid(sequencing.Request{Kind: sequencing.Jump, Target: a.ID})
+	}
+	return nil
+}
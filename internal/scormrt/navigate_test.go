@@ -0,0 +1,178 @@
+package scormrt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+	"github.com/guilherme-gatti/poc_scorm/internal/sequencing"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+func flowOnlyManifest() scorm.Manifest {
+	return scorm.Manifest{
+		Organizations: scorm.Organizations{
+			Default: "org",
+			Organization: []scorm.Organization{{
+				Identifier: "org",
+				Items: []scorm.Item{
+					{Identifier: "a", IdentifierRef: "r"},
+					{Identifier: "b", IdentifierRef: "r"},
+				},
+				Sequencing: &scorm.Sequencing{
+					ControlMode: &scorm.ControlMode{Choice: "false", Flow: "true"},
+				},
+			}},
+		},
+	}
+}
+
+func TestDeliverSequencingRefusesDirectLaunchAgainstControlModes(t *testing.T) {
+	const registrationID = 987001
+
+	engine, err := deliverSequencing(flowOnlyManifest(), registrationID, "b", true)
+	if !isSequencingError(err) {
+		t.Fatalf("deliverSequencing(b) error = %v, want a sequencing error", err)
+	}
+	if engine != nil {
+		t.Error("refused launch returned an engine")
+	}
+
+	// a launch without item enters the course through its first SCO
+	engine, err = deliverSequencing(flowOnlyManifest(), registrationID, "a", false)
+	if err != nil {
+		t.Fatalf("deliverSequencing(a) error = %v", err)
+	}
+	if current, ok := engine.Current(); !ok || current.ID != "a" {
+		t.Errorf("current activity = %v, want a", current)
+	}
+}
+
+func TestDeliverSequencingWithoutDeclaredSequencing(t *testing.T) {
+	manifest := flowOnlyManifest()
+	manifest.Organizations.Organization[0].Sequencing = nil
+	if hasSequencing(manifest) {
+		t.Fatal("hasSequencing reported rules for a manifest without any")
+	}
+
+	engine, err := deliverSequencing(manifest, 987002, "b", true)
+	if err != nil || engine == nil {
+		t.Fatalf("deliverSequencing(b) = %v, %v; want the engine", engine, err)
+	}
+}
+
+func TestParseNavRequest(t *testing.T) {
+	tests := []struct {
+		value string
+		want  sequencing.Request
+		ok    bool
+	}{
+		{"", sequencing.Request{}, false},
+		{"_none_", sequencing.Request{}, false},
+		{"continue", sequencing.Request{Kind: sequencing.Continue}, true},
+		{"{target=sco-2}choice", sequencing.Request{Kind: sequencing.Choice, Target: "sco-2"}, true},
+		{"{target=sco-2}jump", sequencing.Request{Kind: sequencing.Jump, Target: "sco-2"}, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseNavRequest(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseNavRequest(%q) = %+v, %v; want %+v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSeedNavigationAnswersJumpValidity(t *testing.T) {
+	manifestJSON, err := json.Marshal(flowOnlyManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := storage.DB.Exec(`
+		INSERT INTO course_versions (course_id, number, manifest_json, storage_key) VALUES (987003, 1, ?, 'k')
+	`, string(manifestJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	versionID, _ := res.LastInsertId()
+
+	sess := &session{
+		model:  modelFor(SCORM2004),
+		values: map[string]string{},
+		launch: Launch{RegistrationID: 987003, VersionID: versionID, ScoID: "a", Version: SCORM2004},
+	}
+	if err := sess.seedNavigation(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"adl.nav.request_valid.continue":          "true",
+		"adl.nav.request_valid.choice.{target=b}": "false",
+		"adl.nav.request_valid.jump.{target=b}":   "true",
+		"adl.nav.request_valid.jump.{target=org}": "false",
+	}
+	for element, value := range want {
+		if got, code := sess.model.get(sess.values, element); got != value || code != errNone {
+			t.Errorf("GetValue(%s) = %q (%s), want %q", element, got, code, value)
+		}
+	}
+}
+
+func TestNavigateWaitsForTheRegistrationLock(t *testing.T) {
+	const userID, courseID = 987004, 987004
+	manifest := flowOnlyManifest()
+	manifest.Metadata.SchemaVersion = "2004 4th Edition"
+	manifest.Resources.Resource = []scorm.Resource{{Identifier: "r", Href: "index.html"}}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := storage.DB.Exec(`
+		INSERT INTO course_versions (course_id, number, manifest_json, storage_key) VALUES (?, 1, ?, 'k')
+	`, courseID, string(manifestJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	versionID, _ := res.LastInsertId()
+	_, err = storage.DB.Exec(`
+		INSERT INTO courses (id, identifier, version, manifest_json, version_id) VALUES (?, 'nav', '2004', ?, ?)
+	`, courseID, string(manifestJSON), versionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/courses/:id/navigate", NavigateHandler)
+	start := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/courses/987004/navigate", strings.NewReader(`{"userId":987004,"request":"start"}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// a terminating SCO of the same learner holds the sequencing state
+	unlock := lockRegistration(userID, courseID)
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- start() }()
+	select {
+	case w := <-done:
+		unlock()
+		t.Fatalf("navigation ran while the registration was locked: %d %s", w.Code, w.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+
+	w := <-done
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"activity":"a"`) {
+		t.Fatalf("start = %d %s, want the first activity", w.Code, w.Body)
+	}
+	registrationLocks.Lock()
+	defer registrationLocks.Unlock()
+	if _, ok := registrationLocks.locks[registrationKey{userID, courseID}]; ok {
+		t.Error("registration lock kept after its last user")
+	}
+}
@@ -0,0 +1,77 @@
+package scormrt
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed assets/player.html
+var playerHTML string
+
+//go:embed assets/api.js
+var apiJS []byte
+
+var playerTemplate = template.Must(template.New("player").Parse(playerHTML))
+
+// playerConfig is handed to the API adapter as window.SCORM_PLAYER.
+type playerConfig struct {
+	Session  string  `json:"session"`
+	Version  Version `json:"version"`
+	Endpoint string  `json:"endpoint"`
+}
+
+// PlayerHandler serves the page that hosts the SCORM API adapter and loads
+// the launched SCO in a frame, so packages find window.API or
+// window.API_1484_11 in their parent window.
+func PlayerHandler(c *gin.Context) {
+	token := c.Param("session")
+	l, _, err := loadLaunch(token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown session"})
+		return
+	}
+
+	url, title, err := launchURL(l)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	err = playerTemplate.Execute(c.Writer, gin.H{
+		"Title":  title,
+		"URL":    url,
+		"Config": playerConfig{Session: l.Token, Version: l.Version, Endpoint: "/scormrt"},
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+	}
+}
+
+// PlayerScriptHandler serves the SCORM API adapter.
+func PlayerScriptHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/javascript; charset=utf-8", apiJS)
+}
+
+// launchURL resolves the content URL and title of the SCO a launch points to.
+func launchURL(l Launch) (url, title string, err error) {
+	manifest, err := versionManifest(l.VersionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	item, href, err := resolveSco(manifest, l.ScoID)
+	if err != nil {
+		return "", "", err
+	}
+
+	title = item.Title
+	if title == "" {
+		title = item.Identifier
+	}
+	return contentURL(l.Token, href, item.Parameters), title, nil
+}
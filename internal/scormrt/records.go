@@ -0,0 +1,114 @@
+package scormrt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Interaction is an entry of cmi.interactions as stored in the interactions
+// table. Numeric fields are nil when the content never set them.
+type Interaction struct {
+	Index            int      `json:"index"`
+	ID               string   `json:"id"`
+	Type             string   `json:"type"`
+	Timestamp        string   `json:"timestamp"`
+	Weighting        *float64 `json:"weighting"`
+	LearnerResponse  string   `json:"learnerResponse"`
+	Result           string   `json:"result"`
+	Latency          string   `json:"latency"`
+	Description      string   `json:"description"`
+	CorrectResponses []string `json:"correctResponses"`
+	Objectives       []string `json:"objectives"`
+}
+
+// Objective is an entry of cmi.objectives as stored in the objectives table.
+type Objective struct {
+	Index            int      `json:"index"`
+	ID               string   `json:"id"`
+	SuccessStatus    string   `json:"successStatus"`
+	CompletionStatus string   `json:"completionStatus"`
+	ScoreScaled      *float64 `json:"scoreScaled"`
+	ScoreRaw         *float64 `json:"scoreRaw"`
+	ScoreMin         *float64 `json:"scoreMin"`
+	ScoreMax         *float64 `json:"scoreMax"`
+	ProgressMeasure  *float64 `json:"progressMeasure"`
+	Description      string   `json:"description"`
+}
+
+// interactions reads the cmi.interactions collection out of the session
+// values.
+func (m *dataModel) interactions(values map[string]string) []Interaction {
+	n := count(values, "cmi.interactions")
+	result := make([]Interaction, 0, n)
+	for i := 0; i < n; i++ {
+		prefix := "cmi.interactions." + strconv.Itoa(i) + "."
+		field := func(name string) string {
+			return values[prefix+strings.TrimPrefix(name, "cmi.interactions.n.")]
+		}
+
+		result = append(result, Interaction{
+			Index:            i,
+			ID:               field("id"),
+			Type:             field("type"),
+			Timestamp:        field(m.names.interactionTime),
+			Weighting:        optionalReal(field("weighting")),
+			LearnerResponse:  field(m.names.interactionResponse),
+			Result:           field("result"),
+			Latency:          field("latency"),
+			Description:      field("description"),
+			CorrectResponses: list(values, prefix+"correct_responses", "pattern"),
+			Objectives:       list(values, prefix+"objectives", "id"),
+		})
+	}
+	return result
+}
+
+// objectives reads the cmi.objectives collection out of the session values.
+// The single SCORM 1.2 status is split into success and completion status.
+func (m *dataModel) objectives(values map[string]string) []Objective {
+	n := count(values, "cmi.objectives")
+	result := make([]Objective, 0, n)
+	for i := 0; i < n; i++ {
+		prefix := "cmi.objectives." + strconv.Itoa(i) + "."
+		obj := Objective{
+			Index:            i,
+			ID:               values[prefix+"id"],
+			SuccessStatus:    values[prefix+"success_status"],
+			CompletionStatus: values[prefix+"completion_status"],
+			ScoreScaled:      optionalReal(values[prefix+"score.scaled"]),
+			ScoreRaw:         optionalReal(values[prefix+"score.raw"]),
+			ScoreMin:         optionalReal(values[prefix+"score.min"]),
+			ScoreMax:         optionalReal(values[prefix+"score.max"]),
+			ProgressMeasure:  optionalReal(values[prefix+"progress_measure"]),
+			Description:      values[prefix+"description"],
+		}
+		switch status := values[prefix+"status"]; status {
+		case "":
+		case "passed", "failed":
+			obj.SuccessStatus = status
+		default:
+			obj.CompletionStatus = status
+		}
+		result = append(result, obj)
+	}
+	return result
+}
+
+// list returns the given field of every entry of a nested collection, e.g.
+// the patterns of cmi.interactions.0.correct_responses.
+func list(values map[string]string, prefix, field string) []string {
+	n := count(values, prefix)
+	result := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		result = append(result, values[prefix+"."+strconv.Itoa(i)+"."+field])
+	}
+	return result
+}
+
+func optionalReal(value string) *float64 {
+	f, ok := parseReal(value)
+	if !ok {
+		return nil
+	}
+	return &f
+}
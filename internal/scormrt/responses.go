@@ -0,0 +1,170 @@
+package scormrt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// responseFormat validates the learner response and the correct response
+// patterns of one interaction type.
+type responseFormat struct {
+	response validator
+	pattern  validator
+}
+
+var (
+	shortIdentifierPattern = regexp.MustCompile(`^[^\s\[\]]+$`)
+	patternDelimiter       = regexp.MustCompile(`^\{(case_matters|order_matters)=(true|false)\}`)
+	choice12Pattern        = regexp.MustCompile(`^\{?([0-9a-z](,[0-9a-z])*)?\}?$`)
+	matching12Pattern      = regexp.MustCompile(`^\{?([0-9a-z]\.[0-9a-z](,[0-9a-z]\.[0-9a-z])*)?\}?$`)
+	sequencing12Pattern    = regexp.MustCompile(`^[0-9a-z](,[0-9a-z])*$`)
+	likert12Pattern        = regexp.MustCompile(`^[0-9a-z]?$`)
+)
+
+// responses2004 holds the SCORM 2004 response formats. Records are separated
+// by [,], the parts of a record by [.] and numeric bounds by [:].
+var responses2004 = map[string]responseFormat{
+	"true-false":   {response: vocabulary("true", "false"), pattern: vocabulary("true", "false")},
+	"choice":       {response: identifierSet, pattern: identifierSet},
+	"fill-in":      {response: localizedRecords, pattern: withDelimiters(localizedRecords)},
+	"long-fill-in": {response: localizedString, pattern: withDelimiters(localizedString)},
+	"likert":       {response: shortIdentifier, pattern: shortIdentifier},
+	"matching":     {response: identifierPairs, pattern: identifierPairs},
+	"performance":  {response: performanceSteps, pattern: withDelimiters(performanceSteps)},
+	"sequencing":   {response: identifierList, pattern: identifierList},
+	"numeric":      {response: realRange(-1e10, 1e10), pattern: numericRange},
+	"other":        {response: characterString, pattern: characterString},
+}
+
+// responses12 holds the SCORM 1.2 CMIFeedback formats, where identifiers are
+// single characters and responses share the format of their patterns.
+var responses12 = map[string]responseFormat{
+	"true-false":  feedback12(vocabulary("0", "1", "t", "f")),
+	"choice":      feedback12(matches(choice12Pattern)),
+	"fill-in":     feedback12(cmiString(255)),
+	"numeric":     feedback12(realRange(-1e10, 1e10)),
+	"likert":      feedback12(matches(likert12Pattern)),
+	"matching":    feedback12(matches(matching12Pattern)),
+	"performance": feedback12(cmiString(255)),
+	"sequencing":  feedback12(matches(sequencing12Pattern)),
+}
+
+func feedback12(v validator) responseFormat {
+	return responseFormat{response: v, pattern: v}
+}
+
+func matches(re *regexp.Regexp) validator {
+	return func(value string) string {
+		if !re.MatchString(value) {
+			return errTypeMismatch
+		}
+		return errNone
+	}
+}
+
+// withDelimiters strips the {case_matters=} and {order_matters=} delimiters a
+// pattern may start with before validating the rest.
+func withDelimiters(v validator) validator {
+	return func(value string) string {
+		for {
+			loc := patternDelimiter.FindStringIndex(value)
+			if loc == nil {
+				break
+			}
+			value = value[loc[1]:]
+		}
+		return v(value)
+	}
+}
+
+func shortIdentifier(value string) string {
+	if !shortIdentifierPattern.MatchString(value) {
+		return errTypeMismatch
+	}
+	return errNone
+}
+
+// identifierList accepts identifiers separated by [,].
+func identifierList(value string) string {
+	for _, record := range strings.Split(value, "[,]") {
+		if shortIdentifier(record) != errNone {
+			return errTypeMismatch
+		}
+	}
+	return errNone
+}
+
+// identifierSet accepts an empty value or distinct identifiers separated by
+// [,].
+func identifierSet(value string) string {
+	if value == "" {
+		return errNone
+	}
+	seen := make(map[string]bool)
+	for _, record := range strings.Split(value, "[,]") {
+		if shortIdentifier(record) != errNone || seen[record] {
+			return errTypeMismatch
+		}
+		seen[record] = true
+	}
+	return errNone
+}
+
+// identifierPairs accepts source[.]target pairs separated by [,].
+func identifierPairs(value string) string {
+	for _, record := range strings.Split(value, "[,]") {
+		source, target, ok := strings.Cut(record, "[.]")
+		if !ok || shortIdentifier(source) != errNone || shortIdentifier(target) != errNone {
+			return errTypeMismatch
+		}
+	}
+	return errNone
+}
+
+// localizedRecords accepts localized strings separated by [,].
+func localizedRecords(value string) string {
+	for _, record := range strings.Split(value, "[,]") {
+		if localizedString(record) != errNone {
+			return errTypeMismatch
+		}
+	}
+	return errNone
+}
+
+// performanceSteps accepts step_name[.]step_answer records separated by [,],
+// where either part may be omitted but not both.
+func performanceSteps(value string) string {
+	for _, record := range strings.Split(value, "[,]") {
+		name, answer, ok := strings.Cut(record, "[.]")
+		if !ok || name == "" && answer == "" || strings.Contains(answer, "[.]") {
+			return errTypeMismatch
+		}
+		if name != "" && shortIdentifier(name) != errNone {
+			return errTypeMismatch
+		}
+	}
+	return errNone
+}
+
+// numericRange accepts min[:]max where either bound may be omitted.
+func numericRange(value string) string {
+	lo, hi, ok := strings.Cut(value, "[:]")
+	if !ok {
+		return errTypeMismatch
+	}
+	var min, max float64
+	if lo != "" {
+		if min, ok = parseReal(lo); !ok {
+			return errTypeMismatch
+		}
+	}
+	if hi != "" {
+		if max, ok = parseReal(hi); !ok {
+			return errTypeMismatch
+		}
+	}
+	if lo != "" && hi != "" && min > max {
+		return errTypeMismatch
+	}
+	return errNone
+}
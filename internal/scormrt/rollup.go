@@ -0,0 +1,320 @@
+package scormrt
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+	"github.com/guilherme-gatti/poc_scorm/internal/sequencing"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// statusUnknown is reported for statuses that cannot be derived yet.
+const statusUnknown = "unknown"
+
+// CourseRollup is the status of a learner in a course derived from the
+// activity tree: the status of the organization and of each activity.
+type CourseRollup struct {
+	UserID     int              `json:"userId"`
+	CourseID   int              `json:"courseId"`
+	Completion string           `json:"completionStatus"`
+	Success    string           `json:"successStatus"`
+	Score      *float64         `json:"scoreScaled"`
+	Activities []ActivityRollup `json:"activities"`
+	UpdatedAt  string           `json:"updatedAt"`
+}
+
+// ActivityRollup is the status of an activity of the tree, either a SCO
+// reported by the runtime or a cluster rolled up from its children.
+type ActivityRollup struct {
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	Parent     string   `json:"parent,omitempty"`
+	Completion string   `json:"completionStatus"`
+	Success    string   `json:"successStatus"`
+	Score      *float64 `json:"scoreScaled"`
+}
+
+// RollupHandler returns the stored rollup of a learner in a course,
+// computing it on first access for registrations that predate the rollup.
+func RollupHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	courseID, err := strconv.Atoi(c.Param("courseId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid course id"})
+		return
+	}
+
+	r, err := loadRollup(userID, courseID)
+	if err == sql.ErrNoRows {
+		r, err = updateRollup(userID, courseID)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "registration not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("scormrt: erro ao calcular rollup do usuário %d no curso %d: %v", userID, courseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not compute rollup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// updateRollup recomputes the rollup of a learner in a course from the
+// latest attempt of each SCO and stores it. It returns sql.ErrNoRows when
+// the learner is not registered in the course.
+func updateRollup(userID, courseID int) (CourseRollup, error) {
+	var registrationID int64
+	err := storage.DB.QueryRow(`
+		SELECT id FROM registrations WHERE user_id = ? AND course_id = ?
+	`, userID, courseID).Scan(&registrationID)
+	if err != nil {
+		return CourseRollup{}, err
+	}
+
+	version, err := scorm.RegistrationVersion(registrationID, false)
+	if err != nil {
+		return CourseRollup{}, err
+	}
+	manifest := version.Manifest
+	tree, err := sequencing.Build(manifest)
+	if err != nil {
+		return CourseRollup{}, err
+	}
+	attempts, err := latestAttempts(registrationID)
+	if err != nil {
+		return CourseRollup{}, err
+	}
+
+	var state *sequencing.State
+	if VersionFromSchema(manifest.Metadata.SchemaVersion) == SCORM2004 {
+		state, err = rollup2004(registrationID, tree, attempts)
+		if err != nil {
+			return CourseRollup{}, err
+		}
+	} else {
+		state = rollup12(tree, attempts)
+	}
+
+	r := CourseRollup{UserID: userID, CourseID: courseID}
+	for _, a := range tree.Activities {
+		ar := activityRollup(a, state.Activities[a.ID])
+		if a == tree.Root {
+			r.Completion, r.Success, r.Score = ar.Completion, ar.Success, ar.Score
+		}
+		r.Activities = append(r.Activities, ar)
+	}
+	r.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return r, saveRollup(registrationID, r)
+}
+
+// scoAttempt is the latest attempt of a SCO and how many were made.
+type scoAttempt struct {
+	values map[string]string
+	count  int
+}
+
+// latestAttempts returns the latest attempt of each SCO of a registration,
+// keyed by SCO identifier.
+func latestAttempts(registrationID int64) (map[string]*scoAttempt, error) {
+	rows, err := storage.DB.Query(`
+		SELECT sco_id, cmi_json FROM attempts WHERE registration_id = ? ORDER BY id
+	`, registrationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := map[string]*scoAttempt{}
+	for rows.Next() {
+		var scoID string
+		var cmiJSON sql.NullString
+		if err := rows.Scan(&scoID, &cmiJSON); err != nil {
+			return nil, err
+		}
+		a, ok := attempts[scoID]
+		if !ok {
+			a = &scoAttempt{}
+			attempts[scoID] = a
+		}
+		a.count++
+		a.values = map[string]string{}
+		if cmiJSON.Valid {
+			if err := json.Unmarshal([]byte(cmiJSON.String), &a.values); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return attempts, rows.Err()
+}
+
+// rollup2004 applies the latest attempt of each SCO to the sequencing state
+// of the registration and rolls it up with the rollup rules, weights and
+// rollup considerations of the manifest.
+func rollup2004(registrationID int64, tree *sequencing.Tree, attempts map[string]*scoAttempt) (*sequencing.State, error) {
+	state, err := sequencing.LoadState(registrationID)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := sequencing.New(tree, state)
+	for _, a := range tree.Activities {
+		// untracked activities keep no state and do not contribute to rollup
+		att, ok := attempts[a.ID]
+		if !a.IsLeaf() || !a.Def.Tracked || !ok {
+			continue
+		}
+		sess := &session{model: modelFor(SCORM2004), values: att.values}
+		if err := engine.Report(a.ID, sess.sequencingResults(sess.totalTime())); err != nil {
+			return nil, err
+		}
+		if st := state.Activities[a.ID]; st.AttemptCount < att.count {
+			st.AttemptCount = att.count
+		}
+	}
+	engine.Rollup()
+	return state, nil
+}
+
+// rollup12 derives the status of each cluster of a SCORM 1.2 course: it is
+// completed once all of its SCOs are (passed and failed count as completed),
+// passed when all of them passed and failed when any failed. The score is
+// the average scaled score of the SCOs that reported one.
+func rollup12(tree *sequencing.Tree, attempts map[string]*scoAttempt) *sequencing.State {
+	state := sequencing.NewState()
+	model := modelFor(SCORM12)
+
+	for i := len(tree.Activities) - 1; i >= 0; i-- {
+		a := tree.Activities[i]
+		st := &sequencing.ActivityState{}
+		state.Activities[a.ID] = st
+
+		if a.IsLeaf() {
+			att, ok := attempts[a.ID]
+			if !ok {
+				continue
+			}
+			st.AttemptCount = att.count
+			sess := &session{model: model, values: att.values}
+			r := sess.sequencingResults(0)
+			st.ProgressKnown, st.Completed = r.Completion != "", r.Completion == "completed"
+			st.ObjectiveKnown, st.Satisfied = r.Success != "", r.Success == "passed"
+			if r.Measure != nil {
+				st.MeasureKnown, st.Measure = true, *r.Measure
+			}
+			continue
+		}
+
+		completed, passed, scored := 0, 0, 0
+		for _, c := range a.Children {
+			cs := state.Activities[c.ID]
+			if cs.ProgressKnown {
+				st.ProgressKnown = true
+			}
+			if cs.Completed {
+				completed++
+			}
+			if cs.ObjectiveKnown && cs.Satisfied {
+				passed++
+			}
+			if cs.ObjectiveKnown && !cs.Satisfied {
+				st.ObjectiveKnown = true
+			}
+			if cs.MeasureKnown {
+				scored++
+				st.Measure += cs.Measure
+			}
+		}
+		st.Completed = completed == len(a.Children)
+		st.ProgressKnown = st.ProgressKnown || st.Completed
+		if !st.ObjectiveKnown && passed == len(a.Children) {
+			st.ObjectiveKnown, st.Satisfied = true, true
+		}
+		if scored > 0 {
+			st.MeasureKnown, st.Measure = true, st.Measure/float64(scored)
+		}
+	}
+	return state
+}
+
+// activityRollup describes the tracking information of an activity with the
+// SCORM 2004 status vocabularies.
+func activityRollup(a *sequencing.Activity, st *sequencing.ActivityState) ActivityRollup {
+	ar := ActivityRollup{ID: a.ID, Title: a.Title, Completion: statusUnknown, Success: statusUnknown}
+	if a.Parent != nil {
+		ar.Parent = a.Parent.ID
+	}
+	if st == nil {
+		return ar
+	}
+
+	if st.ProgressKnown {
+		ar.Completion = "incomplete"
+		if st.Completed {
+			ar.Completion = "completed"
+		}
+	}
+	if st.ObjectiveKnown {
+		ar.Success = "failed"
+		if st.Satisfied {
+			ar.Success = "passed"
+		}
+	}
+	if st.MeasureKnown {
+		score := math.Round(st.Measure*1e7) / 1e7
+		ar.Score = &score
+	}
+	return ar
+}
+
+// saveRollup stores the rollup of a registration, replacing the previous one.
+func saveRollup(registrationID int64, r CourseRollup) error {
+	activitiesJSON, err := json.Marshal(r.Activities)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.DB.Exec(`
+		INSERT INTO course_rollups (registration_id, user_id, course_id, completion_status, success_status, score_scaled, activities_json, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (registration_id) DO UPDATE SET
+			completion_status = excluded.completion_status,
+			success_status = excluded.success_status,
+			score_scaled = excluded.score_scaled,
+			activities_json = excluded.activities_json,
+			updated_at = excluded.updated_at
+	`, registrationID, r.UserID, r.CourseID, r.Completion, r.Success, r.Score, activitiesJSON, r.UpdatedAt)
+	return err
+}
+
+// loadRollup reads the stored rollup of a learner in a course.
+func loadRollup(userID, courseID int) (CourseRollup, error) {
+	r := CourseRollup{UserID: userID, CourseID: courseID}
+	var score sql.NullFloat64
+	var activitiesJSON string
+	err := storage.DB.QueryRow(`
+		SELECT completion_status, success_status, score_scaled, activities_json, updated_at
+		FROM course_rollups WHERE user_id = ? AND course_id = ?
+	`, userID, courseID).Scan(&r.Completion, &r.Success, &score, &activitiesJSON, &r.UpdatedAt)
+	if err != nil {
+		return CourseRollup{}, err
+	}
+
+	if score.Valid {
+		r.Score = &score.Float64
+	}
+	err = json.Unmarshal([]byte(activitiesJSON), &r.Activities)
+	return r, err
+}
@@ -0,0 +1,45 @@
+package scormrt
+
+import (
+	"testing"
+
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+	"github.com/guilherme-gatti/poc_scorm/internal/sequencing"
+)
+
+func TestRollup2004SkipsUntrackedLeaves(t *testing.T) {
+	manifest := scorm.Manifest{
+		Organizations: scorm.Organizations{
+			Default: "org",
+			Organization: []scorm.Organization{{
+				Identifier: "org",
+				Items: []scorm.Item{
+					{Identifier: "tracked", IdentifierRef: "r"},
+					{Identifier: "untracked", IdentifierRef: "r", Sequencing: &scorm.Sequencing{
+						DeliveryControls: &scorm.DeliveryControls{Tracked: "false"},
+					}},
+				},
+			}},
+		},
+	}
+	tree, err := sequencing.Build(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := map[string]*scoAttempt{
+		"tracked":   {count: 2, values: map[string]string{"cmi.completion_status": "completed"}},
+		"untracked": {count: 1, values: map[string]string{"cmi.completion_status": "completed"}},
+	}
+	state, err := rollup2004(987654, tree, attempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st := state.Activities["tracked"]; st == nil || st.AttemptCount != 2 || !st.Completed {
+		t.Errorf("tracked state = %+v, want 2 attempts and completed", st)
+	}
+	if _, ok := state.Activities["untracked"]; ok {
+		t.Error("untracked activity got sequencing state")
+	}
+}
@@ -1,112 +1,645 @@
 package scormrt
 
 import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"strconv"
 	"sync"
+	"time"
 )
 
-// RuntimeService holds runtime session data.
+// sessionState is the position of a session in the SCORM run-time state
+// model: Not Initialized, Running or Terminated.
+type sessionState int
+
+const (
+	notInitialized sessionState = iota
+	running
+	terminated
+)
+
+// Sessions are dropped from memory a while after they terminate, so the
+// calls the content makes right after Terminate (GetLastError, the
+// navigation outcome) are still answered, and after a long idle period.
+// A dropped session is loaded again from the database if its token is used.
+const (
+	terminatedSessionTTL = time.Minute
+	idleSessionTTL       = 12 * time.Hour
+	sweepInterval        = time.Minute
+)
+
+// session holds the data model, state and values of a single runtime session
+// together with the launch that created it. mu guards every field except
+// lastUsed, which belongs to the service.
+type session struct {
+	mu        sync.Mutex
+	model     *dataModel
+	state     sessionState
+	values    map[string]string
+	launch    Launch
+	lastError string
+	// navigation is the outcome of the adl.nav.request processed on
+	// Terminate, if any.
+	navigation *Navigation
+	lastUsed   time.Time
+}
+
+// RuntimeService holds runtime session data. mu only guards the sessions
+// map: calls on a session are serialized by the session's own lock, so
+// database I/O for one session does not block the others.
 type RuntimeService struct {
-	mu        sync.RWMutex
-	sessions  map[string]map[string]string
-	lastError map[string]string
+	mu        sync.Mutex
+	sessions  map[string]*session
+	lastSweep time.Time
 }
 
 // NewService creates a new RuntimeService.
 func NewService() *RuntimeService {
-	return &RuntimeService{
-		sessions:  make(map[string]map[string]string),
-		lastError: make(map[string]string),
-	}
+	return &RuntimeService{sessions: make(map[string]*session)}
 }
 
 var defaultService = NewService()
 
-// Initialize starts a new session for the given id.
-func (s *RuntimeService) Initialize(session string) string {
+// Exists reports whether id is a session token minted by a launch.
+func (s *RuntimeService) Exists(id string) bool {
+	_, ok := s.lookup(id)
+	return ok
+}
+
+// cached returns the session for id if it is in memory.
+func (s *RuntimeService) cached(id string) (*session, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.sessions[session]; !ok {
-		s.sessions[session] = make(map[string]string)
+	now := time.Now()
+	s.sweep(now)
+	sess, ok := s.sessions[id]
+	if ok {
+		sess.lastUsed = now
 	}
-	s.lastError[session] = "0"
-	return "true"
+	return sess, ok
 }
 
-// Terminate ends an existing session.
-func (s *RuntimeService) Terminate(session string) string {
+// sweep drops the sessions that terminated or went idle long enough ago.
+// Sessions in the middle of a call are left alone. Callers must hold s.mu.
+func (s *RuntimeService) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for id, sess := range s.sessions {
+		if !sess.mu.TryLock() {
+			continue
+		}
+		idle := now.Sub(sess.lastUsed)
+		if idle >= idleSessionTTL || (sess.state == terminated && idle >= terminatedSessionTTL) {
+			delete(s.sessions, id)
+		}
+		sess.mu.Unlock()
+	}
+}
+
+// lookup returns the session for id, loading it from the database the first
+// time the token is used. Sessions that were running when the server stopped
+// come back running with the values of their last commit.
+func (s *RuntimeService) lookup(id string) (*session, bool) {
+	if sess, ok := s.cached(id); ok {
+		return sess, true
+	}
+
+	sess, ok := loadSession(id)
+	if !ok {
+		return nil, false
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.sessions, session)
-	s.lastError[session] = "0"
+	if cached, ok := s.sessions[id]; ok {
+		// another call loaded it first
+		cached.lastUsed = time.Now()
+		return cached, true
+	}
+	sess.lastUsed = time.Now()
+	s.sessions[id] = sess
+	return sess, true
+}
+
+// loadSession builds the session for id from its launch and, for running
+// sessions, the values of the attempt.
+func loadSession(id string) (*session, bool) {
+	l, state, err := loadLaunch(id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("scormrt: erro ao carregar sessão %s: %v", id, err)
+		}
+		return nil, false
+	}
+
+	sess := &session{model: modelFor(l.Version), state: state, launch: l, lastError: errNone}
+	sess.seed()
+	if state == running && l.AttemptID != 0 {
+		stored, err := attemptValues(l.AttemptID)
+		if err != nil {
+			log.Printf("scormrt: erro ao carregar tentativa %d: %v", l.AttemptID, err)
+		}
+		if l.recorded() {
+			for element, value := range stored {
+				sess.values[element] = value
+			}
+		} else {
+			sess.restore(stored, "")
+		}
+	}
+	return sess, true
+}
+
+// seed fills the session values with the data model defaults and the values
+// the LMS provides for the launch.
+func (sess *session) seed() {
+	sess.values = make(map[string]string, len(sess.model.defaults))
+	for element, value := range sess.model.defaults {
+		sess.values[element] = value
+	}
+
+	names := sess.model.names
+	sess.values[names.learnerID] = strconv.Itoa(sess.launch.UserID)
+	sess.values[names.learnerName] = sess.launch.LearnerName
+	sess.values[names.launchData] = sess.launch.LaunchData
+	if sess.launch.Mode != "" {
+		sess.values[names.mode] = sess.launch.Mode
+	}
+	if sess.launch.Credit != "" {
+		sess.values[names.credit] = sess.launch.Credit
+	}
+	if sess.launch.PassingScore != nil {
+		sess.values[names.passingScore] = formatReal(*sess.launch.PassingScore * sess.model.passingScale)
+	}
+	if sess.launch.MaxTimeAllowed > 0 {
+		sess.values[names.maxTimeAllowed] = sess.model.formatTime(sess.launch.MaxTimeAllowed)
+	}
+	if sess.launch.TimeLimitAction != "" {
+		sess.values[names.timeLimitAction] = sess.launch.TimeLimitAction
+	}
+	if sess.launch.CompletionThreshold != nil && names.completionThreshold != "" {
+		sess.values[names.completionThreshold] = formatReal(*sess.launch.CompletionThreshold)
+	}
+}
+
+// formatReal formats f as a real(10,7), dropping the float noise scaling
+// adds (0.57*100 is 56.99999999999999).
+func formatReal(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1e7)/1e7, 'f', -1, 64)
+}
+
+// fail records code as the session's last error and returns "false".
+func (sess *session) fail(code string) string {
+	sess.lastError = code
+	return "false"
+}
+
+// Initialize moves a session from Not Initialized to Running, restoring the
+// values of the attempt when the launch resumed a suspended one.
+func (s *RuntimeService) Initialize(id string) string {
+	sess, ok := s.lookup(id)
+	if !ok {
+		return "false"
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	switch sess.state {
+	case running:
+		return sess.fail(sess.model.errs.alreadyInitialized)
+	case terminated:
+		return sess.fail(sess.model.errs.instanceTerminated)
+	}
+
+	sess.seed()
+	if sess.launch.Resumed || sess.launch.Mode == modeReview {
+		stored, err := attemptValues(sess.launch.AttemptID)
+		if err != nil {
+			log.Printf("scormrt: erro ao carregar tentativa %d: %v", sess.launch.AttemptID, err)
+			return sess.fail(sess.model.errs.initFailure)
+		}
+		entry := "resume"
+		if sess.launch.Mode == modeReview {
+			entry = ""
+		}
+		sess.restore(stored, entry)
+	}
+	if sess.launch.Version == SCORM2004 && sess.launch.recorded() {
+		if err := sess.seedNavigation(); err != nil {
+			log.Printf("scormrt: erro ao avaliar navegação da sessão %s: %v", id, err)
+		}
+	}
+
+	if err := saveLaunchState(id, running); err != nil {
+		log.Printf("scormrt: erro ao salvar estado da sessão %s: %v", id, err)
+		return sess.fail(sess.model.errs.initFailure)
+	}
+	sess.state = running
+	sess.lastError = errNone
 	return "true"
 }
 
-// GetValue retrieves a value for an element.
-func (s *RuntimeService) GetValue(session, element string) string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	if vals, ok := s.sessions[session]; ok {
-		if v, ok := vals[element]; ok {
-			s.lastError[session] = "0"
-			return v
+// Terminate moves a running session to Terminated. Its values are kept so
+// they can still be persisted.
+func (s *RuntimeService) Terminate(id string) string {
+	sess, ok := s.lookup(id)
+	if !ok {
+		return "false"
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	switch sess.state {
+	case notInitialized:
+		return sess.fail(sess.model.errs.terminateBeforeInit)
+	case terminated:
+		return sess.fail(sess.model.errs.terminateAfterTerm)
+	}
+
+	total := sess.accumulateTime()
+	sess.evaluate()
+	if sess.launch.recorded() {
+		status := attemptEnded
+		if sess.values[sess.model.names.exit] == "suspend" && !sess.completed() {
+			status = attemptSuspended
 		}
+		if err := sess.persist(status, total); err != nil {
+			log.Printf("scormrt: erro ao salvar tentativa %d: %v", sess.launch.AttemptID, err)
+			sess.closeIfEnded(err)
+			return sess.fail(sess.model.errs.terminateFailure)
+		}
+		sess.record(total)
+	}
+	if err := saveLaunchState(id, terminated); err != nil {
+		log.Printf("scormrt: erro ao salvar estado da sessão %s: %v", id, err)
+		return sess.fail(sess.model.errs.terminateFailure)
 	}
-	s.lastError[session] = "101" // general error
-	return ""
+
+	sess.state = terminated
+	sess.lastError = errNone
+	return "true"
 }
 
-// SetValue stores a value for an element.
-func (s *RuntimeService) SetValue(session, element, value string) string {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.sessions[session]; !ok {
-		s.sessions[session] = make(map[string]string)
+// closeIfEnded terminates the session when err says its attempt was ended
+// outside it, as a forced migration to a new course version or a newer
+// launch of the same attempt does: nothing
+// the content sends can be stored anymore, so later calls fail as after
+// Terminate.
+func (sess *session) closeIfEnded(err error) {
+	if !errors.Is(err, errAttemptEnded) {
+		return
+	}
+	sess.state = terminated
+	if err := saveLaunchState(sess.launch.Token, terminated); err != nil {
+		log.Printf("scormrt: erro ao salvar estado da sessão %s: %v", sess.launch.Token, err)
+	}
+}
+
+// record propagates a terminated attempt to the sequencing state, the
+// progress table and the course rollup, and processes the navigation
+// request the SCO made. Failures are logged: the attempt itself is already
+// stored.
+func (sess *session) record(total time.Duration) {
+	if sess.launch.Version == SCORM2004 {
+		unlock := lockRegistration(sess.launch.UserID, sess.launch.CourseID)
+		if err := reportSequencing(sess.launch, sess.sequencingResults(total)); err != nil {
+			log.Printf("scormrt: erro ao atualizar sequenciamento da tentativa %d: %v", sess.launch.AttemptID, err)
+		}
+		value := sess.values["adl.nav.request"]
+		if req, ok := parseNavRequest(value); ok {
+			nav, err := navigate(sess.launch, value, req)
+			if err != nil {
+				log.Printf("scormrt: erro ao processar navegação %q da tentativa %d: %v", value, sess.launch.AttemptID, err)
+				nav.Error = err.Error()
+			}
+			sess.navigation = &nav
+		}
+		unlock()
 	}
-	s.sessions[session][element] = value
-	s.lastError[session] = "0"
+	lessonStatus, score := sess.outcome()
+	if err := recordProgress(sess.launch, lessonStatus, score, total); err != nil {
+		log.Printf("scormrt: erro ao registrar progresso da tentativa %d: %v", sess.launch.AttemptID, err)
+	}
+	if _, err := updateRollup(sess.launch.UserID, sess.launch.CourseID); err != nil {
+		log.Printf("scormrt: erro ao atualizar rollup da tentativa %d: %v", sess.launch.AttemptID, err)
+	}
+}
+
+// restore loads the values of a stored attempt: a suspended one being
+// resumed (entry resume) or the one a review launch shows (entry empty). The
+// exit and session time of the previous session are dropped. Values provided
+// by the LMS for this launch take precedence over stored ones.
+func (sess *session) restore(stored map[string]string, entry string) {
+	names := sess.model.names
+	lms := map[string]string{}
+	for _, name := range []string{
+		names.learnerName, names.launchData, names.mode, names.credit,
+		names.passingScore, names.maxTimeAllowed, names.timeLimitAction, names.completionThreshold,
+	} {
+		if v, ok := sess.values[name]; ok {
+			lms[name] = v
+		}
+	}
+	for element, value := range stored {
+		sess.values[element] = value
+	}
+	delete(sess.values, sess.model.names.exit)
+	delete(sess.values, sess.model.names.sessionTime)
+	if v, ok := sess.model.defaults["adl.nav.request"]; ok {
+		sess.values["adl.nav.request"] = v
+	}
+	for element, value := range lms {
+		sess.values[element] = value
+	}
+	sess.values[sess.model.names.entry] = entry
+}
+
+// persist stores the session values in the launch's attempt, together with
+// the interactions and objectives tables that mirror its collections.
+func (sess *session) persist(status string, total time.Duration) error {
+	if err := saveAttempt(sess.launch.Token, sess.launch.AttemptID, status, sess.values, total, sess.summary(total)); err != nil {
+		return err
+	}
+	return saveCollections(sess.launch.AttemptID, sess.model.interactions(sess.values), sess.model.objectives(sess.values))
+}
+
+// summary describes the outcome of the attempt for the attempt history.
+func (sess *session) summary(total time.Duration) attemptSummary {
+	r := sess.sequencingResults(total)
+	s := attemptSummary{Completion: r.Completion, Success: r.Success, ScoreScaled: r.Measure}
+	if s.Completion == "" {
+		s.Completion = statusUnknown
+	}
+	if s.Success != "passed" && s.Success != "failed" {
+		s.Success = statusUnknown
+	}
+	if raw, ok := parseReal(sess.values[sess.model.names.scoreRaw]); ok {
+		s.ScoreRaw = &raw
+	}
+	return s
+}
+
+// completed reports whether the content completed the attempt: a new
+// attempt starts on the next launch even if it asked to suspend.
+func (sess *session) completed() bool {
+	return sess.sequencingResults(0).Completion == "completed"
+}
+
+// totalTime returns the attempt's total time as currently stored.
+func (sess *session) totalTime() time.Duration {
+	total, _ := sess.model.parseTime(sess.values[sess.model.names.totalTime])
+	return total
+}
+
+// accumulateTime adds the session time reported by the content to the
+// attempt's total time and returns the new total.
+func (sess *session) accumulateTime() time.Duration {
+	total := sess.totalTime()
+	if d, ok := sess.model.parseTime(sess.values[sess.model.names.sessionTime]); ok {
+		total += d
+		sess.values[sess.model.names.totalTime] = sess.model.formatTime(total)
+	}
+	return total
+}
+
+// evaluate applies the status rules that come with the manifest settings. A
+// completion threshold decides completion from the progress measure and a
+// passing score decides success from the score, scaling a raw score with
+// score.min/score.max (0..100 by default) when the content reports no scaled
+// score. In SCORM 1.2 the mastery score is compared with the raw score and
+// only credit launches have their lesson status changed.
+func (sess *session) evaluate() {
+	names := sess.model.names
+	l := sess.launch
+
+	if l.CompletionThreshold != nil && names.completionThreshold != "" {
+		if measure, ok := parseReal(sess.values[names.progress]); ok {
+			sess.values[names.completion] = "incomplete"
+			if measure >= *l.CompletionThreshold {
+				sess.values[names.completion] = "completed"
+			}
+		}
+	}
+
+	if l.PassingScore == nil {
+		return
+	}
+	if names.success == "" {
+		raw, ok := parseReal(sess.values[names.scoreRaw])
+		if !ok || sess.values[names.credit] != "credit" {
+			return
+		}
+		sess.values[names.completion] = "failed"
+		if raw >= *l.PassingScore*sess.model.passingScale {
+			sess.values[names.completion] = "passed"
+		}
+		return
+	}
+
+	scaled, ok := sess.scaledScore()
+	if !ok {
+		return
+	}
+	sess.values[names.success] = "failed"
+	if scaled >= *l.PassingScore {
+		sess.values[names.success] = "passed"
+	}
+}
+
+// scaledScore returns score.scaled or, when the content only reported a raw
+// score, the raw score scaled between score.min and score.max.
+func (sess *session) scaledScore() (float64, bool) {
+	names := sess.model.names
+	if scaled, ok := parseReal(sess.values[names.scoreScaled]); ok {
+		return scaled, true
+	}
+
+	raw, ok := parseReal(sess.values[names.scoreRaw])
+	if !ok {
+		return 0, false
+	}
+	min, max := 0.0, 100.0
+	if v, ok := parseReal(sess.values[names.scoreMin]); ok {
+		min = v
+	}
+	if v, ok := parseReal(sess.values[names.scoreMax]); ok {
+		max = v
+	}
+	if max <= min {
+		return 0, false
+	}
+	return (raw - min) / (max - min), true
+}
+
+// outcome returns the status and rounded raw score reported to the progress
+// table. A known success status takes precedence over the completion status.
+func (sess *session) outcome() (string, int) {
+	names := sess.model.names
+	status := sess.values[names.completion]
+	if names.success != "" {
+		if success := sess.values[names.success]; success == "passed" || success == "failed" {
+			status = success
+		}
+	}
+
+	score := 0
+	if raw, ok := parseReal(sess.values[names.scoreRaw]); ok {
+		score = int(math.Round(raw))
+	}
+	return status, score
+}
+
+// GetValue retrieves a value for an element, validating it against the
+// session's data model.
+func (s *RuntimeService) GetValue(id, element string) string {
+	sess, ok := s.lookup(id)
+	if !ok {
+		return ""
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	switch sess.state {
+	case notInitialized:
+		sess.lastError = sess.model.errs.getBeforeInit
+		return ""
+	case terminated:
+		sess.lastError = sess.model.errs.getAfterTerm
+		return ""
+	}
+
+	value, code := sess.model.get(sess.values, element)
+	sess.lastError = code
+	return value
+}
+
+// SetValue validates and stores a value for an element.
+func (s *RuntimeService) SetValue(id, element, value string) string {
+	sess, ok := s.lookup(id)
+	if !ok {
+		return "false"
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	switch sess.state {
+	case notInitialized:
+		return sess.fail(sess.model.errs.setBeforeInit)
+	case terminated:
+		return sess.fail(sess.model.errs.setAfterTerm)
+	}
+
+	if code := sess.model.set(sess.values, element, value); code != errNone {
+		return sess.fail(code)
+	}
+	sess.lastError = errNone
 	return "true"
 }
 
-// Commit would persist the session values. Here we simply acknowledge.
-func (s *RuntimeService) Commit(session string) string {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.sessions[session]; ok {
-		s.lastError[session] = "0"
-		return "true"
+// Commit persists the session values in the launch's attempt.
+func (s *RuntimeService) Commit(id string) string {
+	sess, ok := s.lookup(id)
+	if !ok {
+		return "false"
 	}
-	s.lastError[session] = "101"
-	return "false"
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	switch sess.state {
+	case notInitialized:
+		return sess.fail(sess.model.errs.commitBeforeInit)
+	case terminated:
+		return sess.fail(sess.model.errs.commitAfterTerm)
+	}
+
+	sess.evaluate()
+	if sess.launch.recorded() {
+		if err := sess.persist(attemptActive, sess.totalTime()); err != nil {
+			log.Printf("scormrt: erro ao salvar tentativa %d: %v", sess.launch.AttemptID, err)
+			sess.closeIfEnded(err)
+			return sess.fail(sess.model.errs.commitFailure)
+		}
+	}
+
+	sess.lastError = errNone
+	return "true"
+}
+
+// Snapshot returns a copy of every readable value of a running session.
+func (s *RuntimeService) Snapshot(id string) map[string]string {
+	sess, ok := s.lookup(id)
+	if !ok {
+		return nil
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.state != running {
+		return nil
+	}
+
+	snapshot := make(map[string]string, len(sess.values))
+	for element, value := range sess.values {
+		if sess.model.readable(element) {
+			snapshot[element] = value
+		}
+	}
+	return snapshot
+}
+
+// Queueable returns the text elements outside collections of a session with
+// their maximum length, for adapters that queue SetValue calls.
+func (s *RuntimeService) Queueable(id string) map[string]int {
+	sess, ok := s.lookup(id)
+	if !ok {
+		return nil
+	}
+	return sess.model.queueable()
+}
+
+// Navigated returns the outcome of the navigation request a terminated
+// session made, or nil when it made none.
+func (s *RuntimeService) Navigated(id string) *Navigation {
+	sess, ok := s.cached(id)
+	if !ok {
+		return nil
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.state != terminated {
+		return nil
+	}
+	return sess.navigation
 }
 
 // GetLastError returns the last error code for a session.
-func (s *RuntimeService) GetLastError(session string) string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	if code, ok := s.lastError[session]; ok {
-		return code
+func (s *RuntimeService) GetLastError(id string) string {
+	sess, ok := s.cached(id)
+	if !ok {
+		return errNone
 	}
-	return "0"
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.lastError
 }
 
-// GetErrorString maps error codes to messages.
-func (s *RuntimeService) GetErrorString(code string) string {
-	switch code {
-	case "0":
-		return "No error"
-	case "101":
-		return "General exception"
-	default:
-		return "Unknown error"
+// GetErrorString maps error codes to the messages of the session's version.
+func (s *RuntimeService) GetErrorString(id, code string) string {
+	messages := errorStrings
+	if sess, ok := s.lookup(id); ok {
+		messages = sess.model.messages
+	}
+	if msg, ok := messages[code]; ok {
+		return msg
 	}
+	return "Unknown error"
 }
 
 // GetDiagnostic returns diagnostic info for the code.
-func (s *RuntimeService) GetDiagnostic(code string) string {
-	return s.GetErrorString(code)
+func (s *RuntimeService) GetDiagnostic(id, code string) string {
+	return s.GetErrorString(id, code)
 }
 
 // exported helper functions using the default service
+func Exists(session string) bool       { return defaultService.Exists(session) }
 func Initialize(session string) string { return defaultService.Initialize(session) }
 func Terminate(session string) string  { return defaultService.Terminate(session) }
 func GetValue(session, element string) string {
@@ -115,7 +648,20 @@ func GetValue(session, element string) string {
 func SetValue(session, element, value string) string {
 	return defaultService.SetValue(session, element, value)
 }
-func Commit(session string) string       { return defaultService.Commit(session) }
+func Commit(session string) string { return defaultService.Commit(session) }
+func Navigated(session string) *Navigation {
+	return defaultService.Navigated(session)
+}
+func Snapshot(session string) map[string]string {
+	return defaultService.Snapshot(session)
+}
+func Queueable(session string) map[string]int {
+	return defaultService.Queueable(session)
+}
 func GetLastError(session string) string { return defaultService.GetLastError(session) }
-func GetErrorString(code string) string  { return defaultService.GetErrorString(code) }
-func GetDiagnostic(code string) string   { return defaultService.GetDiagnostic(code) }
+func GetErrorString(session, code string) string {
+	return defaultService.GetErrorString(session, code)
+}
+func GetDiagnostic(session, code string) string {
+	return defaultService.GetDiagnostic(session, code)
+}
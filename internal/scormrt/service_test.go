@@ -0,0 +1,221 @@
+package scormrt
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// age moves the session's last use and the service's last sweep back by d.
+func age(s *RuntimeService, id string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[id].lastUsed = s.sessions[id].lastUsed.Add(-d)
+	s.lastSweep = s.lastSweep.Add(-d)
+}
+
+func inMemory(s *RuntimeService, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.sessions[id]
+	return ok
+}
+
+func TestTerminatedSessionsAreEvicted(t *testing.T) {
+	s := NewService()
+	token := browseSession(t, SCORM2004)
+	if got := s.Initialize(token); got != "true" {
+		t.Fatalf("Initialize = %s", got)
+	}
+	if got := s.Terminate(token); got != "true" {
+		t.Fatalf("Terminate = %s", got)
+	}
+
+	// calls made right after Terminate still see the session
+	if got := s.Terminate(token); got != "false" || s.GetLastError(token) != "113" {
+		t.Fatalf("second Terminate = %s, last error %s, want false and 113", got, s.GetLastError(token))
+	}
+
+	age(s, token, terminatedSessionTTL)
+	other := browseSession(t, SCORM2004)
+	s.Exists(other)
+	if inMemory(s, token) {
+		t.Fatal("terminated session still in memory after the grace period")
+	}
+
+	// an evicted token is loaded again in the state it was left in
+	if got := s.Initialize(token); got != "false" || s.GetLastError(token) != "104" {
+		t.Errorf("Initialize after eviction = %s, last error %s, want false and 104", got, s.GetLastError(token))
+	}
+}
+
+func TestIdleSessionsAreEvicted(t *testing.T) {
+	s := NewService()
+	token := browseSession(t, SCORM12)
+	if got := s.Initialize(token); got != "true" {
+		t.Fatalf("LMSInitialize = %s", got)
+	}
+
+	age(s, token, terminatedSessionTTL)
+	s.Exists(browseSession(t, SCORM12))
+	if !inMemory(s, token) {
+		t.Fatal("running session evicted before going idle")
+	}
+
+	age(s, token, idleSessionTTL)
+	s.Exists(browseSession(t, SCORM12))
+	if inMemory(s, token) {
+		t.Fatal("idle session still in memory")
+	}
+	if got := s.GetValue(token, "cmi.core.lesson_status"); s.GetLastError(token) != errNone {
+		t.Errorf("GetValue after eviction = %q, last error %s", got, s.GetLastError(token))
+	}
+}
+
+func TestLastErrorIsPerSession(t *testing.T) {
+	s := NewService()
+	a := browseSession(t, SCORM2004)
+	b := browseSession(t, SCORM2004)
+	s.Initialize(a)
+	s.Initialize(b)
+
+	s.SetValue(a, "cmi.learner_id", "x")
+	s.SetValue(b, "cmi.location", "page-1")
+	if got := s.GetLastError(a); got != "404" {
+		t.Errorf("GetLastError(a) = %s, want 404", got)
+	}
+	if got := s.GetLastError(b); got != errNone {
+		t.Errorf("GetLastError(b) = %s, want 0", got)
+	}
+}
+
+func TestConcurrentCallsOnSessions(t *testing.T) {
+	s := NewService()
+	tokens := make([]string, 4)
+	for i := range tokens {
+		tokens[i] = browseSession(t, SCORM2004)
+	}
+
+	var wg sync.WaitGroup
+	for _, token := range tokens {
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.Initialize(token)
+				s.SetValue(token, "cmi.location", token)
+				s.GetValue(token, "cmi.location")
+				s.Commit(token)
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, token := range tokens {
+		if got := s.GetValue(token, "cmi.location"); got != token {
+			t.Errorf("cmi.location = %q, want %q", got, token)
+		}
+	}
+}
+
+func TestSessionRefusesEndedAttempt(t *testing.T) {
+	const userID, courseID = 7101, 7101
+	regID, err := ensureRegistration(userID, courseID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := Launch{Token: uuid.New().String(), RegistrationID: regID, UserID: userID, CourseID: courseID,
+		ScoID: "sco", Version: SCORM12, Mode: modeNormal, Credit: "credit"}
+	if err := startAttempt(&l, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewService()
+	s.Initialize(l.Token)
+	s.SetValue(l.Token, "cmi.core.lesson_location", "p1")
+	if got := s.Commit(l.Token); got != "true" {
+		t.Fatalf("LMSCommit = %s, error %s", got, s.GetLastError(l.Token))
+	}
+
+	// a forced migration ends the attempt under the running session
+	setAttempt(t, l.AttemptID, attemptEnded, `{"cmi.core.lesson_location":"p1"}`)
+	s.SetValue(l.Token, "cmi.core.lesson_location", "p2")
+	if got := s.Commit(l.Token); got != "false" || s.GetLastError(l.Token) != "101" {
+		t.Errorf("LMSCommit into an ended attempt = %s, error %s; want false, 101", got, s.GetLastError(l.Token))
+	}
+	if values, err := attemptValues(l.AttemptID); err != nil || values["cmi.core.lesson_location"] != "p1" {
+		t.Errorf("stored values = %v, %v; want the ones from before the migration", values, err)
+	}
+
+	// the session is closed for good
+	if got := s.SetValue(l.Token, "cmi.core.lesson_location", "p3"); got != "false" || s.GetLastError(l.Token) != "101" {
+		t.Errorf("LMSSetValue after the refused commit = %s, error %s", got, s.GetLastError(l.Token))
+	}
+	if _, state, err := loadLaunch(l.Token); err != nil || state != terminated {
+		t.Errorf("stored session state = %v, %v; want terminated", state, err)
+	}
+}
+
+func TestNewerLaunchReplacesSession(t *testing.T) {
+	const userID, courseID = 7201, 7201
+	regID, err := ensureRegistration(userID, courseID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	launch := func() Launch {
+		t.Helper()
+		l := Launch{Token: uuid.New().String(), RegistrationID: regID, UserID: userID, CourseID: courseID,
+			ScoID: "sco", Version: SCORM12, Mode: modeNormal, Credit: "credit"}
+		if err := startAttempt(&l, 0); err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+
+	// simultaneous launches agree on the attempt
+	launches := make(chan Launch, 4)
+	var wg sync.WaitGroup
+	for range cap(launches) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			launches <- launch()
+		}()
+	}
+	wg.Wait()
+	close(launches)
+	var attemptID int64
+	for l := range launches {
+		if attemptID != 0 && l.AttemptID != attemptID {
+			t.Fatalf("simultaneous launches opened attempts %d and %d", attemptID, l.AttemptID)
+		}
+		attemptID = l.AttemptID
+	}
+	var live int
+	err = storage.DB.QueryRow(`SELECT COUNT(*) FROM runtime_sessions WHERE attempt_id = ? AND state != 'terminated'`, attemptID).Scan(&live)
+	if err != nil || live != 1 {
+		t.Errorf("live sessions of the attempt = %d, %v; want 1", live, err)
+	}
+
+	s := NewService()
+	older := launch()
+	s.Initialize(older.Token)
+	s.SetValue(older.Token, "cmi.core.lesson_location", "older")
+
+	// the newer launch ends the older session, whose commit is refused
+	newer := launch()
+	s.Initialize(newer.Token)
+	s.SetValue(newer.Token, "cmi.core.lesson_location", "newer")
+	if got := s.Commit(newer.Token); got != "true" {
+		t.Fatalf("LMSCommit of the newer session = %s, error %s", got, s.GetLastError(newer.Token))
+	}
+	if got := s.Commit(older.Token); got != "false" || s.GetLastError(older.Token) != "101" {
+		t.Errorf("LMSCommit of the replaced session = %s, error %s; want false, 101", got, s.GetLastError(older.Token))
+	}
+	if values, err := attemptValues(attemptID); err != nil || values["cmi.core.lesson_location"] != "newer" {
+		t.Errorf("stored values = %v, %v; want the newer session's", values, err)
+	}
+}
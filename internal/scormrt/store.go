@@ -0,0 +1,489 @@
+package scormrt
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// Attempt statuses stored in the attempts table.
+const (
+	attemptActive    = "active"
+	attemptSuspended = "suspended"
+	attemptEnded     = "ended"
+)
+
+// errAttemptEnded reports a save into an attempt that was ended outside the
+// session, such as by a forced migration to a new course version, or from a
+// session a newer launch of the same attempt replaced.
+var errAttemptEnded = errors.New("attempt already ended")
+
+// Launch describes a launched SCO: the attempt its session runs in and the
+// values the LMS seeds into the data model on Initialize.
+type Launch struct {
+	Token          string
+	AttemptID      int64
+	RegistrationID int64
+	UserID         int
+	CourseID       int
+	// VersionID is the course version the session runs in.
+	VersionID   int64
+	ScoID       string
+	Version     Version
+	LearnerName string
+	LaunchData  string
+	Mode        string
+	Credit      string
+	// Resumed is set when the attempt was suspended, or left active with
+	// committed values, and its values must be restored with entry set to
+	// resume.
+	Resumed bool
+
+	// Settings of the manifest item. PassingScore and CompletionThreshold
+	// are scaled to 0..1 and nil when the manifest sets none; MaxTimeAllowed
+	// is zero when there is no limit.
+	PassingScore        *float64
+	MaxTimeAllowed      time.Duration
+	TimeLimitAction     string
+	CompletionThreshold *float64
+}
+
+// Launch modes, the values of cmi.mode (cmi.core.lesson_mode in 1.2).
+const (
+	modeNormal = "normal"
+	modeBrowse = "browse"
+	modeReview = "review"
+)
+
+// recorded reports whether the session's data counts for the learner: only
+// normal launches have attempts, progress and sequencing updated.
+func (l Launch) recorded() bool {
+	return l.Mode == modeNormal
+}
+
+var stateNames = map[sessionState]string{
+	notInitialized: "not initialized",
+	running:        "running",
+	terminated:     "terminated",
+}
+
+// ensureRegistration returns the registration of a learner in a course,
+// creating it in the given course version on the first launch.
+func ensureRegistration(userID, courseID int, versionID int64) (int64, error) {
+	_, err := storage.DB.Exec(`
+		INSERT OR IGNORE INTO registrations (user_id, course_id, version_id) VALUES (?, ?, ?)
+	`, userID, courseID, versionID)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = storage.DB.QueryRow(`
+		SELECT id FROM registrations WHERE user_id = ? AND course_id = ?
+	`, userID, courseID).Scan(&id)
+	return id, err
+}
+
+// execer runs statements either directly on the database or inside a
+// transaction.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// startAttempt opens the attempt of a normal launch and stores its session
+// in one transaction, so simultaneous launches of a SCO agree on the
+// attempt. An attempt runs in one session at a time: the older live
+// sessions of the attempt are ended, and what they still send is refused
+// with errAttemptEnded.
+func startAttempt(l *Launch, limit int) error {
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	l.AttemptID, l.Resumed, err = openAttempt(tx, l.RegistrationID, l.UserID, l.CourseID, l.ScoID, limit)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE runtime_sessions SET state = ? WHERE attempt_id = ? AND state != ?
+	`, stateNames[terminated], l.AttemptID, stateNames[terminated])
+	if err != nil {
+		return err
+	}
+	if err := insertLaunch(tx, *l); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// openAttempt returns the attempt a new launch of a SCO should run in. A
+// suspended attempt is resumed, and so is an active one: a learner who left
+// without terminating keeps the values of the last commit, and an attempt
+// that never stored data is simply reused. Neither counts as a new attempt.
+// Otherwise a new attempt is created, unless the learner already made limit
+// attempts on the SCO (zero means no limit), in which case errAttemptLimit is
+// returned.
+func openAttempt(tx *sql.Tx, registrationID int64, userID, courseID int, scoID string, limit int) (attemptID int64, resumed bool, err error) {
+	var status string
+	var cmiJSON sql.NullString
+	err = tx.QueryRow(`
+		SELECT id, status, cmi_json
+		FROM attempts
+		WHERE registration_id = ? AND sco_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, registrationID, scoID).Scan(&attemptID, &status, &cmiJSON)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, false, err
+	}
+
+	if err == nil {
+		switch {
+		case status == attemptSuspended:
+			_, err = tx.Exec(`
+				UPDATE attempts SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+			`, attemptActive, attemptID)
+			return attemptID, true, err
+		case status == attemptActive:
+			return attemptID, cmiJSON.Valid, nil
+		}
+	}
+
+	if limit > 0 {
+		var made int
+		err = tx.QueryRow(`
+			SELECT COUNT(*) FROM attempts WHERE registration_id = ? AND sco_id = ?
+		`, registrationID, scoID).Scan(&made)
+		if err != nil {
+			return 0, false, err
+		}
+		if made >= limit {
+			return 0, false, errAttemptLimit
+		}
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO attempts (registration_id, user_id, course_id, sco_id, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, registrationID, userID, courseID, scoID, attemptActive)
+	if err != nil {
+		return 0, false, err
+	}
+	attemptID, err = res.LastInsertId()
+	return attemptID, false, err
+}
+
+// lastAttempt returns the latest attempt of a learner on a SCO that stored
+// data, the one a review launch shows.
+func lastAttempt(userID, courseID int, scoID string) (int64, error) {
+	var attemptID int64
+	err := storage.DB.QueryRow(`
+		SELECT id FROM attempts
+		WHERE user_id = ? AND course_id = ? AND sco_id = ? AND cmi_json IS NOT NULL
+		ORDER BY id DESC
+		LIMIT 1
+	`, userID, courseID, scoID).Scan(&attemptID)
+	return attemptID, err
+}
+
+// attemptValues returns the CMI values last stored for an attempt.
+func attemptValues(attemptID int64) (map[string]string, error) {
+	var cmiJSON sql.NullString
+	err := storage.DB.QueryRow(`SELECT cmi_json FROM attempts WHERE id = ?`, attemptID).Scan(&cmiJSON)
+	if err != nil || !cmiJSON.Valid {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	err = json.Unmarshal([]byte(cmiJSON.String), &values)
+	return values, err
+}
+
+// attemptSummary is the outcome of an attempt kept next to its CMI values
+// for the attempt history, with SCORM 2004 status vocabularies.
+type attemptSummary struct {
+	Completion  string
+	Success     string
+	ScoreRaw    *float64
+	ScoreScaled *float64
+}
+
+// saveAttempt writes the CMI values, status, total time and outcome of the
+// attempt of a session. An attempt that was already ended, or a session that
+// was ended by a newer launch, leaves the attempt as is and errAttemptEnded
+// is returned.
+func saveAttempt(token string, attemptID int64, status string, values map[string]string, total time.Duration, summary attemptSummary) error {
+	cmiJSON, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	res, err := storage.DB.Exec(`
+		UPDATE attempts
+		SET status = ?, cmi_json = ?, total_seconds = ?,
+		    completion_status = ?, success_status = ?, score_raw = ?, score_scaled = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status != ?
+		  AND NOT EXISTS (SELECT 1 FROM runtime_sessions WHERE token = ? AND state = ?)
+	`, status, cmiJSON, total.Seconds(), summary.Completion, summary.Success, summary.ScoreRaw, summary.ScoreScaled,
+		attemptID, attemptEnded, token, stateNames[terminated])
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errAttemptEnded
+	}
+	return nil
+}
+
+// recordProgress adds a row to the progress table, the same one /track feeds,
+// so runtime sessions show up in the progress reports. The total time is
+// always stored as an ISO 8601 duration, whatever the SCORM version.
+func recordProgress(l Launch, status string, score int, total time.Duration) error {
+	_, err := storage.DB.Exec(`
+		INSERT INTO progress (user_id, course_id, sco_id, attempt_id, status, score, total_time)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, l.UserID, l.CourseID, l.ScoID, l.AttemptID, status, score, formatISODuration(total))
+	return err
+}
+
+// Attempt is an entry of a learner's attempt history. Number counts the
+// attempts on the same SCO from 1; Duration is the attempt's total time as an
+// ISO 8601 duration.
+type Attempt struct {
+	ID               int64    `json:"id"`
+	CourseID         int      `json:"courseId"`
+	ScoID            string   `json:"scoId"`
+	Number           int      `json:"number"`
+	Status           string   `json:"status"`
+	CompletionStatus string   `json:"completionStatus"`
+	SuccessStatus    string   `json:"successStatus"`
+	ScoreRaw         *float64 `json:"scoreRaw"`
+	ScoreScaled      *float64 `json:"scoreScaled"`
+	Duration         string   `json:"duration"`
+	TotalSeconds     float64  `json:"totalSeconds"`
+	CreatedAt        string   `json:"createdAt"`
+	UpdatedAt        string   `json:"updatedAt"`
+}
+
+// loadAttempts returns the attempts of a learner, optionally restricted to a
+// course (courseID > 0) and a SCO.
+func loadAttempts(userID, courseID int, scoID string) ([]Attempt, error) {
+	rows, err := storage.DB.Query(`
+		SELECT id, course_id, sco_id, number, status, completion_status, success_status,
+		       score_raw, score_scaled, total_seconds, created_at, updated_at
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY registration_id, sco_id ORDER BY id) AS number
+			FROM attempts
+			WHERE user_id = ?
+		)
+		WHERE (? = 0 OR course_id = ?) AND (? = '' OR sco_id = ?)
+		ORDER BY id
+	`, userID, courseID, courseID, scoID, scoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []Attempt{}
+	for rows.Next() {
+		var a Attempt
+		var raw, scaled sql.NullFloat64
+		err := rows.Scan(&a.ID, &a.CourseID, &a.ScoID, &a.Number, &a.Status, &a.CompletionStatus, &a.SuccessStatus,
+			&raw, &scaled, &a.TotalSeconds, &a.CreatedAt, &a.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if raw.Valid {
+			a.ScoreRaw = &raw.Float64
+		}
+		if scaled.Valid {
+			a.ScoreScaled = &scaled.Float64
+		}
+		a.Duration = formatISODuration(time.Duration(a.TotalSeconds * float64(time.Second)))
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// saveCollections replaces the interactions and objectives stored for an
+// attempt.
+func saveCollections(attemptID int64, interactions []Interaction, objectives []Objective) error {
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM interactions WHERE attempt_id = ?`, attemptID); err != nil {
+		return err
+	}
+	for _, in := range interactions {
+		correct, err := json.Marshal(in.CorrectResponses)
+		if err != nil {
+			return err
+		}
+		objectiveIDs, err := json.Marshal(in.Objectives)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO interactions (attempt_id, idx, interaction_id, type, timestamp, weighting,
+			                          learner_response, result, latency, description, correct_responses, objective_ids)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, attemptID, in.Index, in.ID, in.Type, in.Timestamp, in.Weighting,
+			in.LearnerResponse, in.Result, in.Latency, in.Description, string(correct), string(objectiveIDs))
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM objectives WHERE attempt_id = ?`, attemptID); err != nil {
+		return err
+	}
+	for _, obj := range objectives {
+		_, err := tx.Exec(`
+			INSERT INTO objectives (attempt_id, idx, objective_id, success_status, completion_status,
+			                        score_scaled, score_raw, score_min, score_max, progress_measure, description)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, attemptID, obj.Index, obj.ID, obj.SuccessStatus, obj.CompletionStatus,
+			obj.ScoreScaled, obj.ScoreRaw, obj.ScoreMin, obj.ScoreMax, obj.ProgressMeasure, obj.Description)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// loadInteractions returns the interactions stored for an attempt.
+func loadInteractions(attemptID int64) ([]Interaction, error) {
+	rows, err := storage.DB.Query(`
+		SELECT idx, interaction_id, type, timestamp, weighting, learner_response,
+		       result, latency, description, correct_responses, objective_ids
+		FROM interactions
+		WHERE attempt_id = ?
+		ORDER BY idx
+	`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []Interaction{}
+	for rows.Next() {
+		var in Interaction
+		var correct, objectiveIDs string
+		err := rows.Scan(&in.Index, &in.ID, &in.Type, &in.Timestamp, &in.Weighting, &in.LearnerResponse,
+			&in.Result, &in.Latency, &in.Description, &correct, &objectiveIDs)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(correct), &in.CorrectResponses); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(objectiveIDs), &in.Objectives); err != nil {
+			return nil, err
+		}
+		result = append(result, in)
+	}
+	return result, rows.Err()
+}
+
+// loadObjectives returns the objectives stored for an attempt.
+func loadObjectives(attemptID int64) ([]Objective, error) {
+	rows, err := storage.DB.Query(`
+		SELECT idx, objective_id, success_status, completion_status, score_scaled,
+		       score_raw, score_min, score_max, progress_measure, description
+		FROM objectives
+		WHERE attempt_id = ?
+		ORDER BY idx
+	`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []Objective{}
+	for rows.Next() {
+		var obj Objective
+		err := rows.Scan(&obj.Index, &obj.ID, &obj.SuccessStatus, &obj.CompletionStatus, &obj.ScoreScaled,
+			&obj.ScoreRaw, &obj.ScoreMin, &obj.ScoreMax, &obj.ProgressMeasure, &obj.Description)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, obj)
+	}
+	return result, rows.Err()
+}
+
+// insertLaunch stores the session token minted by a launch.
+func insertLaunch(db execer, l Launch) error {
+	var maxTime *float64
+	if l.MaxTimeAllowed > 0 {
+		seconds := l.MaxTimeAllowed.Seconds()
+		maxTime = &seconds
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO runtime_sessions (token, attempt_id, user_id, course_id, version_id, sco_id, version, learner_name, launch_data, mode, credit, resumed, state,
+		                              passing_score, max_time_seconds, time_limit_action, completion_threshold)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, l.Token, l.AttemptID, l.UserID, l.CourseID, l.VersionID, l.ScoID, string(l.Version), l.LearnerName, l.LaunchData, l.Mode, l.Credit, l.Resumed, stateNames[notInitialized],
+		l.PassingScore, maxTime, l.TimeLimitAction, l.CompletionThreshold)
+	return err
+}
+
+// loadLaunch reads a session token and its state. It returns sql.ErrNoRows
+// for unknown tokens.
+func loadLaunch(token string) (Launch, sessionState, error) {
+	var l Launch
+	var version, state string
+	var passing, maxTime, threshold sql.NullFloat64
+	err := storage.DB.QueryRow(`
+		SELECT s.token, s.attempt_id, COALESCE(a.registration_id, 0),
+		       COALESCE(a.user_id, s.user_id), COALESCE(a.course_id, s.course_id), s.version_id, COALESCE(a.sco_id, s.sco_id), s.version,
+		       s.learner_name, s.launch_data, s.mode, s.credit, s.resumed, s.state,
+		       s.passing_score, s.max_time_seconds, s.time_limit_action, s.completion_threshold
+		FROM runtime_sessions s
+		LEFT JOIN attempts a ON a.id = s.attempt_id
+		WHERE s.token = ?
+	`, token).Scan(&l.Token, &l.AttemptID, &l.RegistrationID, &l.UserID, &l.CourseID, &l.VersionID, &l.ScoID, &version,
+		&l.LearnerName, &l.LaunchData, &l.Mode, &l.Credit, &l.Resumed, &state,
+		&passing, &maxTime, &l.TimeLimitAction, &threshold)
+	if err != nil {
+		return Launch{}, notInitialized, err
+	}
+	l.Version = Version(version)
+	if passing.Valid {
+		l.PassingScore = &passing.Float64
+	}
+	if maxTime.Valid {
+		l.MaxTimeAllowed = time.Duration(maxTime.Float64 * float64(time.Second))
+	}
+	if threshold.Valid {
+		l.CompletionThreshold = &threshold.Float64
+	}
+
+	for st, name := range stateNames {
+		if name == state {
+			return l, st, nil
+		}
+	}
+	return l, notInitialized, nil
+}
+
+// saveLaunchState records the state a session token reached.
+func saveLaunchState(token string, state sessionState) error {
+	_, err := storage.DB.Exec(`UPDATE runtime_sessions SET state = ? WHERE token = ?`, stateNames[state], token)
+	return err
+}
@@ -0,0 +1,61 @@
+package scormrt
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+func setAttempt(t *testing.T, attemptID int64, status string, cmiJSON any) {
+	t.Helper()
+	if _, err := storage.DB.Exec(`UPDATE attempts SET status = ?, cmi_json = ? WHERE id = ?`, status, cmiJSON, attemptID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenAttempt(t *testing.T) {
+	const userID, courseID = 7001, 7001
+	regID, err := ensureRegistration(userID, courseID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := func(limit int) (int64, bool, error) {
+		l := Launch{Token: uuid.New().String(), RegistrationID: regID, UserID: userID, CourseID: courseID, ScoID: "sco",
+			Version: SCORM12, Mode: modeNormal, Credit: "credit"}
+		err := startAttempt(&l, limit)
+		return l.AttemptID, l.Resumed, err
+	}
+
+	first, resumed, err := open(1)
+	if err != nil || resumed {
+		t.Fatalf("first launch = %d, %v, %v", first, resumed, err)
+	}
+
+	// an active attempt that never stored data is reused
+	if id, resumed, err := open(1); err != nil || id != first || resumed {
+		t.Errorf("relaunch without data = %d, %v, %v; want %d, false", id, resumed, err, first)
+	}
+
+	// an active attempt with committed data is resumed, even at the limit
+	setAttempt(t, first, attemptActive, `{"cmi.location":"p3"}`)
+	if id, resumed, err := open(1); err != nil || id != first || !resumed {
+		t.Errorf("relaunch after commit = %d, %v, %v; want %d, true", id, resumed, err, first)
+	}
+
+	// a suspended attempt is resumed and active again
+	setAttempt(t, first, attemptSuspended, `{"cmi.location":"p3"}`)
+	if id, resumed, err := open(1); err != nil || id != first || !resumed {
+		t.Errorf("relaunch of suspended attempt = %d, %v, %v; want %d, true", id, resumed, err, first)
+	}
+
+	// an ended attempt needs a new one, which the limit refuses
+	setAttempt(t, first, attemptEnded, `{"cmi.location":"p3"}`)
+	if _, _, err := open(1); err != errAttemptLimit {
+		t.Errorf("launch after ended attempt at limit = %v, want errAttemptLimit", err)
+	}
+	second, resumed, err := open(2)
+	if err != nil || second == first || resumed {
+		t.Errorf("launch after ended attempt = %d, %v, %v; want a new attempt", second, resumed, err)
+	}
+}
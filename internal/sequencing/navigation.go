@@ -0,0 +1,613 @@
+package sequencing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Navigation request kinds.
+const (
+	Start      = "start"
+	ResumeAll  = "resumeAll"
+	Continue   = "continue"
+	Previous   = "previous"
+	Choice     = "choice"
+	Jump       = "jump"
+	Exit       = "exit"
+	ExitAll    = "exitAll"
+	SuspendAll = "suspendAll"
+	Abandon    = "abandon"
+	AbandonAll = "abandonAll"
+
+	// retry is only issued by post condition rules.
+	retry = "retry"
+)
+
+// Request is a navigation request. Target names the activity of a choice or
+// jump request.
+type Request struct {
+	Kind   string `json:"request"`
+	Target string `json:"target,omitempty"`
+}
+
+// Outcome is the result of a navigation request: the leaf activity to
+// deliver, or the end of the sequencing session. Both are empty when the
+// request only exited the current activity.
+type Outcome struct {
+	Deliver    *Activity
+	EndSession bool
+}
+
+var (
+	ErrInvalidRequest = errors.New("invalid navigation request")
+	ErrNotAllowed     = errors.New("navigation request not allowed")
+	ErrUnknownTarget  = errors.New("unknown target activity")
+	ErrNoActivity     = errors.New("no activity available to deliver")
+)
+
+// Engine applies navigation requests to the sequencing state of a learner.
+type Engine struct {
+	tree  *Tree
+	state *State
+}
+
+// New creates an engine over an activity tree and a learner's state.
+func New(tree *Tree, state *State) *Engine {
+	return &Engine{tree: tree, state: state}
+}
+
+// State returns the sequencing state the engine updates.
+func (e *Engine) State() *State {
+	return e.state
+}
+
+// Current returns the activity being delivered, if any.
+func (e *Engine) Current() (*Activity, bool) {
+	if e.state.Current == "" {
+		return nil, false
+	}
+	return e.tree.Activity(e.state.Current)
+}
+
+func (e *Engine) current() *Activity {
+	a, _ := e.Current()
+	return a
+}
+
+// Navigate processes a navigation request: it checks that the request is
+// valid, ends the current attempt applying exit and post condition rules,
+// and walks the tree to the next activity to deliver.
+func (e *Engine) Navigate(req Request) (Outcome, error) {
+	current := e.current()
+	if err := e.validate(req, current); err != nil {
+		return Outcome{}, err
+	}
+
+	next := req
+	switch req.Kind {
+	case Continue, Previous, Choice, Jump, Exit:
+		if current != nil && e.state.of(current).Active {
+			override, end := e.terminate(current)
+			if end {
+				return Outcome{EndSession: true}, nil
+			}
+			if override.Kind != "" {
+				next = override
+			}
+		}
+	case Abandon:
+		e.state.of(current).Active = false
+		next = Request{Kind: Exit}
+	case ExitAll, AbandonAll:
+		e.endAll(req.Kind == ExitAll)
+		return Outcome{EndSession: true}, nil
+	case SuspendAll:
+		e.suspendAll(current)
+		return Outcome{EndSession: true}, nil
+	}
+
+	return e.sequence(next)
+}
+
+// Valid reports whether a navigation request would succeed from the current
+// state, without changing it.
+func (e *Engine) Valid(req Request) bool {
+	_, err := New(e.tree, e.state.clone()).Navigate(req)
+	return err == nil
+}
+
+// Deliver makes an activity launched outside of a navigation request the
+// current one, as if it had been chosen.
+func (e *Engine) Deliver(activityID string) error {
+	a, ok := e.tree.Activity(activityID)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownTarget, activityID)
+	}
+	if e.state.Current == a.ID && e.state.of(a).Active {
+		return nil
+	}
+	_, err := e.deliver(a)
+	return err
+}
+
+// Choose delivers an activity the learner picked outside of a navigation
+// request, such as a launch of a given item. It is checked as a choice
+// request would be, so control modes and hidden from choice rules apply.
+func (e *Engine) Choose(activityID string) error {
+	a, ok := e.tree.Activity(activityID)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownTarget, activityID)
+	}
+	if e.state.Current == a.ID && e.state.of(a).Active {
+		return nil
+	}
+	if err := e.validateChoice(a, e.current()); err != nil {
+		return err
+	}
+	_, err := e.deliver(a)
+	return err
+}
+
+// validate checks a navigation request against the current activity and
+// the control modes of the tree.
+func (e *Engine) validate(req Request, current *Activity) error {
+	switch req.Kind {
+	case Start:
+		if current != nil {
+			return fmt.Errorf("%w: the session already started", ErrNotAllowed)
+		}
+		if e.state.Suspended != "" {
+			return fmt.Errorf("%w: the session is suspended, use resumeAll", ErrNotAllowed)
+		}
+	case ResumeAll:
+		if current != nil || e.state.Suspended == "" {
+			return fmt.Errorf("%w: there is no suspended session", ErrNotAllowed)
+		}
+	case Continue, Previous:
+		if current == nil || current.Parent == nil {
+			return fmt.Errorf("%w: no current activity", ErrNotAllowed)
+		}
+		if !current.Parent.Def.Control.Flow {
+			return fmt.Errorf("%w: flow is disabled in %s", ErrNotAllowed, current.Parent.ID)
+		}
+		if req.Kind == Previous && current.Parent.Def.Control.ForwardOnly {
+			return fmt.Errorf("%w: %s is forward only", ErrNotAllowed, current.Parent.ID)
+		}
+	case Choice:
+		target, ok := e.tree.Activity(req.Target)
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownTarget, req.Target)
+		}
+		return e.validateChoice(target, current)
+	case Jump:
+		// jump requests come from the content and ignore the control modes
+		// and hidden from choice rules; only the target has to exist
+		if _, ok := e.tree.Activity(req.Target); !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownTarget, req.Target)
+		}
+	case Exit, Abandon:
+		if current == nil || !e.state.of(current).Active {
+			return fmt.Errorf("%w: no active activity", ErrNotAllowed)
+		}
+	case ExitAll, AbandonAll, SuspendAll:
+		if current == nil {
+			return fmt.Errorf("%w: no current activity", ErrNotAllowed)
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidRequest, req.Kind)
+	}
+	return nil
+}
+
+// validateChoice checks that target may be chosen: no activity on its path
+// is hidden from choice, every cluster below the common ancestor with the
+// current activity allows choice (and, when forward only, only forward
+// choices), and every active activity to be exited allows choice exit.
+func (e *Engine) validateChoice(target, current *Activity) error {
+	for _, a := range target.path() {
+		if e.ruleAction(a, a.Def.PreConditionRules, actionHiddenFromChoice) != "" {
+			return fmt.Errorf("%w: %s is hidden from choice", ErrNotAllowed, a.ID)
+		}
+	}
+
+	var common *Activity
+	if current != nil {
+		common = commonAncestor(current, target)
+		for a := current; a != nil && a != common; a = a.Parent {
+			if e.state.of(a).Active && !a.Def.Control.ChoiceExit {
+				return fmt.Errorf("%w: %s does not allow choice exit", ErrNotAllowed, a.ID)
+			}
+		}
+	}
+
+	for _, a := range target.path() {
+		if a.Parent == nil || common != nil && !common.isAncestorOf(a.Parent) {
+			continue
+		}
+		if !a.Parent.Def.Control.Choice {
+			return fmt.Errorf("%w: choice is disabled in %s", ErrNotAllowed, a.Parent.ID)
+		}
+		if a.Parent == common && common.Def.Control.ForwardOnly {
+			if from := childOnPath(common, current); from != nil && a.index() < from.index() {
+				return fmt.Errorf("%w: %s is forward only", ErrNotAllowed, common.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// terminate ends the attempt on the current activity, applies the exit
+// condition rules of its ancestors and then the post condition rules. It
+// returns the sequencing request a post condition rule asks for and whether
+// the session ended.
+func (e *Engine) terminate(a *Activity) (Request, bool) {
+	e.endAttempt(a)
+
+	path := a.path()
+	for _, anc := range path[:len(path)-1] {
+		if e.state.of(anc).Active && e.ruleAction(anc, anc.Def.ExitConditionRules, actionExit) != "" {
+			e.endDescendants(anc)
+			e.endAttempt(anc)
+			a = anc
+			break
+		}
+	}
+	e.state.Current = a.ID
+
+	for {
+		action := e.ruleAction(a, a.Def.PostConditionRules,
+			actionExitParent, actionExitAll, actionRetry, actionRetryAll, actionContinue, actionPrevious)
+		switch action {
+		case actionExitParent:
+			if a.Parent == nil {
+				return Request{}, false
+			}
+			a = a.Parent
+			if e.state.of(a).Active {
+				e.endAttempt(a)
+			}
+			e.state.Current = a.ID
+			continue
+		case actionExitAll:
+			e.endAll(true)
+			return Request{}, true
+		case actionRetry:
+			return Request{Kind: retry}, false
+		case actionRetryAll:
+			e.endAll(true)
+			return Request{Kind: Start}, false
+		case actionContinue:
+			return Request{Kind: Continue}, false
+		case actionPrevious:
+			return Request{Kind: Previous}, false
+		}
+		return Request{}, false
+	}
+}
+
+// sequence finds the activity a sequencing request leads to and delivers it.
+func (e *Engine) sequence(req Request) (Outcome, error) {
+	current := e.current()
+
+	switch req.Kind {
+	case Start:
+		return e.flowInto(e.tree.Root, true)
+	case ResumeAll:
+		a, ok := e.tree.Activity(e.state.Suspended)
+		if !ok {
+			return Outcome{}, fmt.Errorf("%w: %q", ErrUnknownTarget, e.state.Suspended)
+		}
+		return e.deliver(a)
+	case Continue, Previous:
+		forward := req.Kind == Continue
+		next, err := e.step(current, forward, nil)
+		if err != nil {
+			return Outcome{}, err
+		}
+		if next == nil && forward {
+			e.endAll(true)
+			return Outcome{EndSession: true}, nil
+		}
+		if next == nil {
+			return Outcome{}, fmt.Errorf("%w: already at the first activity", ErrNotAllowed)
+		}
+		leaf, err := e.enter(next, forward, nil)
+		if err != nil {
+			return Outcome{}, err
+		}
+		if leaf == nil && forward {
+			e.endAll(true)
+			return Outcome{EndSession: true}, nil
+		}
+		if leaf == nil {
+			return Outcome{}, ErrNoActivity
+		}
+		return e.deliver(leaf)
+	case Choice:
+		target, _ := e.tree.Activity(req.Target)
+		return e.flowInto(target, false)
+	case Jump:
+		// the target is delivered as is: it must be an available leaf
+		target, _ := e.tree.Activity(req.Target)
+		return e.deliver(target)
+	case retry:
+		return e.flowInto(current, false)
+	case Exit:
+		if current == nil || current.Parent == nil {
+			e.endAll(true)
+			return Outcome{EndSession: true}, nil
+		}
+		return Outcome{}, nil
+	}
+	return Outcome{}, fmt.Errorf("%w: %q", ErrInvalidRequest, req.Kind)
+}
+
+// flowInto delivers a, or the first leaf found by flowing forward into it
+// when a is a cluster. Skip rules of a itself only apply when flowing from
+// outside (start), not when a was chosen.
+func (e *Engine) flowInto(a *Activity, flowing bool) (Outcome, error) {
+	if flowing {
+		leaf, err := e.enter(a, true, nil)
+		if err != nil {
+			return Outcome{}, err
+		}
+		if leaf == nil {
+			return Outcome{}, ErrNoActivity
+		}
+		return e.deliver(leaf)
+	}
+
+	if a.IsLeaf() {
+		return e.deliver(a)
+	}
+	if !a.Def.Control.Flow {
+		return Outcome{}, fmt.Errorf("%w: flow is disabled in %s", ErrNotAllowed, a.ID)
+	}
+	leaf, err := e.enter(a.Children[0], true, a)
+	if err != nil {
+		return Outcome{}, err
+	}
+	if leaf == nil {
+		return Outcome{}, ErrNoActivity
+	}
+	return e.deliver(leaf)
+}
+
+// step moves from a to its next (or previous) sibling, going up to the
+// ancestors when a is the last (or first) child. It returns nil at the end
+// of the tree, or when leaving the cluster within.
+func (e *Engine) step(a *Activity, forward bool, within *Activity) (*Activity, error) {
+	for a != within && a.Parent != nil {
+		p := a.Parent
+		if !p.Def.Control.Flow {
+			return nil, fmt.Errorf("%w: flow is disabled in %s", ErrNotAllowed, p.ID)
+		}
+		if !forward && p.Def.Control.ForwardOnly {
+			return nil, fmt.Errorf("%w: %s is forward only", ErrNotAllowed, p.ID)
+		}
+		if sibling := a.sibling(forward); sibling != nil {
+			return sibling, nil
+		}
+		a = p
+	}
+	return nil, nil
+}
+
+// enter evaluates a as a flow candidate: skipped activities are passed over,
+// clusters are entered through their first (or last) child and the first
+// deliverable leaf is returned. It returns nil when the flow runs out of
+// activities.
+func (e *Engine) enter(a *Activity, forward bool, within *Activity) (*Activity, error) {
+	for a != nil {
+		switch e.ruleAction(a, a.Def.PreConditionRules, actionSkip, actionDisabled, actionStopForwardTraversal) {
+		case actionSkip:
+			next, err := e.step(a, forward, within)
+			if err != nil {
+				return nil, err
+			}
+			a = next
+			continue
+		case actionDisabled:
+			return nil, fmt.Errorf("%w: %s is disabled", ErrNoActivity, a.ID)
+		case actionStopForwardTraversal:
+			if forward {
+				return nil, fmt.Errorf("%w: %s stops forward traversal", ErrNoActivity, a.ID)
+			}
+		}
+
+		if !e.checkActivity(a) {
+			return nil, fmt.Errorf("%w: %s reached its attempt limit", ErrNoActivity, a.ID)
+		}
+		if a.IsLeaf() {
+			return a, nil
+		}
+		if !a.Def.Control.Flow {
+			return nil, fmt.Errorf("%w: flow is disabled in %s", ErrNotAllowed, a.ID)
+		}
+		if forward || a.Def.Control.ForwardOnly {
+			forward = true
+			a = a.Children[0]
+		} else {
+			a = a.Children[len(a.Children)-1]
+		}
+	}
+	return nil, nil
+}
+
+// deliver makes target the current activity: it checks every activity on its
+// path, ends the attempts left active outside that path and starts a new
+// attempt on each activity of the path that is not active.
+func (e *Engine) deliver(target *Activity) (Outcome, error) {
+	if !target.IsLeaf() {
+		return Outcome{}, fmt.Errorf("%w: %s is not a leaf", ErrNoActivity, target.ID)
+	}
+	for _, a := range target.path() {
+		if !e.checkActivity(a) {
+			return Outcome{}, fmt.Errorf("%w: %s is disabled or reached its attempt limit", ErrNoActivity, a.ID)
+		}
+	}
+
+	for i := len(e.tree.Activities) - 1; i >= 0; i-- {
+		a := e.tree.Activities[i]
+		if e.state.of(a).Active && !a.isAncestorOf(target) {
+			e.endAttempt(a)
+		}
+	}
+
+	for _, a := range target.path() {
+		st := e.state.of(a)
+		if st.Active {
+			continue
+		}
+		if st.Suspended {
+			st.Suspended = false
+		} else {
+			st.AttemptCount++
+			if a.IsLeaf() {
+				st.ProgressKnown, st.Completed = false, false
+				st.ObjectiveKnown, st.Satisfied = false, false
+				st.MeasureKnown, st.Measure = false, 0
+				st.Duration = 0
+			}
+		}
+		st.Active = true
+	}
+
+	e.state.Current = target.ID
+	e.state.Suspended = ""
+	return Outcome{Deliver: target}, nil
+}
+
+// endAttempt ends the attempt on an activity. Unless the content is trusted
+// to set them, a leaf that reported no completion or satisfaction is taken
+// as completed and satisfied. The new status is rolled up the tree.
+func (e *Engine) endAttempt(a *Activity) {
+	st := e.state.of(a)
+	if a.IsLeaf() && a.Def.Tracked && !st.Suspended {
+		if !a.Def.CompletionSetByContent && !st.ProgressKnown {
+			st.ProgressKnown, st.Completed = true, true
+		}
+		if !a.Def.ObjectiveSetByContent && !st.ObjectiveKnown {
+			st.ObjectiveKnown, st.Satisfied = true, true
+		}
+	}
+	st.Active = false
+	e.rollup(a)
+}
+
+// endDescendants ends the attempts still active below a, deepest first.
+func (e *Engine) endDescendants(a *Activity) {
+	for i := len(e.tree.Activities) - 1; i >= 0; i-- {
+		d := e.tree.Activities[i]
+		if d != a && a.isAncestorOf(d) && e.state.of(d).Active {
+			e.endAttempt(d)
+		}
+	}
+}
+
+// endAll ends every active attempt and closes the sequencing session. When
+// abandoning, statuses are left as they are.
+func (e *Engine) endAll(rollup bool) {
+	for i := len(e.tree.Activities) - 1; i >= 0; i-- {
+		a := e.tree.Activities[i]
+		st := e.state.of(a)
+		st.Suspended = false
+		if !st.Active {
+			continue
+		}
+		if rollup {
+			e.endAttempt(a)
+		} else {
+			st.Active = false
+		}
+	}
+	e.state.Current = ""
+	e.state.Suspended = ""
+}
+
+// suspendAll suspends the current activity and its ancestors so resumeAll
+// can deliver it again within the same attempts.
+func (e *Engine) suspendAll(current *Activity) {
+	e.rollup(current)
+	for _, a := range current.path() {
+		st := e.state.of(a)
+		st.Active = false
+		st.Suspended = true
+	}
+	e.state.Suspended = current.ID
+	e.state.Current = ""
+}
+
+// Results is what a SCO reported for its attempt, already mapped to SCORM
+// 2004 vocabularies: Completion is completed, incomplete or unknown and
+// Success is passed, failed or unknown.
+type Results struct {
+	Completion string
+	Success    string
+	Measure    *float64
+	Duration   time.Duration
+}
+
+// Report records the results of a SCO on its activity and rolls them up the
+// tree.
+func (e *Engine) Report(activityID string, r Results) error {
+	a, ok := e.tree.Activity(activityID)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownTarget, activityID)
+	}
+	if !a.Def.Tracked {
+		return nil
+	}
+
+	st := e.state.of(a)
+	switch r.Completion {
+	case "completed":
+		st.ProgressKnown, st.Completed = true, true
+	case "incomplete":
+		st.ProgressKnown, st.Completed = true, false
+	default:
+		st.ProgressKnown, st.Completed = false, false
+	}
+	switch r.Success {
+	case "passed":
+		st.ObjectiveKnown, st.Satisfied = true, true
+	case "failed":
+		st.ObjectiveKnown, st.Satisfied = true, false
+	default:
+		st.ObjectiveKnown, st.Satisfied = false, false
+	}
+	st.MeasureKnown, st.Measure = r.Measure != nil, 0
+	if r.Measure != nil {
+		st.Measure = *r.Measure
+		if a.Def.SatisfiedByMeasure {
+			st.ObjectiveKnown, st.Satisfied = true, st.Measure >= a.Def.MinNormalizedMeasure
+		}
+	}
+	st.Duration = r.Duration
+
+	e.rollup(a)
+	return nil
+}
+
+func commonAncestor(a, b *Activity) *Activity {
+	for n := a; n != nil; n = n.Parent {
+		if n.isAncestorOf(b) {
+			return n
+		}
+	}
+	return nil
+}
+
+// childOnPath returns the child of a that is an ancestor of (or is) b.
+func childOnPath(a, b *Activity) *Activity {
+	if b == nil {
+		return nil
+	}
+	for n := b; n.Parent != nil; n = n.Parent {
+		if n.Parent == a {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package sequencing
+
+import (
+	"errors"
+	"testing"
+
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+)
+
+// flowManifest returns an organization with two SCOs a and b whose root
+// allows only flow navigation.
+func flowManifest() scorm.Manifest {
+	return scorm.Manifest{
+		Organizations: scorm.Organizations{
+			Default: "org",
+			Organization: []scorm.Organization{{
+				Identifier: "org",
+				Items: []scorm.Item{
+					{Identifier: "a", IdentifierRef: "r"},
+					{Identifier: "b", IdentifierRef: "r"},
+				},
+				Sequencing: &scorm.Sequencing{
+					ControlMode: &scorm.ControlMode{Choice: "false", Flow: "true"},
+				},
+			}},
+		},
+	}
+}
+
+func buildTree(t *testing.T, manifest scorm.Manifest) *Tree {
+	t.Helper()
+	tree, err := Build(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestChooseChecksChoiceControlMode(t *testing.T) {
+	engine := New(buildTree(t, flowManifest()), NewState())
+
+	if err := engine.Choose("b"); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("Choose(b) error = %v, want ErrNotAllowed", err)
+	}
+	if engine.State().Current != "" {
+		t.Errorf("refused choice changed the current activity to %q", engine.State().Current)
+	}
+
+	if err := engine.Deliver("a"); err != nil {
+		t.Fatalf("Deliver(a) error = %v", err)
+	}
+	// relaunching the current activity is always allowed
+	if err := engine.Choose("a"); err != nil {
+		t.Errorf("Choose(a) on the current activity error = %v", err)
+	}
+}
+
+func TestChooseDeliversAllowedTarget(t *testing.T) {
+	manifest := flowManifest()
+	manifest.Organizations.Organization[0].Sequencing = nil
+	engine := New(buildTree(t, manifest), NewState())
+
+	if err := engine.Choose("b"); err != nil {
+		t.Fatalf("Choose(b) error = %v", err)
+	}
+	if st := engine.State().Activities["b"]; engine.State().Current != "b" || st == nil || !st.Active || st.AttemptCount != 1 {
+		t.Errorf("state after Choose(b) = %+v, want b current with an active attempt", engine.State())
+	}
+}
+
+func TestJumpIgnoresChoiceControlModes(t *testing.T) {
+	manifest := flowManifest()
+	org := &manifest.Organizations.Organization[0]
+	org.Sequencing.ControlMode.ChoiceExit = "false"
+	org.Items = append(org.Items, scorm.Item{Identifier: "cluster", Items: []scorm.Item{{Identifier: "c", IdentifierRef: "r"}}})
+	engine := New(buildTree(t, manifest), NewState())
+
+	if _, err := engine.Navigate(Request{Kind: Start}); err != nil {
+		t.Fatal(err)
+	}
+	if engine.Valid(Request{Kind: Choice, Target: "b"}) {
+		t.Error("choice valid in a cluster with choice disabled")
+	}
+	if !engine.Valid(Request{Kind: Jump, Target: "b"}) {
+		t.Error("jump not valid in a cluster with choice disabled")
+	}
+
+	outcome, err := engine.Navigate(Request{Kind: Jump, Target: "b"})
+	if err != nil || outcome.Deliver == nil || outcome.Deliver.ID != "b" {
+		t.Fatalf("jump to b = %+v, %v", outcome, err)
+	}
+	if st := engine.State().Activities["a"]; st.Active {
+		t.Error("jump left the previous activity active")
+	}
+}
+
+func TestJumpTargetMustBeAvailableLeaf(t *testing.T) {
+	manifest := flowManifest()
+	org := &manifest.Organizations.Organization[0]
+	org.Items = append(org.Items, scorm.Item{Identifier: "cluster", Items: []scorm.Item{{Identifier: "c", IdentifierRef: "r"}}})
+	org.Items[1].Sequencing = &scorm.Sequencing{LimitConditions: &scorm.LimitConditions{AttemptLimit: "1"}}
+	engine := New(buildTree(t, manifest), NewState())
+	if _, err := engine.Navigate(Request{Kind: Start}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := engine.Navigate(Request{Kind: Jump, Target: "missing"}); !errors.Is(err, ErrUnknownTarget) {
+		t.Errorf("jump to unknown activity: %v, want ErrUnknownTarget", err)
+	}
+	if engine.Valid(Request{Kind: Jump, Target: "cluster"}) {
+		t.Error("jump to a cluster is valid")
+	}
+
+	// b can be attempted once
+	if _, err := engine.Navigate(Request{Kind: Jump, Target: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Navigate(Request{Kind: Jump, Target: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if engine.Valid(Request{Kind: Jump, Target: "b"}) {
+		t.Error("jump valid to an activity at its attempt limit")
+	}
+}
+
+func TestFlowNavigation(t *testing.T) {
+	engine := New(buildTree(t, flowManifest()), NewState())
+
+	steps := []struct {
+		kind    string
+		deliver string
+	}{
+		{Start, "a"},
+		{Continue, "b"},
+		{Previous, "a"},
+		{Continue, "b"},
+	}
+	for _, s := range steps {
+		outcome, err := engine.Navigate(Request{Kind: s.kind})
+		if err != nil || outcome.Deliver == nil || outcome.Deliver.ID != s.deliver {
+			t.Fatalf("%s = %+v, %v; want %s delivered", s.kind, outcome, err, s.deliver)
+		}
+	}
+	if st := engine.State().Activities["a"]; st.AttemptCount != 2 || st.Active {
+		t.Errorf("state of a = %+v, want two ended attempts", st)
+	}
+
+	// continuing past the last activity ends the session
+	outcome, err := engine.Navigate(Request{Kind: Continue})
+	if err != nil || !outcome.EndSession {
+		t.Fatalf("Continue from b = %+v, %v; want the end of the session", outcome, err)
+	}
+	if engine.State().Current != "" {
+		t.Errorf("current activity after the end = %q", engine.State().Current)
+	}
+}
+
+func TestFlowNavigationChecks(t *testing.T) {
+	manifest := flowManifest()
+	manifest.Organizations.Organization[0].Sequencing.ControlMode.ForwardOnly = "true"
+	engine := New(buildTree(t, manifest), NewState())
+
+	if _, err := engine.Navigate(Request{Kind: Continue}); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("Continue before Start error = %v, want ErrNotAllowed", err)
+	}
+	if _, err := engine.Navigate(Request{Kind: "sideways"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("unknown request error = %v, want ErrInvalidRequest", err)
+	}
+	if _, err := engine.Navigate(Request{Kind: Start}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Navigate(Request{Kind: Start}); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("second Start error = %v, want ErrNotAllowed", err)
+	}
+	if _, err := engine.Navigate(Request{Kind: Continue}); err != nil {
+		t.Fatal(err)
+	}
+	if engine.Valid(Request{Kind: Previous}) {
+		t.Error("Previous valid in a forward only cluster")
+	}
+	if _, err := engine.Navigate(Request{Kind: Previous}); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("Previous error = %v, want ErrNotAllowed", err)
+	}
+	if engine.State().Current != "b" {
+		t.Errorf("refused Previous moved the current activity to %q", engine.State().Current)
+	}
+}
+
+func TestSuspendAndResume(t *testing.T) {
+	engine := New(buildTree(t, flowManifest()), NewState())
+	for _, kind := range []string{Start, Continue} {
+		if _, err := engine.Navigate(Request{Kind: kind}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := engine.Navigate(Request{Kind: SuspendAll}); err != nil {
+		t.Fatal(err)
+	}
+	if st := engine.State(); st.Current != "" || st.Suspended != "b" {
+		t.Fatalf("state after SuspendAll = %+v, want b suspended", st)
+	}
+	if _, err := engine.Navigate(Request{Kind: Start}); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("Start on a suspended session error = %v, want ErrNotAllowed", err)
+	}
+
+	outcome, err := engine.Navigate(Request{Kind: ResumeAll})
+	if err != nil || outcome.Deliver == nil || outcome.Deliver.ID != "b" {
+		t.Fatalf("ResumeAll = %+v, %v; want b delivered", outcome, err)
+	}
+	if engine.State().Suspended != "" {
+		t.Errorf("suspended activity kept after ResumeAll: %q", engine.State().Suspended)
+	}
+}
@@ -0,0 +1,186 @@
+package sequencing
+
+// Rollup rule actions.
+const (
+	rollupSatisfied    = "satisfied"
+	rollupNotSatisfied = "notSatisfied"
+	rollupCompleted    = "completed"
+	rollupIncomplete   = "incomplete"
+)
+
+// defaultRollupRules apply to clusters that define no rule for an action.
+var defaultRollupRules = map[string]RollupRule{
+	rollupSatisfied:    {ChildActivitySet: "all", Conditions: []Condition{{Condition: "satisfied"}}, Action: rollupSatisfied},
+	rollupNotSatisfied: {ChildActivitySet: "all", Conditions: []Condition{{Condition: "objectiveStatusKnown"}}, Action: rollupNotSatisfied},
+	rollupCompleted:    {ChildActivitySet: "all", Conditions: []Condition{{Condition: "completed"}}, Action: rollupCompleted},
+	rollupIncomplete:   {ChildActivitySet: "all", Conditions: []Condition{{Condition: "activityProgressKnown"}}, Action: rollupIncomplete},
+}
+
+// rollup updates the status of every ancestor of a, from its parent up to
+// the root.
+func (e *Engine) rollup(a *Activity) {
+	for p := a.Parent; p != nil; p = p.Parent {
+		e.rollupCluster(p)
+	}
+}
+
+// Rollup recomputes the status of every cluster of the tree from the status
+// of its leaves, deepest clusters first.
+func (e *Engine) Rollup() {
+	for i := len(e.tree.Activities) - 1; i >= 0; i-- {
+		if a := e.tree.Activities[i]; !a.IsLeaf() {
+			e.rollupCluster(a)
+		}
+	}
+}
+
+func (e *Engine) rollupCluster(a *Activity) {
+	e.measureRollup(a)
+	e.objectiveRollup(a)
+	e.progressRollup(a)
+}
+
+// measureRollup sets the measure of a cluster to the weighted average of the
+// measures of its tracked children. Children without a measure count with
+// their weight but add nothing.
+func (e *Engine) measureRollup(a *Activity) {
+	var total, weighted float64
+	known := false
+	for _, c := range a.Children {
+		if !c.Def.Tracked {
+			continue
+		}
+		total += c.Def.ObjectiveMeasureWeight
+		if cs := e.state.of(c); cs.MeasureKnown {
+			known = true
+			weighted += cs.Measure * c.Def.ObjectiveMeasureWeight
+		}
+	}
+
+	st := e.state.of(a)
+	st.MeasureKnown = known && total > 0
+	st.Measure = 0
+	if st.MeasureKnown {
+		st.Measure = weighted / total
+	}
+}
+
+// objectiveRollup derives the satisfaction of a cluster, from its measure
+// when the primary objective is satisfied by measure and from the rollup
+// rules otherwise. While the cluster is active its measure only decides
+// satisfaction when measureSatisfactionIfActive is set.
+func (e *Engine) objectiveRollup(a *Activity) {
+	st := e.state.of(a)
+	if a.Def.SatisfiedByMeasure {
+		st.ObjectiveKnown, st.Satisfied = false, false
+		if st.MeasureKnown && (!st.Active || a.Def.MeasureSatisfactionIfActive) {
+			st.ObjectiveKnown, st.Satisfied = true, st.Measure >= a.Def.MinNormalizedMeasure
+		}
+		return
+	}
+
+	st.ObjectiveKnown, st.Satisfied = false, false
+	if e.rollupApplies(a, rollupNotSatisfied) {
+		st.ObjectiveKnown, st.Satisfied = true, false
+	}
+	if e.rollupApplies(a, rollupSatisfied) {
+		st.ObjectiveKnown, st.Satisfied = true, true
+	}
+}
+
+// progressRollup derives the completion of a cluster from the rollup rules.
+func (e *Engine) progressRollup(a *Activity) {
+	st := e.state.of(a)
+	st.ProgressKnown, st.Completed = false, false
+	if e.rollupApplies(a, rollupIncomplete) {
+		st.ProgressKnown, st.Completed = true, false
+	}
+	if e.rollupApplies(a, rollupCompleted) {
+		st.ProgressKnown, st.Completed = true, true
+	}
+}
+
+// contributes reports whether a child takes part in the rollup rules of its
+// parent for an action: it must be tracked, roll up that status and meet the
+// adlseq requiredFor consideration of the action.
+func (e *Engine) contributes(c *Activity, action string) bool {
+	var rolledUp bool
+	var required string
+	switch action {
+	case rollupSatisfied:
+		rolledUp, required = c.Def.RollupObjectiveSatisfied, c.Def.RequiredForSatisfied
+	case rollupNotSatisfied:
+		rolledUp, required = c.Def.RollupObjectiveSatisfied, c.Def.RequiredForNotSatisfied
+	case rollupCompleted:
+		rolledUp, required = c.Def.RollupProgressCompletion, c.Def.RequiredForCompleted
+	case rollupIncomplete:
+		rolledUp, required = c.Def.RollupProgressCompletion, c.Def.RequiredForIncomplete
+	}
+	if !c.Def.Tracked || !rolledUp {
+		return false
+	}
+
+	st := e.state.of(c)
+	switch required {
+	case "ifAttempted":
+		return st.AttemptCount > 0
+	case "ifNotSkipped":
+		return e.ruleAction(c, c.Def.PreConditionRules, actionSkip) == ""
+	case "ifNotSuspended":
+		return st.AttemptCount > 0 && !st.Suspended
+	default:
+		return true
+	}
+}
+
+// rollupApplies reports whether any rollup rule of a cluster with the given
+// action holds, falling back to the default rule for that action.
+func (e *Engine) rollupApplies(a *Activity, action string) bool {
+	var rules []RollupRule
+	for _, r := range a.Def.RollupRules {
+		if r.Action == action {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == 0 {
+		rules = []RollupRule{defaultRollupRules[action]}
+	}
+
+	for _, r := range rules {
+		if e.ruleHolds(a, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleHolds evaluates the conditions of a rollup rule on each contributing
+// child and applies the rule's child activity set to the results.
+func (e *Engine) ruleHolds(a *Activity, r RollupRule) bool {
+	var held, total int
+	for _, c := range a.Children {
+		if !e.contributes(c, r.Action) {
+			continue
+		}
+		total++
+		if e.matches(c, r.All, r.Conditions) {
+			held++
+		}
+	}
+	if total == 0 {
+		return false
+	}
+
+	switch r.ChildActivitySet {
+	case "any":
+		return held > 0
+	case "none":
+		return held == 0
+	case "atLeastCount":
+		return held >= r.MinimumCount
+	case "atLeastPercent":
+		return float64(held)/float64(total) >= r.MinimumPercent
+	default:
+		return held == total
+	}
+}
@@ -0,0 +1,63 @@
+package sequencing
+
+import (
+	"errors"
+	"testing"
+
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+)
+
+func TestReportRollsUpToTheRoot(t *testing.T) {
+	engine := New(buildTree(t, flowManifest()), NewState())
+	root := engine.tree.Root.ID
+	measure := func(v float64) *float64 { return &v }
+
+	if err := engine.Report("a", Results{Completion: "completed", Success: "passed", Measure: measure(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if st := engine.State().Activities[root]; st.Completed || st.Satisfied || !st.MeasureKnown || st.Measure != 0.5 {
+		t.Errorf("root after a = %+v, want incomplete, unsatisfied, measure 0.5", st)
+	}
+
+	if err := engine.Report("b", Results{Completion: "completed", Success: "passed", Measure: measure(0.5)}); err != nil {
+		t.Fatal(err)
+	}
+	st := engine.State().Activities[root]
+	if !st.ProgressKnown || !st.Completed || !st.ObjectiveKnown || !st.Satisfied || st.Measure != 0.75 {
+		t.Errorf("root after a and b = %+v, want completed, satisfied, measure 0.75", st)
+	}
+
+	if err := engine.Report("b", Results{Completion: "completed", Success: "failed"}); err != nil {
+		t.Fatal(err)
+	}
+	if st := engine.State().Activities[root]; !st.ObjectiveKnown || st.Satisfied {
+		t.Errorf("root after b failed = %+v, want not satisfied", st)
+	}
+
+	if err := engine.Report("missing", Results{}); !errors.Is(err, ErrUnknownTarget) {
+		t.Errorf("Report on an unknown activity error = %v, want ErrUnknownTarget", err)
+	}
+}
+
+func TestRollupSkipsUntrackedActivities(t *testing.T) {
+	manifest := flowManifest()
+	items := manifest.Organizations.Organization[0].Items
+	items[1].Sequencing = &scorm.Sequencing{
+		DeliveryControls: &scorm.DeliveryControls{Tracked: "false"},
+	}
+	engine := New(buildTree(t, manifest), NewState())
+
+	// an untracked activity neither records results nor holds its parent back
+	if err := engine.Report("b", Results{Completion: "completed", Success: "failed"}); err != nil {
+		t.Fatal(err)
+	}
+	if st := engine.State().Activities["b"]; st != nil && st.ObjectiveKnown {
+		t.Errorf("untracked b recorded %+v", st)
+	}
+	if err := engine.Report("a", Results{Completion: "completed", Success: "passed"}); err != nil {
+		t.Fatal(err)
+	}
+	if st := engine.State().Activities[engine.tree.Root.ID]; !st.Completed || !st.Satisfied {
+		t.Errorf("root = %+v, want completed and satisfied from a alone", st)
+	}
+}
@@ -0,0 +1,109 @@
+package sequencing
+
+// Rule actions of pre, exit and post condition rules.
+const (
+	actionSkip                 = "skip"
+	actionDisabled             = "disabled"
+	actionHiddenFromChoice     = "hiddenFromChoice"
+	actionStopForwardTraversal = "stopForwardTraversal"
+	actionExit                 = "exit"
+	actionExitParent           = "exitParent"
+	actionExitAll              = "exitAll"
+	actionRetry                = "retry"
+	actionRetryAll             = "retryAll"
+	actionContinue             = "continue"
+	actionPrevious             = "previous"
+)
+
+// evaluate reports whether a condition holds for an activity. Only the
+// primary objective is tracked, so conditions referencing another objective
+// are evaluated against it too.
+func (e *Engine) evaluate(a *Activity, c Condition) bool {
+	st := e.state.of(a)
+
+	var result bool
+	switch c.Condition {
+	case "satisfied":
+		result = st.ObjectiveKnown && st.Satisfied
+	case "objectiveStatusKnown":
+		result = st.ObjectiveKnown
+	case "objectiveMeasureKnown":
+		result = st.MeasureKnown
+	case "objectiveMeasureGreaterThan":
+		result = st.MeasureKnown && st.Measure > c.MeasureThreshold
+	case "objectiveMeasureLessThan":
+		result = st.MeasureKnown && st.Measure < c.MeasureThreshold
+	case "completed":
+		result = st.ProgressKnown && st.Completed
+	case "activityProgressKnown":
+		result = st.ProgressKnown
+	case "attempted":
+		result = st.AttemptCount > 0
+	case "attemptLimitExceeded":
+		result = e.limitExceeded(a)
+	case "timeLimitExceeded":
+		result = a.Def.AttemptDurationLimit > 0 && st.Duration >= a.Def.AttemptDurationLimit
+	case "always":
+		result = true
+	}
+
+	if c.Negate {
+		return !result
+	}
+	return result
+}
+
+// matches reports whether the conditions of a rule hold, combined with all
+// or any.
+func (e *Engine) matches(a *Activity, all bool, conditions []Condition) bool {
+	if len(conditions) == 0 {
+		return false
+	}
+	for _, c := range conditions {
+		held := e.evaluate(a, c)
+		if all && !held {
+			return false
+		}
+		if !all && held {
+			return true
+		}
+	}
+	return all
+}
+
+// ruleAction returns the action of the first rule whose conditions hold and
+// whose action is one of actions, or "" when none applies.
+func (e *Engine) ruleAction(a *Activity, rules []Rule, actions ...string) string {
+	for _, r := range rules {
+		wanted := false
+		for _, action := range actions {
+			if r.Action == action {
+				wanted = true
+				break
+			}
+		}
+		if wanted && e.matches(a, r.All, r.Conditions) {
+			return r.Action
+		}
+	}
+	return ""
+}
+
+// limitExceeded reports whether the attempt limit of an activity was reached.
+// An active or suspended activity is still within its current attempt.
+func (e *Engine) limitExceeded(a *Activity) bool {
+	st := e.state.of(a)
+	if a.Def.AttemptLimit <= 0 || st.Active || st.Suspended {
+		return false
+	}
+	return st.AttemptCount >= a.Def.AttemptLimit
+}
+
+// checkActivity reports whether an activity may be delivered or entered: it
+// must not be disabled by a precondition rule nor have used up its attempts.
+func (e *Engine) checkActivity(a *Activity) bool {
+	if e.ruleAction(a, a.Def.PreConditionRules, actionDisabled) != "" {
+		return false
+	}
+	return !e.limitExceeded(a)
+}
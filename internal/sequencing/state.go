@@ -0,0 +1,100 @@
+package sequencing
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/guilherme-gatti/poc_scorm/internal/storage"
+)
+
+// ActivityState is the tracking information of an activity: its attempt
+// progress and the status of its primary objective.
+type ActivityState struct {
+	AttemptCount int           `json:"attemptCount"`
+	Active       bool          `json:"active"`
+	Suspended    bool          `json:"suspended"`
+	Duration     time.Duration `json:"duration"`
+
+	ProgressKnown bool `json:"progressKnown"`
+	Completed     bool `json:"completed"`
+
+	ObjectiveKnown bool    `json:"objectiveKnown"`
+	Satisfied      bool    `json:"satisfied"`
+	MeasureKnown   bool    `json:"measureKnown"`
+	Measure        float64 `json:"measure"`
+}
+
+// State is the sequencing state of a learner in a course: the activity being
+// delivered, the one suspended by suspendAll and the tracking information of
+// every activity.
+type State struct {
+	Current    string                    `json:"current"`
+	Suspended  string                    `json:"suspended"`
+	Activities map[string]*ActivityState `json:"activities"`
+}
+
+// NewState returns the state of a learner who never started the course.
+func NewState() *State {
+	return &State{Activities: map[string]*ActivityState{}}
+}
+
+// of returns the tracking information of an activity, creating it on first
+// use.
+func (s *State) of(a *Activity) *ActivityState {
+	st, ok := s.Activities[a.ID]
+	if !ok {
+		st = &ActivityState{}
+		s.Activities[a.ID] = st
+	}
+	return st
+}
+
+// clone returns a deep copy of the state.
+func (s *State) clone() *State {
+	c := &State{Current: s.Current, Suspended: s.Suspended, Activities: make(map[string]*ActivityState, len(s.Activities))}
+	for id, st := range s.Activities {
+		copied := *st
+		c.Activities[id] = &copied
+	}
+	return c
+}
+
+// LoadState reads the sequencing state of a registration, returning a new
+// state when none was stored yet.
+func LoadState(registrationID int64) (*State, error) {
+	var stateJSON string
+	err := storage.DB.QueryRow(`
+		SELECT state_json FROM sequencing_state WHERE registration_id = ?
+	`, registrationID).Scan(&stateJSON)
+	if err == sql.ErrNoRows {
+		return NewState(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := NewState()
+	if err := json.Unmarshal([]byte(stateJSON), state); err != nil {
+		return nil, err
+	}
+	if state.Activities == nil {
+		state.Activities = map[string]*ActivityState{}
+	}
+	return state, nil
+}
+
+// SaveState stores the sequencing state of a registration.
+func SaveState(registrationID int64, state *State) error {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.DB.Exec(`
+		INSERT INTO sequencing_state (registration_id, state_json, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (registration_id) DO UPDATE SET state_json = excluded.state_json, updated_at = CURRENT_TIMESTAMP
+	`, registrationID, stateJSON)
+	return err
+}
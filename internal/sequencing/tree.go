@@ -0,0 +1,327 @@
+// Package sequencing implements the IMS Simple Sequencing behaviour of SCORM
+// 2004: the activity tree built from a manifest organization, the sequencing
+// and rollup rules of each activity and the navigation requests that decide
+// which SCO is delivered next.
+package sequencing
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+)
+
+// ControlMode holds the sequencing control modes of a cluster.
+type ControlMode struct {
+	Choice                         bool
+	ChoiceExit                     bool
+	Flow                           bool
+	ForwardOnly                    bool
+	UseCurrentAttemptObjectiveInfo bool
+	UseCurrentAttemptProgressInfo  bool
+}
+
+// Condition is a single sequencing or rollup rule condition.
+type Condition struct {
+	Condition           string
+	Negate              bool
+	ReferencedObjective string
+	MeasureThreshold    float64
+}
+
+// Rule is a pre, exit or post condition sequencing rule.
+type Rule struct {
+	All        bool
+	Conditions []Condition
+	Action     string
+}
+
+// RollupRule derives the status of a cluster from its children.
+type RollupRule struct {
+	ChildActivitySet string
+	MinimumCount     int
+	MinimumPercent   float64
+	All              bool
+	Conditions       []Condition
+	Action           string
+}
+
+// Definition is the sequencing definition of an activity with the defaults
+// of the specification applied.
+type Definition struct {
+	Control ControlMode
+
+	PreConditionRules  []Rule
+	ExitConditionRules []Rule
+	PostConditionRules []Rule
+
+	// AttemptLimit is zero when attempts are unlimited.
+	AttemptLimit         int
+	AttemptDurationLimit time.Duration
+
+	RollupObjectiveSatisfied bool
+	RollupProgressCompletion bool
+	ObjectiveMeasureWeight   float64
+	RollupRules              []RollupRule
+
+	RequiredForSatisfied        string
+	RequiredForNotSatisfied     string
+	RequiredForCompleted        string
+	RequiredForIncomplete       string
+	MeasureSatisfactionIfActive bool
+
+	Tracked                bool
+	CompletionSetByContent bool
+	ObjectiveSetByContent  bool
+
+	// The primary objective is the only one tracked by the engine.
+	PrimaryObjective     string
+	SatisfiedByMeasure   bool
+	MinNormalizedMeasure float64
+}
+
+// Activity is a node of the activity tree: the organization itself or one
+// of its items. Leaves reference the resource launched for them.
+type Activity struct {
+	ID         string
+	Title      string
+	ResourceID string
+	Parent     *Activity
+	Children   []*Activity
+	Def        Definition
+}
+
+// IsLeaf reports whether the activity is a leaf of the tree.
+func (a *Activity) IsLeaf() bool {
+	return len(a.Children) == 0
+}
+
+// index returns the position of a among its siblings.
+func (a *Activity) index() int {
+	if a.Parent == nil {
+		return 0
+	}
+	for i, c := range a.Parent.Children {
+		if c == a {
+			return i
+		}
+	}
+	return -1
+}
+
+// sibling returns the next (or previous) sibling of a, or nil.
+func (a *Activity) sibling(forward bool) *Activity {
+	if a.Parent == nil {
+		return nil
+	}
+	i := a.index()
+	if forward && i+1 < len(a.Parent.Children) {
+		return a.Parent.Children[i+1]
+	}
+	if !forward && i > 0 {
+		return a.Parent.Children[i-1]
+	}
+	return nil
+}
+
+// path returns the activities from the root down to a.
+func (a *Activity) path() []*Activity {
+	var path []*Activity
+	for n := a; n != nil; n = n.Parent {
+		path = append([]*Activity{n}, path...)
+	}
+	return path
+}
+
+// isAncestorOf reports whether a is b or one of its ancestors.
+func (a *Activity) isAncestorOf(b *Activity) bool {
+	for n := b; n != nil; n = n.Parent {
+		if n == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Tree is the activity tree of a manifest organization.
+type Tree struct {
+	Root *Activity
+	// Activities lists every activity in preorder.
+	Activities []*Activity
+	byID       map[string]*Activity
+}
+
+// Activity returns the activity with the given identifier.
+func (t *Tree) Activity(id string) (*Activity, bool) {
+	a, ok := t.byID[id]
+	return a, ok
+}
+
+var errNoOrganization = errors.New("manifest has no organization")
+
+// Build creates the activity tree of the default organization of a
+// manifest. Sequencing definitions referenced through IDRef are merged with
+// the local ones from the manifest's sequencingCollection.
+func Build(manifest scorm.Manifest) (*Tree, error) {
+	org, ok := manifest.DefaultOrganization()
+	if !ok {
+		return nil, errNoOrganization
+	}
+
+	t := &Tree{byID: map[string]*Activity{}}
+	t.Root = &Activity{ID: org.Identifier, Title: org.Title, Def: definition(manifest.ResolveSequencing(org.Sequencing))}
+	t.add(t.Root)
+
+	var build func(parent *Activity, items []scorm.Item)
+	build = func(parent *Activity, items []scorm.Item) {
+		for _, item := range items {
+			a := &Activity{
+				ID:         item.Identifier,
+				Title:      item.Title,
+				ResourceID: item.IdentifierRef,
+				Parent:     parent,
+				Def:        definition(manifest.ResolveSequencing(item.Sequencing)),
+			}
+			parent.Children = append(parent.Children, a)
+			t.add(a)
+			build(a, item.Items)
+		}
+	}
+	build(t.Root, org.Items)
+	return t, nil
+}
+
+func (t *Tree) add(a *Activity) {
+	t.Activities = append(t.Activities, a)
+	t.byID[a.ID] = a
+}
+
+// definition converts the resolved manifest sequencing of an activity,
+// applying the specification defaults for everything the manifest leaves out.
+func definition(seq scorm.Sequencing) Definition {
+	def := Definition{
+		Control: ControlMode{
+			Choice:                         true,
+			ChoiceExit:                     true,
+			UseCurrentAttemptObjectiveInfo: true,
+			UseCurrentAttemptProgressInfo:  true,
+		},
+		RollupObjectiveSatisfied: true,
+		RollupProgressCompletion: true,
+		ObjectiveMeasureWeight:   1,
+		RequiredForSatisfied:     "always",
+		RequiredForNotSatisfied:  "always",
+		RequiredForCompleted:     "always",
+		RequiredForIncomplete:    "always",
+		Tracked:                  true,
+		MinNormalizedMeasure:     1,
+	}
+
+	if cm := seq.ControlMode; cm != nil {
+		def.Control.Choice = boolAttr(cm.Choice, true)
+		def.Control.ChoiceExit = boolAttr(cm.ChoiceExit, true)
+		def.Control.Flow = boolAttr(cm.Flow, false)
+		def.Control.ForwardOnly = boolAttr(cm.ForwardOnly, false)
+		def.Control.UseCurrentAttemptObjectiveInfo = boolAttr(cm.UseCurrentAttemptObjectiveInfo, true)
+		def.Control.UseCurrentAttemptProgressInfo = boolAttr(cm.UseCurrentAttemptProgressInfo, true)
+	}
+
+	if sr := seq.SequencingRules; sr != nil {
+		def.PreConditionRules = rules(sr.PreConditionRule)
+		def.ExitConditionRules = rules(sr.ExitConditionRule)
+		def.PostConditionRules = rules(sr.PostConditionRule)
+	}
+
+	if lc := seq.LimitConditions; lc != nil {
+		def.AttemptLimit, _ = strconv.Atoi(strings.TrimSpace(lc.AttemptLimit))
+		def.AttemptDurationLimit, _ = scorm.ParseDuration(strings.TrimSpace(lc.AttemptAbsoluteDurationLimit))
+	}
+
+	if rr := seq.RollupRules; rr != nil {
+		def.RollupObjectiveSatisfied = boolAttr(rr.RollupObjectiveSatisfied, true)
+		def.RollupProgressCompletion = boolAttr(rr.RollupProgressCompletion, true)
+		def.ObjectiveMeasureWeight = floatAttr(rr.ObjectiveMeasureWeight, 1)
+		for _, r := range rr.RollupRule {
+			def.RollupRules = append(def.RollupRules, RollupRule{
+				ChildActivitySet: stringAttr(r.ChildActivitySet, "all"),
+				MinimumCount:     int(floatAttr(r.MinimumCount, 0)),
+				MinimumPercent:   floatAttr(r.MinimumPercent, 0),
+				All:              r.RollupConditions.ConditionCombination == "all",
+				Conditions:       conditions(r.RollupConditions.RollupCondition),
+				Action:           r.RollupAction.Action,
+			})
+		}
+	}
+
+	if rc := seq.RollupConsiderations; rc != nil {
+		def.RequiredForSatisfied = stringAttr(rc.RequiredForSatisfied, "always")
+		def.RequiredForNotSatisfied = stringAttr(rc.RequiredForNotSatisfied, "always")
+		def.RequiredForCompleted = stringAttr(rc.RequiredForCompleted, "always")
+		def.RequiredForIncomplete = stringAttr(rc.RequiredForIncomplete, "always")
+		def.MeasureSatisfactionIfActive = boolAttr(rc.MeasureSatisfactionIfActive, false)
+	}
+
+	if dc := seq.DeliveryControls; dc != nil {
+		def.Tracked = boolAttr(dc.Tracked, true)
+		def.CompletionSetByContent = boolAttr(dc.CompletionSetByContent, false)
+		def.ObjectiveSetByContent = boolAttr(dc.ObjectiveSetByContent, false)
+	}
+
+	if obj := seq.Objectives; obj != nil && obj.PrimaryObjective != nil {
+		def.PrimaryObjective = obj.PrimaryObjective.ObjectiveID
+		def.SatisfiedByMeasure = obj.PrimaryObjective.SatisfiedByMeasure
+		def.MinNormalizedMeasure = floatAttr(obj.PrimaryObjective.MinNormalizedMeasure, 1)
+	}
+
+	return def
+}
+
+func rules(manifestRules []scorm.ConditionRule) []Rule {
+	var result []Rule
+	for _, r := range manifestRules {
+		result = append(result, Rule{
+			All:        r.RuleConditions.ConditionCombination != "any",
+			Conditions: conditions(r.RuleConditions.RuleCondition),
+			Action:     r.RuleAction.Action,
+		})
+	}
+	return result
+}
+
+func conditions(manifestConditions []scorm.RuleCondition) []Condition {
+	var result []Condition
+	for _, c := range manifestConditions {
+		result = append(result, Condition{
+			Condition:           c.Condition,
+			Negate:              c.Operator == "not",
+			ReferencedObjective: c.ReferencedObjective,
+			MeasureThreshold:    floatAttr(c.MeasureThreshold, 0),
+		})
+	}
+	return result
+}
+
+func boolAttr(value string, def bool) bool {
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+func floatAttr(value string, def float64) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
+func stringAttr(value, def string) string {
+	if v := strings.TrimSpace(value); v != "" {
+		return v
+	}
+	return def
+}
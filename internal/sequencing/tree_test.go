@@ -0,0 +1,40 @@
+package sequencing
+
+import (
+	"testing"
+	"time"
+
+	scorm "github.com/guilherme-gatti/poc_scorm/internal/scormpackage"
+)
+
+func TestBuildReadsAttemptDurationLimit(t *testing.T) {
+	manifest := flowManifest()
+	manifest.Organizations.Organization[0].Items[0].Sequencing = &scorm.Sequencing{
+		LimitConditions: &scorm.LimitConditions{AttemptAbsoluteDurationLimit: "P1MT12H"},
+	}
+	tree := buildTree(t, manifest)
+
+	a, ok := tree.Activity("a")
+	if !ok {
+		t.Fatal("activity a not in the tree")
+	}
+	if want := 30*24*time.Hour + 12*time.Hour; a.Def.AttemptDurationLimit != want {
+		t.Errorf("AttemptDurationLimit = %v, want %v", a.Def.AttemptDurationLimit, want)
+	}
+}
+
+func TestBuildUsesDefaultOrganization(t *testing.T) {
+	manifest := flowManifest()
+	manifest.Organizations.Organization = append([]scorm.Organization{{
+		Identifier: "other",
+		Items:      []scorm.Item{{Identifier: "x", IdentifierRef: "r"}},
+	}}, manifest.Organizations.Organization...)
+	tree := buildTree(t, manifest)
+
+	if _, ok := tree.Activity("a"); !ok {
+		t.Error("tree was not built from the default organization")
+	}
+	if _, ok := tree.Activity("x"); ok {
+		t.Error("tree has activities of another organization")
+	}
+}
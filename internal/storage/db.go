@@ -2,15 +2,31 @@ package storage
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
 
+// sqliteOptions vale para cada conexão do pool: com o WAL as leituras não
+// esperam as escritas, e o busy_timeout faz uma escrita aguardar a outra em
+// vez de falhar com "database is locked" (o importador, o runtime e os
+// handlers gravam ao mesmo tempo). Com o _txlock=immediate toda transação
+// reserva a escrita no BEGIN: uma transação que lê e depois grava não vê o
+// banco mudar no meio nem falha ao passar da leitura para a escrita.
+const sqliteOptions = "_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+
 func InitDB(dataSource string) {
+	if strings.Contains(dataSource, "?") {
+		dataSource += "&" + sqliteOptions
+	} else {
+		dataSource += "?" + sqliteOptions
+	}
+
 	var err error
 	DB, err = sql.Open("sqlite3", dataSource)
 	if err != nil {
@@ -28,5 +44,85 @@ func InitDB(dataSource string) {
 		log.Fatal(err)
 	}
 
+	err = migrate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Println("Banco de dados inicializado com sucesso")
 }
+
+// colunas adicionadas depois que a tabela já existia: o schema.sql só cria
+// tabelas novas (CREATE TABLE IF NOT EXISTS), então bancos antigos recebem
+// as colunas aqui
+var migrations = []struct {
+	table, column, definition string
+}{
+	{"progress", "total_time", "TEXT"},
+	{"progress", "attempt_id", "INTEGER"},
+	{"attempts", "total_seconds", "REAL NOT NULL DEFAULT 0"},
+	{"runtime_sessions", "passing_score", "REAL"},
+	{"runtime_sessions", "max_time_seconds", "REAL"},
+	{"runtime_sessions", "time_limit_action", "TEXT NOT NULL DEFAULT ''"},
+	{"runtime_sessions", "completion_threshold", "REAL"},
+	{"runtime_sessions", "user_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"runtime_sessions", "course_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"runtime_sessions", "sco_id", "TEXT NOT NULL DEFAULT ''"},
+	{"courses", "attempt_limit", "INTEGER NOT NULL DEFAULT 0"},
+	{"course_items", "attempt_limit", "INTEGER NOT NULL DEFAULT 0"},
+	{"attempts", "completion_status", "TEXT NOT NULL DEFAULT 'unknown'"},
+	{"attempts", "success_status", "TEXT NOT NULL DEFAULT 'unknown'"},
+	{"attempts", "score_raw", "REAL"},
+	{"attempts", "score_scaled", "REAL"},
+	{"courses", "storage_key", "TEXT NOT NULL DEFAULT ''"},
+	{"import_jobs", "storage_key", "TEXT NOT NULL DEFAULT ''"},
+	{"courses", "version_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"courses", "migration_policy", "TEXT NOT NULL DEFAULT 'next-attempt'"},
+	{"course_items", "version_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"registrations", "version_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"runtime_sessions", "version_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"import_jobs", "course_version", "INTEGER"},
+	{"course_versions", "lint_json", "TEXT NOT NULL DEFAULT ''"},
+	{"import_jobs", "lint_json", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// migrate adiciona as colunas que ainda não existem no banco
+func migrate() error {
+	for _, m := range migrations {
+		exists, err := HasColumn(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition))
+		if err != nil {
+			return fmt.Errorf("erro ao adicionar coluna %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
+// HasColumn informa se a tabela já tem a coluna
+func HasColumn(table, column string) (bool, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitDBConfiguresConnections(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// o schema é lido a partir da raiz do repositório
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	InitDB(filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(func() { DB.Close() })
+
+	var mode string
+	if err := DB.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+
+	// o busy_timeout vale para cada conexão nova do pool
+	DB.SetMaxIdleConns(0)
+	for range 2 {
+		var timeout int
+		if err := DB.QueryRow(`PRAGMA busy_timeout`).Scan(&timeout); err != nil {
+			t.Fatal(err)
+		}
+		if timeout != 5000 {
+			t.Errorf("busy_timeout = %d, want 5000", timeout)
+		}
+	}
+}
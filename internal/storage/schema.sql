@@ -4,8 +4,41 @@ CREATE TABLE IF NOT EXISTS courses (
   identifier TEXT NOT NULL,
   version TEXT NOT NULL,
   manifest_json TEXT NOT NULL,
-  path TEXT NOT NULL,
-  digital_course_json TEXT
+  storage_key TEXT NOT NULL DEFAULT '',
+  digital_course_json TEXT,
+  attempt_limit INTEGER NOT NULL DEFAULT 0,
+  version_id INTEGER NOT NULL DEFAULT 0,
+  migration_policy TEXT NOT NULL DEFAULT 'next-attempt'
+);
+
+-- Cria tabela de versões dos cursos; courses guarda uma cópia da versão atual
+CREATE TABLE IF NOT EXISTS course_versions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  course_id INTEGER NOT NULL,
+  number INTEGER NOT NULL,
+  version TEXT NOT NULL DEFAULT '',
+  manifest_json TEXT NOT NULL,
+  lint_json TEXT NOT NULL DEFAULT '',
+  storage_key TEXT NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (course_id, number)
+);
+
+-- Cria tabela de itens do curso com as configurações do manifesto por SCO
+CREATE TABLE IF NOT EXISTS course_items (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  course_id INTEGER NOT NULL,
+  organization TEXT NOT NULL,
+  identifier TEXT NOT NULL,
+  identifierref TEXT NOT NULL DEFAULT '',
+  title TEXT NOT NULL DEFAULT '',
+  passing_score REAL,
+  max_time_allowed TEXT NOT NULL DEFAULT '',
+  time_limit_action TEXT NOT NULL DEFAULT '',
+  data_from_lms TEXT NOT NULL DEFAULT '',
+  completion_threshold REAL,
+  attempt_limit INTEGER NOT NULL DEFAULT 0,
+  version_id INTEGER NOT NULL DEFAULT 0
 );
 
 -- Cria tabela de progresso
@@ -14,7 +47,162 @@ CREATE TABLE IF NOT EXISTS progress (
   user_id INTEGER NOT NULL,
   course_id INTEGER NOT NULL,
   sco_id TEXT,
+  attempt_id INTEGER,
   status TEXT,
   score INTEGER,
+  total_time TEXT,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cria tabela de matrículas (aluno x curso)
+CREATE TABLE IF NOT EXISTS registrations (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  course_id INTEGER NOT NULL,
+  version_id INTEGER NOT NULL DEFAULT 0,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (user_id, course_id)
+);
+
+-- Cria tabela de tentativas do runtime SCORM (dados CMI por aluno, curso e SCO)
+CREATE TABLE IF NOT EXISTS attempts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  registration_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  course_id INTEGER NOT NULL,
+  sco_id TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'active',
+  cmi_json TEXT,
+  total_seconds REAL NOT NULL DEFAULT 0,
+  completion_status TEXT NOT NULL DEFAULT 'unknown',
+  success_status TEXT NOT NULL DEFAULT 'unknown',
+  score_raw REAL,
+  score_scaled REAL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cria tabela de interações (cmi.interactions) gravadas por tentativa
+CREATE TABLE IF NOT EXISTS interactions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  attempt_id INTEGER NOT NULL,
+  idx INTEGER NOT NULL,
+  interaction_id TEXT NOT NULL,
+  type TEXT NOT NULL DEFAULT '',
+  timestamp TEXT NOT NULL DEFAULT '',
+  weighting REAL,
+  learner_response TEXT NOT NULL DEFAULT '',
+  result TEXT NOT NULL DEFAULT '',
+  latency TEXT NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  correct_responses TEXT NOT NULL DEFAULT '[]',
+  objective_ids TEXT NOT NULL DEFAULT '[]',
+  UNIQUE (attempt_id, idx)
+);
+
+-- Cria tabela de objetivos (cmi.objectives) gravados por tentativa
+CREATE TABLE IF NOT EXISTS objectives (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  attempt_id INTEGER NOT NULL,
+  idx INTEGER NOT NULL,
+  objective_id TEXT NOT NULL,
+  success_status TEXT NOT NULL DEFAULT '',
+  completion_status TEXT NOT NULL DEFAULT '',
+  score_scaled REAL,
+  score_raw REAL,
+  score_min REAL,
+  score_max REAL,
+  progress_measure REAL,
+  description TEXT NOT NULL DEFAULT '',
+  UNIQUE (attempt_id, idx)
+);
+
+-- Cria tabela com o estado de sequenciamento (IMS SS) por matrícula
+CREATE TABLE IF NOT EXISTS sequencing_state (
+  registration_id INTEGER PRIMARY KEY,
+  state_json TEXT NOT NULL,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cria tabela com o status consolidado (rollup) do aluno no curso
+CREATE TABLE IF NOT EXISTS course_rollups (
+  registration_id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  course_id INTEGER NOT NULL,
+  completion_status TEXT NOT NULL,
+  success_status TEXT NOT NULL,
+  score_scaled REAL,
+  activities_json TEXT NOT NULL,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cria tabela de sessões de runtime criadas pelo launch
+CREATE TABLE IF NOT EXISTS runtime_sessions (
+  token TEXT PRIMARY KEY,
+  attempt_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL DEFAULT 0,
+  course_id INTEGER NOT NULL DEFAULT 0,
+  sco_id TEXT NOT NULL DEFAULT '',
+  version TEXT NOT NULL,
+  learner_name TEXT NOT NULL DEFAULT '',
+  launch_data TEXT NOT NULL DEFAULT '',
+  mode TEXT NOT NULL DEFAULT 'normal',
+  credit TEXT NOT NULL DEFAULT 'credit',
+  resumed INTEGER NOT NULL DEFAULT 0,
+  state TEXT NOT NULL DEFAULT 'not initialized',
+  passing_score REAL,
+  max_time_seconds REAL,
+  time_limit_action TEXT NOT NULL DEFAULT '',
+  completion_threshold REAL,
+  version_id INTEGER NOT NULL DEFAULT 0,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cria tabela de jobs de importação de pacotes (processados em segundo plano)
+CREATE TABLE IF NOT EXISTS import_jobs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  filename TEXT NOT NULL,
+  zip_path TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'queued',
+  stage TEXT NOT NULL DEFAULT '',
+  stages_json TEXT NOT NULL DEFAULT '[]',
+  warnings_json TEXT NOT NULL DEFAULT '[]',
+  error TEXT NOT NULL DEFAULT '',
+  rule TEXT NOT NULL DEFAULT '',
+  course_id INTEGER,
+  course_version INTEGER,
+  storage_key TEXT NOT NULL DEFAULT '',
+  lint_json TEXT NOT NULL DEFAULT '',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cria tabela de uploads em partes (protocolo tus); os bytes ficam em storage/uploads
+CREATE TABLE IF NOT EXISTS uploads (
+  id TEXT PRIMARY KEY,
+  filename TEXT NOT NULL,
+  upload_length INTEGER NOT NULL,
+  upload_offset INTEGER NOT NULL DEFAULT 0,
+  job_id INTEGER,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
   updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
+
+-- Cria tabela de pacotes armazenados, identificados pelo SHA-256 do zip
+CREATE TABLE IF NOT EXISTS packages (
+  storage_key TEXT PRIMARY KEY,
+  file_count INTEGER NOT NULL,
+  size INTEGER NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cria tabela com os arquivos de cada pacote; o conteúdo fica em storage/blobs pelo sha256
+CREATE TABLE IF NOT EXISTS package_files (
+  storage_key TEXT NOT NULL,
+  path TEXT NOT NULL,
+  sha256 TEXT NOT NULL,
+  size INTEGER NOT NULL,
+  PRIMARY KEY (storage_key, path)
+);
+
+CREATE INDEX IF NOT EXISTS idx_package_files_sha256 ON package_files (sha256);